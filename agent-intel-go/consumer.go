@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"contracts-go/events"
+	"contracts-go/subjects"
+
 	"github.com/nats-io/nats.go"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -59,42 +64,27 @@ func NewEventConsumer(natsURL string, mongoDB *mongo.Database, mongoClient *mong
 	return consumer, nil
 }
 
-// initializeStream creates the AGENT stream if it doesn't exist
+// initializeStream creates the AGENT and TASK_EVENTS streams if they don't
+// exist, or updates them so streams created with older subject filters capture all events
 func (ec *EventConsumer) initializeStream() error {
-	streamName := "AGENT"
-
-	// Check if stream already exists
-	_, err := ec.js.StreamInfo(streamName)
-	if err == nil {
-		log.Printf("Stream %s already exists", streamName)
-		return nil
-	}
-
-	// Create stream
-	_, err = ec.js.AddStream(&nats.StreamConfig{
-		Name:     streamName,
-		Subjects: []string{"agent.*"},
-		Storage:  nats.FileStorage,
-		MaxAge:   7 * 24 * time.Hour, // Keep messages for 7 days
-		Replicas: 1,
-	})
-	if err != nil {
-		return err
+	for _, name := range []string{subjects.StreamAgent, subjects.StreamTaskEvents} {
+		if err := subjects.EnsureStream(ec.js, name); err != nil {
+			return err
+		}
+		log.Printf("Stream %s is ready", name)
 	}
-
-	log.Printf("Created stream: %s", streamName)
 	return nil
 }
 
 // Start begins consuming events
 func (ec *EventConsumer) Start() error {
 	// Subscribe to task.new events
-	_, err := ec.js.Subscribe("agent.task.new", ec.handleTaskNew,
-		nats.Durable("agent-intel-task-new"),
+	_, err := ec.js.Subscribe(subjects.AgentTaskNew, ec.handleTaskNew,
+		nats.Durable(subjects.ConsumerAgentIntelTaskNew),
 		nats.ManualAck(),
 		nats.MaxDeliver(3),
 		nats.AckWait(30*time.Second),
-		nats.BindStream("AGENT"),
+		nats.BindStream(subjects.StreamAgent),
 	)
 	if err != nil {
 		log.Printf("Failed to subscribe to agent.task.new: %v", err)
@@ -103,12 +93,12 @@ func (ec *EventConsumer) Start() error {
 	log.Println("Subscribed to agent.task.new")
 
 	// Subscribe to pipeline.completed events
-	_, err = ec.js.Subscribe("agent.pipeline.completed", ec.handlePipelineCompleted,
-		nats.Durable("agent-intel-pipeline-completed"),
+	_, err = ec.js.Subscribe(subjects.AgentPipelineCompleted, ec.handlePipelineCompleted,
+		nats.Durable(subjects.ConsumerAgentIntelPipelineComplete),
 		nats.ManualAck(),
 		nats.MaxDeliver(3),
 		nats.AckWait(30*time.Second),
-		nats.BindStream("AGENT"),
+		nats.BindStream(subjects.StreamAgent),
 	)
 	if err != nil {
 		log.Printf("Failed to subscribe to agent.pipeline.completed: %v", err)
@@ -116,6 +106,21 @@ func (ec *EventConsumer) Start() error {
 	}
 	log.Println("Subscribed to agent.pipeline.completed")
 
+	// Subscribe to cancellations published by queue-go
+	_, err = ec.js.Subscribe(subjects.TaskCancel, ec.handleTaskCancel,
+		nats.Durable(subjects.ConsumerAgentIntelTaskCancel),
+		nats.DeliverNew(),
+		nats.ManualAck(),
+		nats.MaxDeliver(3),
+		nats.AckWait(30*time.Second),
+		nats.BindStream(subjects.StreamTaskEvents),
+	)
+	if err != nil {
+		log.Printf("Failed to subscribe to tasks.cancel: %v", err)
+		return err
+	}
+	log.Println("Subscribed to tasks.cancel")
+
 	return nil
 }
 
@@ -134,16 +139,18 @@ func (ec *EventConsumer) handleTaskNew(msg *nats.Msg) {
 	defer cancel()
 
 	pendingCol := ec.mongoDB.Collection("pending_tasks")
+	historyCol := ec.mongoDB.Collection("task_history")
 
-	// Check for idempotency - if task already exists, skip
-	count, err := pendingCol.CountDocuments(ctx, bson.M{"task_id": event.TaskID})
+	// Check for idempotency - replays of tasks that already finished must not
+	// re-enter the pending queue
+	count, err := historyCol.CountDocuments(ctx, bson.M{"task_id": event.TaskID})
 	if err != nil {
-		log.Printf("Error checking task existence: %v", err)
+		log.Printf("Error checking task history: %v", err)
 		msg.Nak()
 		return
 	}
 	if count > 0 {
-		log.Printf("Task %s already exists, skipping (idempotent)", event.TaskID)
+		log.Printf("Task %s already in history, skipping (idempotent)", event.TaskID)
 		msg.Ack()
 		return
 	}
@@ -151,7 +158,7 @@ func (ec *EventConsumer) handleTaskNew(msg *nats.Msg) {
 	// Get pending task count for this repository
 	repoPendingCount, err := pendingCol.CountDocuments(ctx, bson.M{
 		"repository": event.Repository,
-		"status":     bson.M{"$in": []string{StatusPending, StatusAssigned, StatusProcessing}},
+		"status":     bson.M{"$in": activeStatuses},
 	})
 	if err != nil {
 		log.Printf("Warning: Failed to count repo pending tasks: %v", err)
@@ -159,7 +166,6 @@ func (ec *EventConsumer) handleTaskNew(msg *nats.Msg) {
 	}
 
 	// Get last success time for this repository
-	historyCol := ec.mongoDB.Collection("task_history")
 	opts := options.FindOne().SetSort(bson.M{"completed_at": -1})
 	var lastTask TaskMetrics
 	err = historyCol.FindOne(ctx, bson.M{
@@ -186,10 +192,16 @@ func (ec *EventConsumer) handleTaskNew(msg *nats.Msg) {
 		PendingTasksCount: int(repoPendingCount),
 		SizeBytes:         event.SizeBytes,
 		Status:            StatusPending,
+		Capabilities:      event.Capabilities,
 	}
 
-	// Insert into pending_tasks collection
-	_, err = pendingCol.InsertOne(ctx, task)
+	// Insert into pending_tasks collection keyed on task_id; $setOnInsert makes
+	// the write a no-op when the task is already queued
+	result, err := pendingCol.UpdateOne(ctx,
+		bson.M{"task_id": event.TaskID},
+		bson.M{"$setOnInsert": task},
+		options.Update().SetUpsert(true),
+	)
 	if err != nil {
 		log.Printf("Error inserting task: %v", err)
 
@@ -204,6 +216,12 @@ func (ec *EventConsumer) handleTaskNew(msg *nats.Msg) {
 		return
 	}
 
+	if result.UpsertedCount == 0 {
+		log.Printf("Task %s already exists, skipping (idempotent)", event.TaskID)
+		msg.Ack()
+		return
+	}
+
 	log.Printf("Task %s stored successfully", event.TaskID)
 	msg.Ack()
 }
@@ -222,137 +240,79 @@ func (ec *EventConsumer) handlePipelineCompleted(msg *nats.Msg) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	pendingCol := ec.mongoDB.Collection("pending_tasks")
-	historyCol := ec.mongoDB.Collection("task_history")
-
-	// Find the task in pending collection
-	var task TaskMetrics
-	err := pendingCol.FindOne(ctx, bson.M{"task_id": event.TaskID}).Decode(&task)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Task might already be in history (idempotency check)
-			count, _ := historyCol.CountDocuments(ctx, bson.M{"task_id": event.TaskID})
-			if count > 0 {
-				log.Printf("Task %s already in history, skipping (idempotent)", event.TaskID)
-				msg.Ack()
-				return
-			}
-			log.Printf("Task %s not found in pending collection", event.TaskID)
-		} else {
-			log.Printf("Error finding task: %v", err)
-		}
-		msg.Nak()
-		return
-	}
-
-	// Update task with completion data
-	task.PipelineRuntimeMs = event.PipelineRuntimeMs
-	if event.Status == "success" {
-		task.Status = StatusCompleted
-	} else {
-		task.Status = StatusFailed
-		task.ErrorMessage = event.ErrorMessage
-	}
+	status := event.TaskStatus()
 
 	// Move task to history
-	_, err = historyCol.InsertOne(ctx, task)
+	// A worker whose lease expired must not finish a task reassigned to another worker
+	task, err := finishTask(ctx, ec.mongoDB, event.TaskID, event.WorkerID, status, event.PipelineRuntimeMs, event.ErrorMessage, activeStatuses)
 	if err != nil {
-		// Check for duplicate
-		if mongo.IsDuplicateKeyError(err) {
-			log.Printf("Task %s already in history (race condition)", event.TaskID)
-			// Still remove from pending
-		} else {
-			log.Printf("Error inserting into history: %v", err)
+		var transitionErr *TransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			// Already in history (idempotent replay) or cancelled meanwhile
+			log.Printf("Skipping pipeline.completed for task %s: %v", event.TaskID, err)
+			msg.Ack()
+		case errors.Is(err, ErrNotAssignedToWorker):
+			log.Printf("Skipping pipeline.completed for task %s from worker %s: %v", event.TaskID, event.WorkerID, err)
+			msg.Ack()
+		case errors.Is(err, ErrTaskNotFound):
+			// Deleted meanwhile, redelivering would never find it
+			log.Printf("Skipping pipeline.completed for task %s: %v", event.TaskID, err)
+			msg.Ack()
+		default:
+			log.Printf("Error moving task to history: %v", err)
 			msg.Nak()
-			return
 		}
+		return
 	}
 
-	// Remove from pending
-	_, err = pendingCol.DeleteOne(ctx, bson.M{"task_id": event.TaskID})
-	if err != nil {
-		log.Printf("Warning: Failed to delete task from pending: %v", err)
-	}
-
-	// Update metrics for this repository
-	ec.updateRepositoryMetrics(ctx, event.Repository)
-
 	log.Printf("Task %s moved to history with status %s", event.TaskID, task.Status)
 	msg.Ack()
 }
 
-// updateRepositoryMetrics recalculates metrics for all pending tasks in a repository
-func (ec *EventConsumer) updateRepositoryMetrics(ctx context.Context, repository string) {
-	pendingCol := ec.mongoDB.Collection("pending_tasks")
-	historyCol := ec.mongoDB.Collection("task_history")
-
-	// Get pending count for this repo
-	pendingCount, err := pendingCol.CountDocuments(ctx, bson.M{
-		"repository": repository,
-		"status":     bson.M{"$in": []string{StatusPending, StatusAssigned, StatusProcessing}},
-	})
-	if err != nil {
-		log.Printf("Error counting pending tasks for %s: %v", repository, err)
+// handleTaskCancel processes tasks.cancel events, cancelling tasks that haven't finished
+func (ec *EventConsumer) handleTaskCancel(msg *nats.Msg) {
+	var event events.CancelMessage
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		log.Printf("Error unmarshaling tasks.cancel event: %v", err)
+		msg.Term()
 		return
 	}
 
-	// Get last success and average runtime
-	opts := options.FindOne().SetSort(bson.M{"completed_at": -1})
-	var lastTask TaskMetrics
-	err = historyCol.FindOne(ctx, bson.M{
-		"repository": repository,
-		"status":     StatusCompleted,
-	}, opts).Decode(&lastTask)
-
-	lastSuccessAt := time.Time{}
-	if err == nil {
-		lastSuccessAt = lastTask.AssignedAt
-	}
-
-	// Calculate average runtime from last 10 completed tasks
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{
-			"repository":          repository,
-			"status":              StatusCompleted,
-			"pipeline_runtime_ms": bson.M{"$gt": 0},
-		}}},
-		{{Key: "$sort", Value: bson.M{"completed_at": -1}}},
-		{{Key: "$limit", Value: 10}},
-		{{Key: "$group", Value: bson.M{
-			"_id":         nil,
-			"avg_runtime": bson.M{"$avg": "$pipeline_runtime_ms"},
-		}}},
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	cursor, err := historyCol.Aggregate(ctx, pipeline)
+	changed, err := cancelTask(ctx, ec.mongoDB, event.TaskID, event.Reason)
 	if err != nil {
-		log.Printf("Error calculating avg runtime for %s: %v", repository, err)
+		var transitionErr *TransitionError
+		if errors.As(err, &transitionErr) || errors.Is(err, ErrTaskNotFound) {
+			// Finished before the cancellation arrived, or never queued here
+			log.Printf("Skipping tasks.cancel for task %s: %v", event.TaskID, err)
+			msg.Ack()
+			return
+		}
+		log.Printf("Error cancelling task %s: %v", event.TaskID, err)
+		msg.Nak()
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var avgResult struct {
-		AvgRuntime float64 `bson:"avg_runtime"`
-	}
-	avgRuntime := int64(0)
-	if cursor.Next(ctx) {
-		cursor.Decode(&avgResult)
-		avgRuntime = int64(avgResult.AvgRuntime)
+	if changed {
+		log.Printf("Task %s cancelled", event.TaskID)
 	}
+	msg.Ack()
+}
 
-	// Update all pending tasks for this repository
-	_, err = pendingCol.UpdateMany(
-		ctx,
-		bson.M{"repository": repository, "status": bson.M{"$ne": StatusCancelled}},
-		bson.M{"$set": bson.M{
-			"last_success_at":     lastSuccessAt,
-			"avg_runtime_ms":      avgRuntime,
-			"pending_tasks_count": int(pendingCount),
-		}},
-	)
+// PublishTaskCancel publishes a task cancellation for the worker running the task and queue-go
+func (ec *EventConsumer) PublishTaskCancel(taskID, reason string) error {
+	data, err := json.Marshal(events.NewCancelMessage(taskID, reason))
 	if err != nil {
-		log.Printf("Error updating metrics for %s: %v", repository, err)
+		return fmt.Errorf("failed to marshal tasks.cancel event: %w", err)
+	}
+
+	if _, err := ec.js.Publish(subjects.TaskCancel, data); err != nil {
+		return fmt.Errorf("failed to publish tasks.cancel event: %w", err)
 	}
+	return nil
 }
 
 // Close closes the NATS connection
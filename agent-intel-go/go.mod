@@ -3,6 +3,7 @@ module agent-intel-go
 go 1.21
 
 require (
+	contracts-go v0.0.0
 	github.com/nats-io/nats.go v1.31.0
 	go.mongodb.org/mongo-driver v1.13.1
 )
@@ -22,3 +23,5 @@ require (
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
+
+replace contracts-go => ../contracts-go
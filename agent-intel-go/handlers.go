@@ -3,19 +3,36 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
+	"contracts-go/model"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // AgentIntelService holds the service dependencies
 type AgentIntelService struct {
-	mongoDB     *mongo.Database
-	mongoClient *mongo.Client
-	natsURL     string
+	mongoDB       *mongo.Database
+	mongoClient   *mongo.Client
+	natsURL       string
+	leaseDuration time.Duration
+	events        *EventConsumer // Publishes cancellations, nil when NATS is unavailable
+}
+
+// getLeaseDuration returns the configured assignment lease duration
+func (s *AgentIntelService) getLeaseDuration() time.Duration {
+	if s.leaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return s.leaseDuration
 }
 
 // healthHandler returns the health status of the service
@@ -33,84 +50,329 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
-// getNextTaskHandler returns the next task with highest priority
+// maxClaimAttempts bounds how often the candidate list is refetched when other workers win every claim
+const maxClaimAttempts = 5
+
+// scoredTask pairs a task with its priority score
+type scoredTask struct {
+	task  *TaskMetrics
+	score float64
+}
+
+// getNextTaskHandler claims and returns the next task with highest priority.
+// With ?peek=true the task is returned without claiming it.
 func (s *AgentIntelService) getNextTaskHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Get optional repo_id filter
-	repoID := r.URL.Query().Get("repo_id")
+	// Get worker identity and build the query filter from the optional
+	// repo_id and capabilities parameters
+	workerID := r.URL.Query().Get("worker_id")
+	filter, err := pendingTaskFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pendingCol := s.mongoDB.Collection("pending_tasks")
+
+	for attempt := 1; attempt <= maxClaimAttempts; attempt++ {
+		// Fetch all pending tasks
+		cursor, err := pendingCol.Find(ctx, filter)
+		if err != nil {
+			http.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
+			log.Printf("Error fetching tasks: %v", err)
+			return
+		}
+
+		var tasks []TaskMetrics
+		if err := cursor.All(ctx, &tasks); err != nil {
+			http.Error(w, "Failed to decode tasks", http.StatusInternalServerError)
+			log.Printf("Error decoding tasks: %v", err)
+			return
+		}
+
+		if len(tasks) == 0 {
+			break
+		}
+		ranked := rankTasks(tasks)
+
+		// Peeking shows what a worker would get next, e.g. for the CLI, and
+		// leaves the task pending
+		if r.URL.Query().Get("peek") == "true" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(NextTaskResponse{Task: ranked[0].task, Score: ranked[0].score})
+			return
+		}
 
-	// Build query filter
+		// Try candidates from highest to lowest score; losing a claim to another
+		// worker moves on to the next best task
+		for _, candidate := range ranked {
+			claimed, err := s.claimTask(ctx, candidate.task.TaskID, workerID)
+			if err != nil {
+				http.Error(w, "Failed to claim task", http.StatusInternalServerError)
+				log.Printf("Error claiming task %s: %v", candidate.task.TaskID, err)
+				return
+			}
+			if claimed == nil {
+				continue
+			}
+
+			// Return task with score
+			response := NextTaskResponse{
+				Task:  claimed,
+				Score: candidate.score,
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		log.Printf("All %d candidate tasks were claimed concurrently, retrying (attempt %d/%d)", len(tasks), attempt, maxClaimAttempts)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{"error": "no tasks available"})
+}
+
+// pendingTaskFilter builds the filter of the pending tasks a worker may claim.
+// When the worker sends its capabilities (possibly none), tasks requiring a
+// capability outside that list are left to other workers.
+func pendingTaskFilter(query url.Values) (bson.M, error) {
 	filter := bson.M{"status": StatusPending}
-	if repoID != "" {
+	if repoID := query.Get("repo_id"); repoID != "" {
 		filter["repository"] = repoID
 	}
 
-	// Fetch all pending tasks
+	if query.Has("capabilities") {
+		var labels []string
+		if value := query.Get("capabilities"); value != "" {
+			labels = strings.Split(value, ",")
+		}
+		capabilities, err := model.NormalizeCapabilities(labels)
+		if err != nil {
+			return nil, err
+		}
+		if capabilities == nil {
+			capabilities = []string{}
+		}
+		// No required capability may be missing from the worker's list
+		filter["capabilities"] = bson.M{"$not": bson.M{"$elemMatch": bson.M{"$nin": capabilities}}}
+	}
+
+	return filter, nil
+}
+
+// rankTasks scores tasks and sorts them by descending priority
+func rankTasks(tasks []TaskMetrics) []scoredTask {
+	ranked := make([]scoredTask, len(tasks))
+	for i := range tasks {
+		ranked[i] = scoredTask{task: &tasks[i], score: CalculateScore(&tasks[i])}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	return ranked
+}
+
+// claimTask atomically moves a task from pending to assigned. It returns nil
+// without error when the task is no longer pending (claimed by another worker).
+func (s *AgentIntelService) claimTask(ctx context.Context, taskID, workerID string) (*TaskMetrics, error) {
 	pendingCol := s.mongoDB.Collection("pending_tasks")
-	cursor, err := pendingCol.Find(ctx, filter)
+
+	now := time.Now()
+	update := bson.M{
+		"status":           StatusAssigned,
+		"assigned_at":      now,
+		"lease_expires_at": now.Add(s.getLeaseDuration()),
+	}
+	if workerID != "" {
+		update["worker_id"] = workerID
+	}
+
+	var claimed TaskMetrics
+	err := pendingCol.FindOneAndUpdate(
+		ctx,
+		bson.M{"task_id": taskID, "status": StatusPending},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&claimed)
 	if err != nil {
-		http.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
-		log.Printf("Error fetching tasks: %v", err)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &claimed, nil
+}
+
+// heartbeatHandler extends the assignment lease of a task held by a worker
+func (s *AgentIntelService) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var tasks []TaskMetrics
-	if err := cursor.All(ctx, &tasks); err != nil {
-		http.Error(w, "Failed to decode tasks", http.StatusInternalServerError)
-		log.Printf("Error decoding tasks: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var req HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if len(tasks) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "no tasks available"})
+	if req.TaskID == "" {
+		http.Error(w, "task_id is required", http.StatusBadRequest)
 		return
 	}
 
-	// Calculate scores and find highest priority task
-	var bestTask *TaskMetrics
-	var bestScore float64
+	if req.WorkerID == "" {
+		http.Error(w, "worker_id is required", http.StatusBadRequest)
+		return
+	}
 
-	for i := range tasks {
-		score := CalculateScore(&tasks[i])
-		if bestTask == nil || score > bestScore {
-			bestTask = &tasks[i]
-			bestScore = score
+	pendingCol := s.mongoDB.Collection("pending_tasks")
+
+	// Only the worker holding an active assignment may extend it
+	filter := bson.M{
+		"task_id":   req.TaskID,
+		"status":    bson.M{"$in": []string{StatusAssigned, StatusProcessing}},
+		"worker_id": req.WorkerID,
+	}
+
+	leaseExpiresAt := time.Now().Add(s.getLeaseDuration())
+	result, err := pendingCol.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"lease_expires_at": leaseExpiresAt},
+	})
+	if err != nil {
+		http.Error(w, "Failed to extend lease", http.StatusInternalServerError)
+		log.Printf("Error extending lease: %v", err)
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := pendingCol.CountDocuments(ctx, bson.M{"task_id": req.TaskID})
+		if err == nil && count == 0 {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
 		}
+		// Lease expired and was reclaimed, or the task belongs to another worker
+		http.Error(w, "Task is not assigned to this worker", http.StatusConflict)
+		return
 	}
 
-	// Mark task as assigned
-	now := time.Now()
-	bestTask.Status = StatusAssigned
-	bestTask.AssignedAt = now
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(HeartbeatResponse{
+		TaskID:         req.TaskID,
+		LeaseExpiresAt: leaseExpiresAt,
+	})
+}
 
-	_, err = pendingCol.UpdateOne(
-		ctx,
-		bson.M{"task_id": bestTask.TaskID},
-		bson.M{
-			"$set": bson.M{
-				"status":      StatusAssigned,
-				"assigned_at": now,
-			},
-		},
-	)
+// startTaskHandler marks an assigned task as processing
+func (s *AgentIntelService) startTaskHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeTransitionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	task, err := startTask(ctx, s.mongoDB, req.TaskID, req.WorkerID)
 	if err != nil {
-		log.Printf("Warning: Failed to update task status: %v", err)
+		writeTransitionError(w, err)
+		return
 	}
 
-	// Return task with score
-	response := NextTaskResponse{
-		Task:  bestTask,
-		Score: bestScore,
+	log.Printf("Task %s started by worker %s", task.TaskID, task.WorkerID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(task)
+}
+
+// completeTaskHandler marks an assigned or processing task as completed and moves it to history
+func (s *AgentIntelService) completeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	s.finishTaskHandler(w, r, StatusCompleted)
+}
+
+// failTaskHandler marks an assigned or processing task as failed and moves it to history
+func (s *AgentIntelService) failTaskHandler(w http.ResponseWriter, r *http.Request) {
+	s.finishTaskHandler(w, r, StatusFailed)
+}
+
+// finishTaskHandler moves a claimed task to a final status
+func (s *AgentIntelService) finishTaskHandler(w http.ResponseWriter, r *http.Request, status string) {
+	req, ok := decodeTransitionRequest(w, r)
+	if !ok {
+		return
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	task, err := finishTask(ctx, s.mongoDB, req.TaskID, req.WorkerID, status, req.RuntimeMs, req.ErrorMessage, claimedStatuses)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	log.Printf("Task %s moved to history with status %s", task.TaskID, task.Status)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(task)
+}
+
+// decodeTransitionRequest validates the method and body of a lifecycle request
+func decodeTransitionRequest(w http.ResponseWriter, r *http.Request) (*TaskTransitionRequest, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	var req TaskTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if req.TaskID == "" {
+		http.Error(w, "task_id is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if req.RuntimeMs < 0 {
+		http.Error(w, "runtime_ms must not be negative", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// writeTransitionError maps lifecycle errors to HTTP responses
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var transitionErr *TransitionError
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case errors.Is(err, ErrNotAssignedToWorker):
+		http.Error(w, "Task is not assigned to this worker", http.StatusConflict)
+	case errors.As(err, &transitionErr):
+		http.Error(w, transitionErr.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update task", http.StatusInternalServerError)
+		log.Printf("Error updating task: %v", err)
+	}
 }
 
 // cancelTaskHandler cancels a task
@@ -129,28 +391,18 @@ func (s *AgentIntelService) cancelTaskHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	pendingCol := s.mongoDB.Collection("pending_tasks")
-
-	// Update task status to cancelled
-	result, err := pendingCol.UpdateOne(
-		ctx,
-		bson.M{"task_id": req.TaskID},
-		bson.M{
-			"$set": bson.M{
-				"status":        StatusCancelled,
-				"cancel_reason": req.Reason,
-			},
-		},
-	)
+	// Update task status to cancelled, finished tasks can no longer be cancelled
+	changed, err := cancelTask(ctx, s.mongoDB, req.TaskID, req.Reason)
 	if err != nil {
-		http.Error(w, "Failed to cancel task", http.StatusInternalServerError)
-		log.Printf("Error cancelling task: %v", err)
+		writeTransitionError(w, err)
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		http.Error(w, "Task not found", http.StatusNotFound)
-		return
+	// Stop the task on the worker running it and in queue-go
+	if changed && s.events != nil {
+		if err := s.events.PublishTaskCancel(req.TaskID, req.Reason); err != nil {
+			log.Printf("Warning: Failed to publish cancellation of task %s: %v", req.TaskID, err)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/nats-io/nats.go"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -109,6 +116,29 @@ func TestGetNextTaskHandler(t *testing.T) {
 		mongoClient: client,
 	}
 
+	t.Run("peek next task without claiming it", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/queue/next?peek=true", nil)
+		w := httptest.NewRecorder()
+
+		service.getNextTaskHandler(w, req)
+
+		var result NextTaskResponse
+		if err := json.NewDecoder(w.Result().Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if result.Task == nil || result.Task.TaskID != "task-high-priority" {
+			t.Fatalf("Task = %+v, want task-high-priority", result.Task)
+		}
+
+		var stored TaskMetrics
+		if err := pendingCol.FindOne(ctx, bson.M{"task_id": "task-high-priority"}).Decode(&stored); err != nil {
+			t.Fatalf("Failed to read task: %v", err)
+		}
+		if stored.Status != StatusPending {
+			t.Errorf("Status = %v, want %v", stored.Status, StatusPending)
+		}
+	})
+
 	t.Run("get next task without repo_id filter", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/api/v1/queue/next", nil)
 		w := httptest.NewRecorder()
@@ -198,6 +228,388 @@ func TestGetNextTaskHandler(t *testing.T) {
 	})
 }
 
+func TestRankTasks(t *testing.T) {
+	tasks := []TaskMetrics{
+		{TaskID: "new", CreatedAt: time.Now(), PendingTasksCount: 10, SizeBytes: 1048576},
+		{TaskID: "old", CreatedAt: time.Now().Add(-96 * time.Hour), LastSuccessAt: time.Now(), SizeBytes: 1024},
+		{TaskID: "medium", CreatedAt: time.Now().Add(-24 * time.Hour)},
+	}
+
+	ranked := rankTasks(tasks)
+
+	if len(ranked) != len(tasks) {
+		t.Fatalf("len(ranked) = %v, want %v", len(ranked), len(tasks))
+	}
+
+	want := []string{"old", "medium", "new"}
+	for i, id := range want {
+		if ranked[i].task.TaskID != id {
+			t.Errorf("ranked[%d] = %v, want %v", i, ranked[i].task.TaskID, id)
+		}
+	}
+
+	for i := 1; i < len(ranked); i++ {
+		if ranked[i].score > ranked[i-1].score {
+			t.Errorf("ranked[%d] score %v > ranked[%d] score %v", i, ranked[i].score, i-1, ranked[i-1].score)
+		}
+	}
+}
+
+// TestPendingTaskFilter tests filtering claimable tasks by repository and worker capabilities
+func TestPendingTaskFilter(t *testing.T) {
+	filter, err := pendingTaskFilter(url.Values{"repo_id": {"/test/repo"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if filter["repository"] != "/test/repo" {
+		t.Errorf("Expected repository filter, got %v", filter)
+	}
+	if _, ok := filter["capabilities"]; ok {
+		t.Errorf("Expected no capability filter without the parameter, got %v", filter)
+	}
+
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{}},
+		{"Go,docker", []string{"docker", "go"}},
+	}
+	for _, tt := range tests {
+		filter, err := pendingTaskFilter(url.Values{"capabilities": {tt.value}})
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", tt.value, err)
+		}
+		want := bson.M{"$not": bson.M{"$elemMatch": bson.M{"$nin": tt.want}}}
+		if !reflect.DeepEqual(filter["capabilities"], want) {
+			t.Errorf("Capabilities %q: expected filter %v, got %v", tt.value, want, filter["capabilities"])
+		}
+	}
+
+	if _, err := pendingTaskFilter(url.Values{"capabilities": {"node.js"}}); err == nil {
+		t.Error("Expected error for an invalid capability")
+	}
+}
+
+func TestGetNextTaskHandlerConcurrentClaims(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Skip("MongoDB not available, skipping test")
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database("agent_intel_test")
+	pendingCol := db.Collection("pending_tasks")
+	defer pendingCol.Drop(ctx)
+
+	const taskCount = 5
+	for i := 0; i < taskCount; i++ {
+		_, err := pendingCol.InsertOne(ctx, &TaskMetrics{
+			TaskID:     fmt.Sprintf("claim-task-%d", i),
+			Repository: "claim-repo",
+			CreatedAt:  time.Now().Add(-time.Duration(i) * time.Hour),
+			Status:     StatusPending,
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert test task: %v", err)
+		}
+	}
+
+	service := &AgentIntelService{
+		mongoDB:     db,
+		mongoClient: client,
+	}
+
+	// Twice as many workers as tasks race for the queue
+	var wg sync.WaitGroup
+	results := make(chan *NextTaskResponse, taskCount*2)
+	for i := 0; i < taskCount*2; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/queue/next?worker_id=worker-%d", worker), nil)
+			w := httptest.NewRecorder()
+			service.getNextTaskHandler(w, req)
+
+			if w.Code == http.StatusOK {
+				var result NextTaskResponse
+				if err := json.NewDecoder(w.Body).Decode(&result); err == nil {
+					results <- &result
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[string]string)
+	for result := range results {
+		if owner, ok := seen[result.Task.TaskID]; ok {
+			t.Errorf("Task %s handed to %s and %s", result.Task.TaskID, owner, result.Task.WorkerID)
+		}
+		seen[result.Task.TaskID] = result.Task.WorkerID
+
+		if result.Task.WorkerID == "" {
+			t.Errorf("Task %s has no worker_id", result.Task.TaskID)
+		}
+	}
+
+	if len(seen) != taskCount {
+		t.Errorf("Claimed tasks = %v, want %v", len(seen), taskCount)
+	}
+}
+
+func TestHeartbeatHandler(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Skip("MongoDB not available, skipping test")
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database("agent_intel_test")
+	pendingCol := db.Collection("pending_tasks")
+	defer pendingCol.Drop(ctx)
+
+	_, err = pendingCol.InsertOne(ctx, &TaskMetrics{
+		TaskID:         "heartbeat-task",
+		Repository:     "test-repo",
+		Status:         StatusAssigned,
+		WorkerID:       "worker-1",
+		AssignedAt:     time.Now(),
+		LeaseExpiresAt: time.Now().Add(time.Second),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert test task: %v", err)
+	}
+
+	service := &AgentIntelService{
+		mongoDB:       db,
+		mongoClient:   client,
+		leaseDuration: time.Minute,
+	}
+
+	tests := []struct {
+		name       string
+		body       HeartbeatRequest
+		wantStatus int
+	}{
+		{"owner extends lease", HeartbeatRequest{TaskID: "heartbeat-task", WorkerID: "worker-1"}, http.StatusOK},
+		{"other worker is rejected", HeartbeatRequest{TaskID: "heartbeat-task", WorkerID: "worker-2"}, http.StatusConflict},
+		{"unknown task", HeartbeatRequest{TaskID: "missing-task", WorkerID: "worker-1"}, http.StatusNotFound},
+		{"missing task_id", HeartbeatRequest{WorkerID: "worker-1"}, http.StatusBadRequest},
+		{"missing worker_id", HeartbeatRequest{TaskID: "heartbeat-task"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/heartbeat", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			service.heartbeatHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	var task TaskMetrics
+	if err := pendingCol.FindOne(ctx, map[string]string{"task_id": "heartbeat-task"}).Decode(&task); err != nil {
+		t.Fatalf("Failed to find task: %v", err)
+	}
+	if time.Until(task.LeaseExpiresAt) < 30*time.Second {
+		t.Errorf("LeaseExpiresAt = %v, want extended by lease duration", task.LeaseExpiresAt)
+	}
+}
+
+func TestTaskTransitionRequestValidation(t *testing.T) {
+	service := &AgentIntelService{}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"wrong method", http.MethodGet, `{"task_id":"task-1"}`, http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, `{invalid`, http.StatusBadRequest},
+		{"missing task_id", http.MethodPost, `{"worker_id":"worker-1"}`, http.StatusBadRequest},
+		{"negative runtime", http.MethodPost, `{"task_id":"task-1","runtime_ms":-5}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/tasks/complete", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			service.completeTaskHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTaskLifecycleHandlers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Skip("MongoDB not available, skipping test")
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database("agent_intel_test")
+	pendingCol := db.Collection("pending_tasks")
+	historyCol := db.Collection("task_history")
+	defer pendingCol.Drop(ctx)
+	defer historyCol.Drop(ctx)
+
+	testTasks := []*TaskMetrics{
+		{TaskID: "lifecycle-ok", Repository: "test-repo", Status: StatusAssigned, WorkerID: "worker-1", AssignedAt: time.Now()},
+		{TaskID: "lifecycle-fail", Repository: "test-repo", Status: StatusAssigned, WorkerID: "worker-1", AssignedAt: time.Now()},
+		{TaskID: "lifecycle-reassigned", Repository: "test-repo", Status: StatusProcessing, WorkerID: "worker-2", AssignedAt: time.Now()},
+		{TaskID: "lifecycle-cancelled", Repository: "test-repo", Status: StatusCancelled},
+		{TaskID: "lifecycle-pending", Repository: "test-repo", Status: StatusPending},
+	}
+	for _, task := range testTasks {
+		if _, err := pendingCol.InsertOne(ctx, task); err != nil {
+			t.Fatalf("Failed to insert test task: %v", err)
+		}
+	}
+
+	service := &AgentIntelService{
+		mongoDB:     db,
+		mongoClient: client,
+	}
+
+	call := func(handler http.HandlerFunc, body TaskTransitionRequest) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/transition", bytes.NewBuffer(data))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	t.Run("start, then complete", func(t *testing.T) {
+		w := call(service.startTaskHandler, TaskTransitionRequest{TaskID: "lifecycle-ok", WorkerID: "worker-1"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("start Status = %v, want %v", w.Code, http.StatusOK)
+		}
+
+		var started TaskMetrics
+		json.NewDecoder(w.Body).Decode(&started)
+		if started.Status != StatusProcessing {
+			t.Errorf("Status = %v, want %v", started.Status, StatusProcessing)
+		}
+
+		w = call(service.completeTaskHandler, TaskTransitionRequest{TaskID: "lifecycle-ok", WorkerID: "worker-1", RuntimeMs: 4200})
+		if w.Code != http.StatusOK {
+			t.Fatalf("complete Status = %v, want %v", w.Code, http.StatusOK)
+		}
+
+		var task TaskMetrics
+		if err := historyCol.FindOne(ctx, map[string]string{"task_id": "lifecycle-ok"}).Decode(&task); err != nil {
+			t.Fatalf("Task not found in history: %v", err)
+		}
+		if task.Status != StatusCompleted || task.PipelineRuntimeMs != 4200 {
+			t.Errorf("History task = %v/%v, want %v/4200", task.Status, task.PipelineRuntimeMs, StatusCompleted)
+		}
+
+		count, _ := pendingCol.CountDocuments(ctx, map[string]string{"task_id": "lifecycle-ok"})
+		if count != 0 {
+			t.Error("Completed task still in pending_tasks")
+		}
+	})
+
+	t.Run("fail records error message", func(t *testing.T) {
+		w := call(service.failTaskHandler, TaskTransitionRequest{TaskID: "lifecycle-fail", RuntimeMs: 100, ErrorMessage: "tests failed"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("fail Status = %v, want %v", w.Code, http.StatusOK)
+		}
+
+		var task TaskMetrics
+		if err := historyCol.FindOne(ctx, map[string]string{"task_id": "lifecycle-fail"}).Decode(&task); err != nil {
+			t.Fatalf("Task not found in history: %v", err)
+		}
+		if task.Status != StatusFailed || task.ErrorMessage != "tests failed" {
+			t.Errorf("History task = %v/%q, want %v/%q", task.Status, task.ErrorMessage, StatusFailed, "tests failed")
+		}
+	})
+
+	t.Run("other worker cannot finish the task", func(t *testing.T) {
+		for _, handler := range []http.HandlerFunc{service.completeTaskHandler, service.failTaskHandler, service.startTaskHandler} {
+			w := call(handler, TaskTransitionRequest{TaskID: "lifecycle-reassigned", WorkerID: "worker-1"})
+			if w.Code != http.StatusConflict {
+				t.Errorf("Status = %v, want %v", w.Code, http.StatusConflict)
+			}
+		}
+
+		var task TaskMetrics
+		if err := pendingCol.FindOne(ctx, map[string]string{"task_id": "lifecycle-reassigned"}).Decode(&task); err != nil {
+			t.Fatalf("Task not found in pending_tasks: %v", err)
+		}
+		if task.Status != StatusProcessing || task.WorkerID != "worker-2" {
+			t.Errorf("Task = %v/%v, want %v/worker-2", task.Status, task.WorkerID, StatusProcessing)
+		}
+	})
+
+	t.Run("stale worker's completion event is ignored", func(t *testing.T) {
+		consumer := &EventConsumer{mongoDB: db, mongoClient: client}
+		data, _ := json.Marshal(PipelineCompletedEvent{TaskID: "lifecycle-reassigned", WorkerID: "worker-1", Status: "success"})
+		consumer.handlePipelineCompleted(&nats.Msg{Data: data})
+
+		var task TaskMetrics
+		if err := pendingCol.FindOne(ctx, map[string]string{"task_id": "lifecycle-reassigned"}).Decode(&task); err != nil {
+			t.Fatalf("Task not found in pending_tasks: %v", err)
+		}
+		if task.Status != StatusProcessing || task.WorkerID != "worker-2" {
+			t.Errorf("Task = %v/%v, want %v/worker-2", task.Status, task.WorkerID, StatusProcessing)
+		}
+
+		if _, err := finishTask(ctx, db, "lifecycle-reassigned", "worker-1", StatusCompleted, 0, "", activeStatuses); !errors.Is(err, ErrNotAssignedToWorker) {
+			t.Errorf("finishTask error = %v, want ErrNotAssignedToWorker", err)
+		}
+	})
+
+	t.Run("illegal transitions are rejected", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			handler    http.HandlerFunc
+			taskID     string
+			wantStatus int
+		}{
+			{"complete cancelled task", service.completeTaskHandler, "lifecycle-cancelled", http.StatusConflict},
+			{"start pending task", service.startTaskHandler, "lifecycle-pending", http.StatusConflict},
+			{"complete finished task", service.completeTaskHandler, "lifecycle-fail", http.StatusConflict},
+			{"fail unknown task", service.failTaskHandler, "lifecycle-missing", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			w := call(tt.handler, TaskTransitionRequest{TaskID: tt.taskID})
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s: Status = %v, want %v", tt.name, w.Code, tt.wantStatus)
+			}
+		}
+	})
+}
+
 func TestCancelTaskHandler(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
@@ -283,6 +695,30 @@ func TestCancelTaskHandler(t *testing.T) {
 		}
 	})
 
+	t.Run("cancel finished task", func(t *testing.T) {
+		historyCol := db.Collection("task_history")
+		defer historyCol.Drop(ctx)
+
+		_, err := historyCol.InsertOne(ctx, &TaskMetrics{
+			TaskID:     "task-finished",
+			Repository: "test-repo",
+			Status:     StatusCompleted,
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert finished task: %v", err)
+		}
+
+		body, _ := json.Marshal(CancelTaskRequest{TaskID: "task-finished", Reason: "Test"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/cancel", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		service.cancelTaskHandler(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("Status = %v, want %v", w.Code, http.StatusConflict)
+		}
+	})
+
 	t.Run("cancel task with invalid request", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/cancel", bytes.NewReader([]byte("invalid json")))
 		req.Header.Set("Content-Type", "application/json")
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// moveTaskToHistory inserts a finished task into task_history, removes it from
+// pending_tasks and refreshes the metrics of the remaining repository tasks
+func moveTaskToHistory(ctx context.Context, db *mongo.Database, task *TaskMetrics) error {
+	pendingCol := db.Collection("pending_tasks")
+	historyCol := db.Collection("task_history")
+
+	if task.CompletedAt.IsZero() {
+		task.CompletedAt = time.Now()
+	}
+
+	_, err := historyCol.InsertOne(ctx, task)
+	if err != nil {
+		// Check for duplicate
+		if mongo.IsDuplicateKeyError(err) {
+			log.Printf("Task %s already in history (race condition)", task.TaskID)
+			// Still remove from pending
+		} else {
+			return fmt.Errorf("failed to insert into history: %w", err)
+		}
+	}
+
+	// Remove from pending
+	_, err = pendingCol.DeleteOne(ctx, bson.M{"task_id": task.TaskID})
+	if err != nil {
+		log.Printf("Warning: Failed to delete task from pending: %v", err)
+	}
+
+	// Update metrics for this repository
+	updateRepositoryMetrics(ctx, db, task.Repository)
+
+	return nil
+}
+
+// updateRepositoryMetrics recalculates metrics for all pending tasks in a repository
+func updateRepositoryMetrics(ctx context.Context, db *mongo.Database, repository string) {
+	pendingCol := db.Collection("pending_tasks")
+	historyCol := db.Collection("task_history")
+
+	// Get pending count for this repo
+	pendingCount, err := pendingCol.CountDocuments(ctx, bson.M{
+		"repository": repository,
+		"status":     bson.M{"$in": activeStatuses},
+	})
+	if err != nil {
+		log.Printf("Error counting pending tasks for %s: %v", repository, err)
+		return
+	}
+
+	// Get last success and average runtime
+	opts := options.FindOne().SetSort(bson.M{"completed_at": -1})
+	var lastTask TaskMetrics
+	err = historyCol.FindOne(ctx, bson.M{
+		"repository": repository,
+		"status":     StatusCompleted,
+	}, opts).Decode(&lastTask)
+
+	lastSuccessAt := time.Time{}
+	if err == nil {
+		lastSuccessAt = lastTask.AssignedAt
+	}
+
+	// Calculate average runtime from last 10 completed tasks
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"repository":          repository,
+			"status":              StatusCompleted,
+			"pipeline_runtime_ms": bson.M{"$gt": 0},
+		}}},
+		{{Key: "$sort", Value: bson.M{"completed_at": -1}}},
+		{{Key: "$limit", Value: 10}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         nil,
+			"avg_runtime": bson.M{"$avg": "$pipeline_runtime_ms"},
+		}}},
+	}
+
+	cursor, err := historyCol.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Error calculating avg runtime for %s: %v", repository, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var avgResult struct {
+		AvgRuntime float64 `bson:"avg_runtime"`
+	}
+	avgRuntime := int64(0)
+	if cursor.Next(ctx) {
+		cursor.Decode(&avgResult)
+		avgRuntime = int64(avgResult.AvgRuntime)
+	}
+
+	// Update all pending tasks for this repository
+	_, err = pendingCol.UpdateMany(
+		ctx,
+		bson.M{"repository": repository, "status": bson.M{"$ne": StatusCancelled}},
+		bson.M{"$set": bson.M{
+			"last_success_at":     lastSuccessAt,
+			"avg_runtime_ms":      avgRuntime,
+			"pending_tasks_count": int(pendingCount),
+		}},
+	)
+	if err != nil {
+		log.Printf("Error updating metrics for %s: %v", repository, err)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"contracts-go/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTaskNotFound is returned when a task is neither pending nor in history
+var ErrTaskNotFound = errors.New("task not found")
+
+// ErrNotAssignedToWorker is returned when a worker changes a task claimed by
+// another worker, e.g. after its lease expired and the task was reassigned
+var ErrNotAssignedToWorker = errors.New("task is not assigned to this worker")
+
+// TransitionError is returned when a task cannot move to the requested status
+type TransitionError struct {
+	TaskID string
+	From   string
+	To     string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("task %s cannot transition from %s to %s", e.TaskID, e.From, e.To)
+}
+
+// Statuses a task may be finished from
+var (
+	// Workers report results for tasks they claimed
+	claimedStatuses = []string{StatusAssigned, StatusProcessing}
+	// Pipeline events may also come from workers consuming tasks.new directly,
+	// which never claim the task in agent-intel-go
+	activeStatuses = model.SourcesOf(StatusCompleted)
+	// Tasks may be cancelled until they finish; cancelling twice is a no-op
+	cancellableStatuses = model.SourcesOf(StatusCancelled)
+)
+
+// startTask moves an assigned task to processing. Restarting a task already
+// processing by the same worker is a no-op.
+func startTask(ctx context.Context, db *mongo.Database, taskID, workerID string) (*TaskMetrics, error) {
+	pendingCol := db.Collection("pending_tasks")
+
+	filter := bson.M{
+		"task_id": taskID,
+		"status":  bson.M{"$in": claimedStatuses},
+	}
+	if workerID != "" {
+		filter["worker_id"] = bson.M{"$in": []interface{}{workerID, "", nil}}
+	}
+
+	var task TaskMetrics
+	err := pendingCol.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": StatusProcessing}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&task)
+	if err == nil {
+		return &task, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	return nil, claimFailure(ctx, db, taskID, workerID, StatusProcessing)
+}
+
+// finishTask moves a task to completed or failed and into task_history. Only
+// tasks in one of the allowed statuses are finished, and only by their worker
+// when workerID is set; tasks no worker claimed (stream mode) can be finished by
+// any worker. Retries of a finish that already marked the task are completed
+// idempotently.
+func finishTask(ctx context.Context, db *mongo.Database, taskID, workerID, status string, runtimeMs int64, errorMessage string, allowed []string) (*TaskMetrics, error) {
+	pendingCol := db.Collection("pending_tasks")
+
+	update := bson.M{
+		"status":              status,
+		"pipeline_runtime_ms": runtimeMs,
+		"completed_at":        time.Now(),
+	}
+	if status == StatusFailed {
+		update["error_message"] = errorMessage
+	}
+
+	filter := bson.M{
+		"task_id": taskID,
+		"status":  bson.M{"$in": append([]string{status}, allowed...)},
+	}
+	if workerID != "" {
+		filter["worker_id"] = workerID
+	}
+
+	var task TaskMetrics
+	err := pendingCol.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&task)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		return nil, claimFailure(ctx, db, taskID, workerID, status)
+	}
+
+	if err := moveTaskToHistory(ctx, db, &task); err != nil {
+		return nil, err
+	}
+
+	return &task, nil
+}
+
+// cancelTask moves a task that hasn't finished to cancelled. Cancelling a
+// cancelled task again is a no-op; changed reports whether this call cancelled it.
+func cancelTask(ctx context.Context, db *mongo.Database, taskID, reason string) (changed bool, err error) {
+	result, err := db.Collection("pending_tasks").UpdateOne(ctx,
+		bson.M{"task_id": taskID, "status": bson.M{"$in": cancellableStatuses}},
+		bson.M{"$set": bson.M{
+			"status":        StatusCancelled,
+			"cancel_reason": reason,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+
+	err = transitionFailure(ctx, db, taskID, StatusCancelled)
+	var transitionErr *TransitionError
+	if errors.As(err, &transitionErr) && transitionErr.From == StatusCancelled {
+		return false, nil
+	}
+	return false, err
+}
+
+// claimFailure explains why a transition of a worker's task matched no task,
+// reporting tasks claimed by another worker as ErrNotAssignedToWorker
+func claimFailure(ctx context.Context, db *mongo.Database, taskID, workerID, to string) error {
+	if workerID != "" {
+		var task TaskMetrics
+		err := db.Collection("pending_tasks").FindOne(ctx, bson.M{
+			"task_id":   taskID,
+			"status":    bson.M{"$in": claimedStatuses},
+			"worker_id": bson.M{"$ne": workerID},
+		}).Decode(&task)
+		if err == nil {
+			return ErrNotAssignedToWorker
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	return transitionFailure(ctx, db, taskID, to)
+}
+
+// transitionFailure explains why a conditional transition matched no task
+func transitionFailure(ctx context.Context, db *mongo.Database, taskID, to string) error {
+	var task TaskMetrics
+	err := db.Collection("pending_tasks").FindOne(ctx, bson.M{"task_id": taskID}).Decode(&task)
+	if err == nil {
+		return &TransitionError{TaskID: taskID, From: task.Status, To: to}
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	err = db.Collection("task_history").FindOne(ctx, bson.M{"task_id": taskID}).Decode(&task)
+	if err == nil {
+		return &TransitionError{TaskID: taskID, From: task.Status, To: to}
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	return ErrTaskNotFound
+}
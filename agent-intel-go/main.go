@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -19,12 +20,16 @@ func main() {
 	mongoURL := getEnv("MONGO_URL", "mongodb://localhost:27017")
 	natsURL := getEnv("NATS_URL", "nats://localhost:4222")
 	dbName := getEnv("DB_NAME", "agent_intel")
+	leaseDuration := getEnvDuration("LEASE_DURATION", defaultLeaseDuration)
+	reaperInterval := getEnvDuration("REAPER_INTERVAL", defaultReaperInterval)
+	maxAttempts := getEnvInt("MAX_ATTEMPTS", defaultMaxAttempts)
 
 	log.Println("Agent Intel Service starting...")
 	log.Printf("Port: %s", port)
 	log.Printf("MongoDB URL: %s", mongoURL)
 	log.Printf("NATS URL: %s", natsURL)
 	log.Printf("Database: %s", dbName)
+	log.Printf("Lease duration: %v (max attempts: %d)", leaseDuration, maxAttempts)
 
 	// Connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -51,9 +56,10 @@ func main() {
 
 	// Create service instance
 	service := &AgentIntelService{
-		mongoDB:     db,
-		mongoClient: mongoClient,
-		natsURL:     natsURL,
+		mongoDB:       db,
+		mongoClient:   mongoClient,
+		natsURL:       natsURL,
+		leaseDuration: leaseDuration,
 	}
 
 	// Start NATS event consumer
@@ -62,12 +68,21 @@ func main() {
 		log.Fatalf("Failed to create event consumer: %v", err)
 	}
 	defer consumer.Close()
+	service.events = consumer
 
 	if err := consumer.Start(); err != nil {
 		log.Fatalf("Failed to start event consumer: %v", err)
 	}
 	log.Println("Event consumer started")
 
+	// Start lease reaper for assignments of dead workers
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+
+	reaper := NewLeaseReaper(db, leaseDuration, maxAttempts, reaperInterval)
+	go reaper.Start(reaperCtx)
+	log.Printf("Lease reaper started (interval: %v)", reaperInterval)
+
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 
@@ -80,6 +95,10 @@ func main() {
 
 	// Task management
 	mux.HandleFunc("/api/v1/tasks/cancel", service.cancelTaskHandler)
+	mux.HandleFunc("/api/v1/tasks/heartbeat", service.heartbeatHandler)
+	mux.HandleFunc("/api/v1/tasks/start", service.startTaskHandler)
+	mux.HandleFunc("/api/v1/tasks/complete", service.completeTaskHandler)
+	mux.HandleFunc("/api/v1/tasks/fail", service.failTaskHandler)
 
 	// Metrics
 	mux.HandleFunc("/api/v1/metrics", service.metricsHandler)
@@ -107,6 +126,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopReaper()
 
 	// Graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -188,3 +208,31 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvDuration gets a duration environment variable or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: Invalid %s %q, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: Invalid %s %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
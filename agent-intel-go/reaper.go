@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LeaseReaper returns tasks with expired assignment leases to the pending queue
+type LeaseReaper struct {
+	mongoDB       *mongo.Database
+	leaseDuration time.Duration
+	maxAttempts   int
+	interval      time.Duration
+}
+
+// NewLeaseReaper creates a new lease reaper
+func NewLeaseReaper(mongoDB *mongo.Database, leaseDuration time.Duration, maxAttempts int, interval time.Duration) *LeaseReaper {
+	return &LeaseReaper{
+		mongoDB:       mongoDB,
+		leaseDuration: leaseDuration,
+		maxAttempts:   maxAttempts,
+		interval:      interval,
+	}
+}
+
+// Start runs the reaper until the context is cancelled
+func (lr *LeaseReaper) Start(ctx context.Context) {
+	ticker := time.NewTicker(lr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reapCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			requeued, failed, err := lr.ReapExpired(reapCtx)
+			cancel()
+			if err != nil {
+				log.Printf("Error reaping expired leases: %v", err)
+				continue
+			}
+			if requeued > 0 || failed > 0 {
+				log.Printf("Lease reaper: %d tasks returned to pending, %d tasks failed", requeued, failed)
+			}
+		}
+	}
+}
+
+// ReapExpired handles every assignment whose lease has expired. Tasks are
+// returned to pending with an incremented attempt counter, or failed once
+// they reach the maximum number of attempts.
+func (lr *LeaseReaper) ReapExpired(ctx context.Context) (requeued int, failed int, err error) {
+	pendingCol := lr.mongoDB.Collection("pending_tasks")
+	now := time.Now()
+
+	leaseExpired := []bson.M{
+		{"lease_expires_at": bson.M{"$lt": now}},
+		// Assignments made before leases existed
+		{"lease_expires_at": bson.M{"$exists": false}, "assigned_at": bson.M{"$lt": now.Add(-lr.leaseDuration)}},
+	}
+
+	cursor, err := pendingCol.Find(ctx, bson.M{
+		"status": bson.M{"$in": []string{StatusAssigned, StatusProcessing}},
+		"$or":    leaseExpired,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find expired leases: %w", err)
+	}
+
+	var expired []TaskMetrics
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode expired leases: %w", err)
+	}
+
+	for i := range expired {
+		task := &expired[i]
+		attempts := task.Attempts + 1
+
+		if attempts >= lr.maxAttempts {
+			// Only fail the task if it is still expired (no heartbeat arrived meanwhile)
+			var failedTask TaskMetrics
+			err := pendingCol.FindOneAndUpdate(ctx,
+				bson.M{"task_id": task.TaskID, "status": task.Status, "$or": leaseExpired},
+				bson.M{"$set": bson.M{
+					"status":        StatusFailed,
+					"attempts":      attempts,
+					"error_message": fmt.Sprintf("assignment lease expired after %d attempts (last worker: %s)", attempts, task.WorkerID),
+					"completed_at":  now,
+				}},
+				options.FindOneAndUpdate().SetReturnDocument(options.After),
+			).Decode(&failedTask)
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if err != nil {
+				log.Printf("Error failing task %s: %v", task.TaskID, err)
+				continue
+			}
+
+			if err := moveTaskToHistory(ctx, lr.mongoDB, &failedTask); err != nil {
+				log.Printf("Error failing task %s: %v", task.TaskID, err)
+				continue
+			}
+
+			log.Printf("Task %s failed after %d expired leases", task.TaskID, attempts)
+			failed++
+			continue
+		}
+
+		// Only requeue if the lease is unchanged (no heartbeat arrived meanwhile)
+		filter := bson.M{"task_id": task.TaskID, "status": task.Status}
+		if task.LeaseExpiresAt.IsZero() {
+			filter["lease_expires_at"] = bson.M{"$exists": false}
+		} else {
+			filter["lease_expires_at"] = task.LeaseExpiresAt
+		}
+
+		result, err := pendingCol.UpdateOne(ctx, filter, bson.M{
+			"$set":   bson.M{"status": StatusPending},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"assigned_at": "", "worker_id": "", "lease_expires_at": ""},
+		})
+		if err != nil {
+			log.Printf("Error requeueing task %s: %v", task.TaskID, err)
+			continue
+		}
+
+		if result.ModifiedCount > 0 {
+			log.Printf("Task %s lease expired (worker %s), returned to pending (attempt %d/%d)", task.TaskID, task.WorkerID, attempts, lr.maxAttempts)
+			requeued++
+		}
+	}
+
+	return requeued, failed, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestLeaseReaper(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Skip("MongoDB not available, skipping test")
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database("agent_intel_test")
+	pendingCol := db.Collection("pending_tasks")
+	historyCol := db.Collection("task_history")
+	defer pendingCol.Drop(ctx)
+	defer historyCol.Drop(ctx)
+
+	now := time.Now()
+	tasks := []*TaskMetrics{
+		{
+			TaskID:         "lease-expired",
+			Repository:     "lease-repo",
+			Status:         StatusAssigned,
+			WorkerID:       "dead-worker",
+			AssignedAt:     now.Add(-10 * time.Minute),
+			LeaseExpiresAt: now.Add(-time.Minute),
+		},
+		{
+			TaskID:         "lease-exhausted",
+			Repository:     "lease-repo",
+			Status:         StatusProcessing,
+			WorkerID:       "dead-worker",
+			AssignedAt:     now.Add(-10 * time.Minute),
+			LeaseExpiresAt: now.Add(-time.Minute),
+			Attempts:       2,
+		},
+		{
+			TaskID:         "lease-active",
+			Repository:     "lease-repo",
+			Status:         StatusAssigned,
+			WorkerID:       "live-worker",
+			AssignedAt:     now,
+			LeaseExpiresAt: now.Add(5 * time.Minute),
+		},
+	}
+	for _, task := range tasks {
+		if _, err := pendingCol.InsertOne(ctx, task); err != nil {
+			t.Fatalf("Failed to insert test task: %v", err)
+		}
+	}
+
+	reaper := NewLeaseReaper(db, 5*time.Minute, 3, time.Minute)
+	requeued, failed, err := reaper.ReapExpired(ctx)
+	if err != nil {
+		t.Fatalf("ReapExpired failed: %v", err)
+	}
+
+	if requeued != 1 {
+		t.Errorf("requeued = %v, want 1", requeued)
+	}
+	if failed != 1 {
+		t.Errorf("failed = %v, want 1", failed)
+	}
+
+	t.Run("expired lease returns to pending", func(t *testing.T) {
+		var task TaskMetrics
+		if err := pendingCol.FindOne(ctx, bson.M{"task_id": "lease-expired"}).Decode(&task); err != nil {
+			t.Fatalf("Failed to find task: %v", err)
+		}
+		if task.Status != StatusPending {
+			t.Errorf("Status = %v, want %v", task.Status, StatusPending)
+		}
+		if task.Attempts != 1 {
+			t.Errorf("Attempts = %v, want 1", task.Attempts)
+		}
+		if task.WorkerID != "" {
+			t.Errorf("WorkerID = %v, want empty", task.WorkerID)
+		}
+	})
+
+	t.Run("exhausted task moves to history as failed", func(t *testing.T) {
+		var task TaskMetrics
+		if err := historyCol.FindOne(ctx, bson.M{"task_id": "lease-exhausted"}).Decode(&task); err != nil {
+			t.Fatalf("Failed to find task in history: %v", err)
+		}
+		if task.Status != StatusFailed {
+			t.Errorf("Status = %v, want %v", task.Status, StatusFailed)
+		}
+		if task.ErrorMessage == "" {
+			t.Error("Expected error message for failed task")
+		}
+	})
+
+	t.Run("active lease is untouched", func(t *testing.T) {
+		var task TaskMetrics
+		if err := pendingCol.FindOne(ctx, bson.M{"task_id": "lease-active"}).Decode(&task); err != nil {
+			t.Fatalf("Failed to find task: %v", err)
+		}
+		if task.Status != StatusAssigned {
+			t.Errorf("Status = %v, want %v", task.Status, StatusAssigned)
+		}
+	})
+}
@@ -1,15 +1,20 @@
 package main
 
-import "time"
+import (
+	"time"
 
-// Task status constants
+	"contracts-go/events"
+	"contracts-go/model"
+)
+
+// Task status constants (see contracts-go/model for the state machine)
 const (
-	StatusPending    = "pending"
-	StatusAssigned   = "assigned"
-	StatusProcessing = "processing"
-	StatusCompleted  = "completed"
-	StatusFailed     = "failed"
-	StatusCancelled  = "cancelled"
+	StatusPending    = model.StatusPending
+	StatusAssigned   = model.StatusAssigned
+	StatusProcessing = model.StatusProcessing
+	StatusCompleted  = model.StatusCompleted
+	StatusFailed     = model.StatusFailed
+	StatusCancelled  = model.StatusCancelled
 )
 
 // Score weights (must sum to 1.0)
@@ -32,6 +37,13 @@ const (
 	defaultSizeBytes = 51200   // Default 50KB if unknown
 )
 
+// Assignment lease defaults
+const (
+	defaultLeaseDuration  = 5 * time.Minute  // How long an assignment lives without a heartbeat
+	defaultMaxAttempts    = 3                // Assignments before an expired task is failed
+	defaultReaperInterval = 30 * time.Second // How often expired leases are checked
+)
+
 // TaskMetrics represents a task with all metrics for prioritization
 type TaskMetrics struct {
 	TaskID            string    `json:"task_id" bson:"task_id"`
@@ -45,30 +57,21 @@ type TaskMetrics struct {
 	SizeBytes         int64     `json:"size_bytes" bson:"size_bytes"`
 	PipelineRuntimeMs int64     `json:"pipeline_runtime_ms,omitempty" bson:"pipeline_runtime_ms,omitempty"`
 	AssignedAt        time.Time `json:"assigned_at,omitempty" bson:"assigned_at,omitempty"`
+	CompletedAt       time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	WorkerID          string    `json:"worker_id,omitempty" bson:"worker_id,omitempty"`
+	LeaseExpiresAt    time.Time `json:"lease_expires_at,omitempty" bson:"lease_expires_at,omitempty"`
+	Attempts          int       `json:"attempts" bson:"attempts"`
 	Status            string    `json:"status" bson:"status"`
 	ErrorMessage      string    `json:"error_message,omitempty" bson:"error_message,omitempty"`
 	CancelReason      string    `json:"cancel_reason,omitempty" bson:"cancel_reason,omitempty"`
+	Capabilities      []string  `json:"capabilities,omitempty" bson:"capabilities,omitempty"` // Required worker capabilities
 }
 
-// TaskNewEvent represents the event when a new task is created
-type TaskNewEvent struct {
-	TaskID       string    `json:"task_id"`
-	IssueID      string    `json:"issue_id"`
-	Repository   string    `json:"repository"`
-	TaskFilePath string    `json:"task_file_path"`
-	SizeBytes    int64     `json:"size_bytes"`
-	CreatedAt    time.Time `json:"created_at"`
-}
-
-// PipelineCompletedEvent represents the event when a pipeline completes
-type PipelineCompletedEvent struct {
-	TaskID            string    `json:"task_id"`
-	Repository        string    `json:"repository"`
-	PipelineRuntimeMs int64     `json:"pipeline_runtime_ms"`
-	Status            string    `json:"status"` // "success" or "failure"
-	CompletedAt       time.Time `json:"completed_at"`
-	ErrorMessage      string    `json:"error_message,omitempty"`
-}
+// Event payloads are defined in contracts-go/events
+type (
+	TaskNewEvent           = events.TaskNewEvent
+	PipelineCompletedEvent = events.PipelineCompletedEvent
+)
 
 // NextTaskResponse represents the response for the next task endpoint
 type NextTaskResponse struct {
@@ -82,6 +85,26 @@ type CancelTaskRequest struct {
 	Reason string `json:"reason"`
 }
 
+// HeartbeatRequest represents a worker heartbeat extending a task lease
+type HeartbeatRequest struct {
+	TaskID   string `json:"task_id"`
+	WorkerID string `json:"worker_id"`
+}
+
+// HeartbeatResponse represents the extended lease of a task
+type HeartbeatResponse struct {
+	TaskID         string    `json:"task_id"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// TaskTransitionRequest represents a worker request to start, complete or fail a task
+type TaskTransitionRequest struct {
+	TaskID       string `json:"task_id"`
+	WorkerID     string `json:"worker_id,omitempty"`
+	RuntimeMs    int64  `json:"runtime_ms,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
 // MetricsResponse represents system metrics
 type MetricsResponse struct {
 	TotalPending    int64  `json:"total_pending"`
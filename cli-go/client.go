@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/model"
+	"contracts-go/repos"
+)
+
+// requestTimeout bounds every API call except log streams
+const requestTimeout = 10 * time.Second
+
+// Task, Repository and LogChunk are defined in contracts-go
+type (
+	Task       = model.Task
+	Repository = repos.Repository
+	LogChunk   = events.LogChunk
+)
+
+// QueueStatus is the response of queue-go's GET /api/queue/status
+type QueueStatus struct {
+	TotalTasks      int   `json:"total_tasks"`
+	PendingTasks    int   `json:"pending_tasks"`
+	AssignedTasks   int   `json:"assigned_tasks"`
+	ProcessingTasks int   `json:"processing_tasks"`
+	CompletedTasks  int   `json:"completed_tasks"`
+	FailedTasks     int   `json:"failed_tasks"`
+	CancelledTasks  int   `json:"cancelled_tasks"`
+	CurrentTask     *Task `json:"current_task,omitempty"`
+}
+
+// NextTask is the response of agent-intel-go's GET /api/v1/queue/next
+type NextTask struct {
+	Task *struct {
+		TaskID     string `json:"task_id"`
+		IssueID    string `json:"issue_id"`
+		Repository string `json:"repository"`
+		Attempts   int    `json:"attempts"`
+	} `json:"task,omitempty"`
+	Score float64 `json:"score,omitempty"`
+}
+
+// AddRepositoryRequest is the body of queue-go's POST /api/repositories
+type AddRepositoryRequest struct {
+	Path          string `json:"path"`
+	GitHubEnabled bool   `json:"github_enabled"`
+	MaxIterations *int   `json:"max_iterations,omitempty"`
+}
+
+// APIError is returned when a service answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error returns the message of the service, or the status when it sent none
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return e.Message
+}
+
+// isNotFound reports whether err is a 404 answer
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client talks to the queue-go and agent-intel-go HTTP APIs
+type Client struct {
+	queueURL string
+	intelURL string
+	http     *http.Client
+}
+
+// NewClient creates a client of the services at the given base URLs
+func NewClient(queueURL, intelURL string) *Client {
+	return &Client{
+		queueURL: strings.TrimRight(queueURL, "/"),
+		intelURL: strings.TrimRight(intelURL, "/"),
+		http:     &http.Client{},
+	}
+}
+
+// ListRepositories returns the registered repositories
+func (c *Client) ListRepositories(ctx context.Context) ([]Repository, error) {
+	var list []Repository
+	err := c.do(ctx, http.MethodGet, c.queueURL+"/api/repositories", nil, &list)
+	return list, err
+}
+
+// AddRepository registers a repository
+func (c *Client) AddRepository(ctx context.Context, req *AddRepositoryRequest) (*Repository, error) {
+	var repo Repository
+	if err := c.do(ctx, http.MethodPost, c.queueURL+"/api/repositories", req, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// RemoveRepository unregisters a repository by ID
+func (c *Client) RemoveRepository(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.queueURL+"/api/repositories/"+url.PathEscape(id), nil, nil)
+}
+
+// QueueStatus returns the task counts of queue-go
+func (c *Client) QueueStatus(ctx context.Context) (*QueueStatus, error) {
+	var status QueueStatus
+	if err := c.do(ctx, http.MethodGet, c.queueURL+"/api/queue/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListTasks returns every task known to queue-go
+func (c *Client) ListTasks(ctx context.Context) ([]Task, error) {
+	var tasks []Task
+	err := c.do(ctx, http.MethodGet, c.queueURL+"/api/tasks", nil, &tasks)
+	return tasks, err
+}
+
+// GetTask returns a task by ID
+func (c *Client) GetTask(ctx context.Context, id string) (*Task, error) {
+	var task Task
+	if err := c.do(ctx, http.MethodGet, c.queueURL+"/api/tasks/"+url.PathEscape(id), nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// CancelTask cancels a task, stopping it on the worker running it
+func (c *Client) CancelTask(ctx context.Context, id string) (*Task, error) {
+	var task Task
+	body := map[string]string{"status": model.StatusCancelled}
+	if err := c.do(ctx, http.MethodPatch, c.queueURL+"/api/tasks/"+url.PathEscape(id)+"/status", body, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// PeekNextTask returns the task agent-intel-go would hand out next, without
+// claiming it. It returns nil when no task is pending.
+func (c *Client) PeekNextTask(ctx context.Context) (*NextTask, error) {
+	var next NextTask
+	err := c.do(ctx, http.MethodGet, c.intelURL+"/api/v1/queue/next?peek=true", nil, &next)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// TaskLog returns the pipeline output of a task
+func (c *Client) TaskLog(ctx context.Context, id string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	resp, err := c.send(ctx, http.MethodGet, c.queueURL+"/api/tasks/"+url.PathEscape(id)+"/logs", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(resp.Body)
+	return string(output), err
+}
+
+// StreamTaskLog follows the pipeline output of a task until its run finished
+// or ctx is cancelled, calling fn with every chunk. The final chunk carries the
+// exit code.
+func (c *Client) StreamTaskLog(ctx context.Context, id string, fn func(*LogChunk)) error {
+	resp, err := c.send(ctx, http.MethodGet, c.queueURL+"/api/tasks/"+url.PathEscape(id)+"/logs/stream", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = readSSE(resp.Body, func(event string, data []byte) error {
+		var chunk LogChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("invalid %s event: %w", event, err)
+		}
+		if event == "end" {
+			chunk.Final = true
+		}
+		fn(&chunk)
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// readSSE calls fn with the name and data of every Server-Sent Event in r
+func readSSE(r io.Reader, fn func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	event, data := "message", []byte(nil)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != nil {
+				if err := fn(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "message", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	return scanner.Err()
+}
+
+// do sends a JSON request and decodes the JSON response into out, if not nil
+func (c *Client) do(ctx context.Context, method, target string, body, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	resp, err := c.send(ctx, method, target, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", target, err)
+	}
+	return nil
+}
+
+// send sends a request, turning error statuses into an APIError
+func (c *Client) send(ctx context.Context, method, target string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: apiErrorMessage(message)}
+	}
+	return resp, nil
+}
+
+// apiErrorMessage extracts the message of an error response: plain text from
+// http.Error, or the "error" field of a JSON body
+func apiErrorMessage(body []byte) string {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != "" {
+		return payload.Error
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestReadSSE tests parsing Server-Sent Events
+func TestReadSSE(t *testing.T) {
+	stream := ": comment\nevent: log\ndata: {\"a\":1}\n\ndata: line 1\ndata: line 2\n\nevent: end\ndata: {}\n\n"
+
+	var got []string
+	err := readSSE(strings.NewReader(stream), func(event string, data []byte) error {
+		got = append(got, event+"="+string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`log={"a":1}`, "message=line 1\nline 2", "end={}"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+// TestAPIErrorMessage tests extracting messages from error responses
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"Repository already registered\n", "Repository already registered"},
+		{`{"error":"no tasks available"}`, "no tasks available"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := apiErrorMessage([]byte(tt.body)); got != tt.want {
+			t.Errorf("apiErrorMessage(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	if got := (&APIError{StatusCode: 503}).Error(); got != "Service Unavailable" {
+		t.Errorf("Expected the status text, got %q", got)
+	}
+}
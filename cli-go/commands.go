@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"contracts-go/model"
+	"contracts-go/repos"
+)
+
+// errExit is returned by the exit command to leave the REPL
+var errExit = errors.New("exit")
+
+// errUsage is returned when a command is called with invalid arguments
+var errUsage = errors.New("invalid arguments")
+
+// command is a command of the CLI, available in one-shot and REPL mode
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(ctx context.Context, cli *CLI, args []string) error
+}
+
+// commands lists the commands in the order help shows them
+var commands []command
+
+func init() {
+	commands = []command{
+		{"add-repo", "add-repo [path] [--github] [--max-iterations N]", "Register a git repository (default: current directory) and watch its docs/task files", runAddRepo},
+		{"rm-repo", "rm-repo [path]", "Unregister a repository (default: current directory); its files are kept", runRemoveRepo},
+		{"list", "list", "List registered repositories and their settings", runList},
+		{"status", "status", "Show the task counts and the issues being worked on", runStatus},
+		{"next", "next", "Show the task agent-intel-go hands out next", runNext},
+		{"cancel", "cancel <task-id>", "Cancel a task, stopping its pipeline", runCancel},
+		{"logs", "logs <task-id> [-f]", "Print the pipeline output of a task, -f follows it live", runLogs},
+		{"help", "help", "Show this help", runHelp},
+		{"exit", "exit", "Leave agent666, optionally stopping the pipelines in progress", runExit},
+	}
+}
+
+// findCommand returns the command with the given name, or nil
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// CLI runs commands against the queue services
+type CLI struct {
+	client      *Client
+	in          *bufio.Reader // Commands in REPL mode and answers to prompts
+	interactive bool          // Whether missing options are asked for
+
+	mu        sync.Mutex // Serializes output of commands and live messages
+	out       io.Writer
+	prompting bool // The REPL is waiting for a command
+
+	issues     map[string]string // Issue ID of each task seen in status updates
+	lastStatus map[string]string // Last status printed for each task
+}
+
+// NewCLI creates a CLI reading from in and writing to out. Options missing
+// from commands are asked for when interactive is set.
+func NewCLI(client *Client, in io.Reader, out io.Writer, interactive bool) *CLI {
+	return &CLI{
+		client:      client,
+		in:          bufio.NewReader(in),
+		out:         out,
+		interactive: interactive,
+		issues:      make(map[string]string),
+		lastStatus:  make(map[string]string),
+	}
+}
+
+// printf writes command output
+func (cli *CLI) printf(format string, args ...interface{}) {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	fmt.Fprintf(cli.out, format, args...)
+}
+
+// Run runs one command line and returns its error. errExit is returned by exit.
+func (cli *CLI) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q, type help for the list of commands", args[0])
+	}
+
+	err := cmd.run(ctx, cli, args[1:])
+	if errors.Is(err, errUsage) {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	return err
+}
+
+// prompt asks a question and returns the trimmed answer, or def when the
+// answer is empty or input ended
+func (cli *CLI) prompt(question, def string) string {
+	cli.printf("%s ", question)
+	line, err := cli.in.ReadString('\n')
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	if err != nil {
+		cli.printf("\n")
+	}
+	return def
+}
+
+// confirm asks a yes/no question, defaulting to no
+func (cli *CLI) confirm(question string) bool {
+	switch strings.ToLower(cli.prompt(question+" (y/N)", "n")) {
+	case "y", "yes", "s", "si", "sí":
+		return true
+	}
+	return false
+}
+
+// parseArgs parses flags placed before or after positional arguments and
+// returns the positional ones
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// repositoryPath returns the absolute path of the repository argument, the
+// current directory when it is missing
+func repositoryPath(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return os.Getwd()
+	case 1:
+		return filepath.Abs(args[0])
+	}
+	return "", errUsage
+}
+
+// runAddRepo registers a repository, asking for the settings that were not
+// passed as flags in interactive mode
+func runAddRepo(ctx context.Context, cli *CLI, args []string) error {
+	fs := flag.NewFlagSet("add-repo", flag.ContinueOnError)
+	github := fs.Bool("github", false, "")
+	maxIterations := fs.Int("max-iterations", 0, "")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	path, err := repositoryPath(positional)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	req := &AddRepositoryRequest{Path: path, GitHubEnabled: *github}
+	if set["max-iterations"] {
+		req.MaxIterations = maxIterations
+	}
+
+	if cli.interactive {
+		if !set["github"] {
+			req.GitHubEnabled = cli.confirm("GitHub enabled?")
+		}
+		if !set["max-iterations"] {
+			answer := cli.prompt(fmt.Sprintf("Max iterations? [%d]", repos.DefaultMaxIterations), "")
+			if answer != "" {
+				n, err := strconv.Atoi(answer)
+				if err != nil {
+					return fmt.Errorf("invalid max iterations %q", answer)
+				}
+				req.MaxIterations = &n
+			}
+		}
+	}
+
+	repo, err := cli.client.AddRepository(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", path, err)
+	}
+
+	cli.printf("Added %s (GitHub %s, max %d iterations), watching %s\n", repo.Path, enabled(repo.GitHubEnabled), repo.MaxIterations, filepath.Join(repo.Path, "docs", "task"))
+	return nil
+}
+
+// runRemoveRepo unregisters a repository
+func runRemoveRepo(ctx context.Context, cli *CLI, args []string) error {
+	path, err := repositoryPath(args)
+	if err != nil {
+		return err
+	}
+
+	err = cli.client.RemoveRepository(ctx, repos.ID(path))
+	if isNotFound(err) {
+		return fmt.Errorf("%s is not registered", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+
+	cli.printf("Removed %s\n", path)
+	return nil
+}
+
+// runList prints the registered repositories
+func runList(ctx context.Context, cli *CLI, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	list, err := cli.client.ListRepositories(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list repositories: %w", err)
+	}
+	if len(list) == 0 {
+		cli.printf("No repositories registered, add one with add-repo [path]\n")
+		return nil
+	}
+
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	tw := tabwriter.NewWriter(cli.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tGITHUB\tMAX ITERATIONS\tSTATE")
+	for _, repo := range list {
+		state := "active"
+		if repo.Paused {
+			state = "paused"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", repo.Path, enabled(repo.GitHubEnabled), repo.MaxIterations, state)
+	}
+	return tw.Flush()
+}
+
+// runStatus prints the task counts and the tasks being worked on
+func runStatus(ctx context.Context, cli *CLI, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	status, err := cli.client.QueueStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get queue status: %w", err)
+	}
+	tasks, err := cli.client.ListTasks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	cli.printf("Tasks: %d pending, %d assigned, %d processing, %d completed, %d failed, %d cancelled\n",
+		status.PendingTasks, status.AssignedTasks, status.ProcessingTasks, status.CompletedTasks, status.FailedTasks, status.CancelledTasks)
+
+	active := activeTasks(tasks)
+	if len(active) == 0 {
+		cli.printf("Idle, no issue in progress\n")
+		return nil
+	}
+	for _, task := range active {
+		cli.printf("%s in %s (task %s, %s)\n", statusMessage(task.IssueID, task.Status, ""), task.Repository, task.ID, task.Status)
+	}
+	cli.printf("Follow a pipeline with logs <task-id> -f\n")
+	return nil
+}
+
+// runNext prints the task agent-intel-go would hand out next
+func runNext(ctx context.Context, cli *CLI, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	next, err := cli.client.PeekNextTask(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the next task: %w", err)
+	}
+	if next == nil || next.Task == nil {
+		cli.printf("No tasks pending\n")
+		return nil
+	}
+
+	cli.printf("Next: issue #%s in %s (task %s, score %.2f, %d attempts)\n",
+		next.Task.IssueID, next.Task.Repository, next.Task.TaskID, next.Score, next.Task.Attempts)
+	return nil
+}
+
+// runCancel cancels a task
+func runCancel(ctx context.Context, cli *CLI, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	task, err := cli.client.CancelTask(ctx, args[0])
+	if isNotFound(err) {
+		return fmt.Errorf("task %s not found", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel task %s: %w", args[0], err)
+	}
+
+	cli.printf("Cancelled task %s (issue #%s)\n", task.ID, task.IssueID)
+	return nil
+}
+
+// runLogs prints the pipeline output of a task, following it with -f
+func runLogs(ctx context.Context, cli *CLI, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "")
+	fs.BoolVar(follow, "follow", false, "")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	taskID := positional[0]
+
+	if !*follow {
+		output, err := cli.client.TaskLog(ctx, taskID)
+		if isNotFound(err) {
+			return fmt.Errorf("no log for task %s yet", taskID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get log of task %s: %w", taskID, err)
+		}
+		cli.printf("%s", output)
+		return nil
+	}
+
+	err = cli.client.StreamTaskLog(ctx, taskID, func(chunk *LogChunk) {
+		if !chunk.Final {
+			cli.printf("%s", chunk.Data)
+			return
+		}
+		if chunk.Data != "" {
+			cli.printf("%s", chunk.Data)
+		}
+		switch {
+		case chunk.Error != "":
+			cli.printf("\nPipeline failed: %s\n", chunk.Error)
+		case chunk.ExitCode != 0:
+			cli.printf("\nPipeline failed with exit code %d\n", chunk.ExitCode)
+		default:
+			cli.printf("\nPipeline finished\n")
+		}
+	})
+	if isNotFound(err) {
+		return fmt.Errorf("task %s not found", taskID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to follow log of task %s: %w", taskID, err)
+	}
+	return nil
+}
+
+// runHelp prints the commands
+func runHelp(ctx context.Context, cli *CLI, args []string) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	tw := tabwriter.NewWriter(cli.out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usage, cmd.help)
+	}
+	return tw.Flush()
+}
+
+// runExit leaves the REPL. In interactive mode it offers to cancel the tasks
+// in progress first.
+func runExit(ctx context.Context, cli *CLI, args []string) error {
+	if !cli.interactive {
+		return errExit
+	}
+
+	tasks, err := cli.client.ListTasks(ctx)
+	if err != nil {
+		// Leaving must not depend on the queue being reachable
+		return errExit
+	}
+	for _, task := range activeTasks(tasks) {
+		if task.Status != model.StatusProcessing {
+			continue
+		}
+		if cli.confirm(fmt.Sprintf("Stop the pipeline of issue #%s in %s?", task.IssueID, task.Repository)) {
+			if _, err := cli.client.CancelTask(ctx, task.ID); err != nil {
+				cli.printf("Failed to cancel task %s: %v\n", task.ID, err)
+			}
+		}
+	}
+	return errExit
+}
+
+// activeTasks returns the tasks assigned to or running on a worker
+func activeTasks(tasks []Task) []Task {
+	var active []Task
+	for _, task := range tasks {
+		if task.Status == model.StatusAssigned || task.Status == model.StatusProcessing {
+			active = append(active, task)
+		}
+	}
+	return active
+}
+
+// enabled formats a flag as enabled or disabled
+func enabled(on bool) string {
+	if on {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"contracts-go/repos"
+)
+
+// fakeServices serves the queue-go and agent-intel-go endpoints used by the CLI
+type fakeServices struct {
+	repos     map[string]*Repository
+	tasks     []Task
+	next      *NextTask
+	requests  []string
+	lastBody  []byte
+	cancelled []string
+}
+
+// newTestCLI starts the fake services and returns a CLI using them, with input
+// as the answers to prompts
+func newTestCLI(t *testing.T, input string, interactive bool) (*CLI, *fakeServices, *bytes.Buffer) {
+	t.Helper()
+	fake := &fakeServices{repos: make(map[string]*Repository)}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(server.Close)
+
+	var out bytes.Buffer
+	cli := NewCLI(NewClient(server.URL, server.URL), strings.NewReader(input), &out, interactive)
+	return cli, fake, &out
+}
+
+func (f *fakeServices) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+	f.lastBody, _ = io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/repositories":
+		var req AddRepositoryRequest
+		json.Unmarshal(f.lastBody, &req)
+		repo := repos.New(req.Path)
+		repo.GitHubEnabled = req.GitHubEnabled
+		if req.MaxIterations != nil {
+			repo.MaxIterations = *req.MaxIterations
+		}
+		f.repos[repo.ID] = repo
+		writeJSON(w, http.StatusCreated, repo)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/repositories":
+		list := []*Repository{}
+		for _, repo := range f.repos {
+			list = append(list, repo)
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/repositories/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/repositories/")
+		if f.repos[id] == nil {
+			http.Error(w, "Repository not found", http.StatusNotFound)
+			return
+		}
+		delete(f.repos, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/api/queue/status":
+		writeJSON(w, http.StatusOK, QueueStatus{TotalTasks: len(f.tasks), ProcessingTasks: len(activeTasks(f.tasks))})
+	case r.URL.Path == "/api/tasks":
+		writeJSON(w, http.StatusOK, f.tasks)
+	case r.Method == http.MethodPatch && strings.HasSuffix(r.URL.Path, "/status"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/tasks/"), "/status")
+		for _, task := range f.tasks {
+			if task.ID == id {
+				f.cancelled = append(f.cancelled, id)
+				task.Status = "cancelled"
+				writeJSON(w, http.StatusOK, task)
+				return
+			}
+		}
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case strings.HasSuffix(r.URL.Path, "/logs"):
+		w.Write([]byte("building\ndone\n"))
+	case strings.HasSuffix(r.URL.Path, "/logs/stream"):
+		w.Write([]byte("event: log\ndata: {\"task_id\":\"task-1\",\"stream\":\"stdout\",\"data\":\"building\\n\"}\n\n"))
+		w.Write([]byte("event: end\ndata: {\"task_id\":\"task-1\",\"final\":true,\"exit_code\":2}\n\n"))
+	case strings.HasPrefix(r.URL.Path, "/api/tasks/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
+		for _, task := range f.tasks {
+			if task.ID == id {
+				writeJSON(w, http.StatusOK, task)
+				return
+			}
+		}
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case r.URL.Path == "/api/v1/queue/next":
+		if f.next == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no tasks available"})
+			return
+		}
+		writeJSON(w, http.StatusOK, f.next)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// TestAddRepoFlags tests registering a repository with flags, without prompts
+func TestAddRepoFlags(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "", false)
+
+	if err := cli.Run(context.Background(), []string{"add-repo", "/srv/repo", "--github", "--max-iterations", "8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := fake.repos[repos.ID("/srv/repo")]
+	if repo == nil || !repo.GitHubEnabled || repo.MaxIterations != 8 {
+		t.Fatalf("Unexpected repository %+v", repo)
+	}
+	if !strings.Contains(out.String(), "Added /srv/repo (GitHub enabled, max 8 iterations)") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+// TestAddRepoPrompts tests asking for the settings in interactive mode
+func TestAddRepoPrompts(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "y\n\n", true)
+
+	if err := cli.Run(context.Background(), []string{"add-repo", "/srv/repo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := fake.repos[repos.ID("/srv/repo")]
+	if repo == nil || !repo.GitHubEnabled || repo.MaxIterations != repos.DefaultMaxIterations {
+		t.Fatalf("Unexpected repository %+v", repo)
+	}
+	if strings.Contains(string(fake.lastBody), "max_iterations") {
+		t.Errorf("Expected the server default for an empty answer, sent %s", fake.lastBody)
+	}
+	if !strings.Contains(out.String(), "GitHub enabled? (y/N)") {
+		t.Errorf("Expected the GitHub prompt, got %q", out.String())
+	}
+}
+
+// TestRemoveRepo tests unregistering repositories by path
+func TestRemoveRepo(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "", false)
+	fake.repos[repos.ID("/srv/repo")] = repos.New("/srv/repo")
+
+	if err := cli.Run(context.Background(), []string{"rm-repo", "/srv/repo/"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.repos) != 0 || !strings.Contains(out.String(), "Removed /srv/repo") {
+		t.Errorf("Expected the repository to be removed, output %q", out.String())
+	}
+
+	err := cli.Run(context.Background(), []string{"rm-repo", "/srv/repo"})
+	if err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("Expected a not registered error, got %v", err)
+	}
+}
+
+// TestList tests listing repositories
+func TestList(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "", false)
+
+	if err := cli.Run(context.Background(), []string{"list"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No repositories registered") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	paused := repos.New("/srv/paused")
+	paused.Paused = true
+	fake.repos[paused.ID] = paused
+	out.Reset()
+
+	if err := cli.Run(context.Background(), []string{"list"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"PATH", "/srv/paused", "disabled", "paused"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in %q", expected, out.String())
+		}
+	}
+}
+
+// TestStatusAndNext tests showing the tasks in progress and the next task
+func TestStatusAndNext(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "", false)
+	fake.tasks = []Task{
+		{ID: "task-1", IssueID: "123", Repository: "/srv/repo", Status: "processing"},
+		{ID: "task-2", IssueID: "124", Repository: "/srv/repo", Status: "pending"},
+	}
+
+	if err := cli.Run(context.Background(), []string{"status"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Working on issue #123... in /srv/repo (task task-1, processing)") {
+		t.Errorf("Unexpected status %q", out.String())
+	}
+
+	out.Reset()
+	if err := cli.Run(context.Background(), []string{"next"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No tasks pending") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	fake.next = &NextTask{Score: 0.75}
+	json.Unmarshal([]byte(`{"task_id":"task-2","issue_id":"124","repository":"/srv/repo"}`), &fake.next.Task)
+	out.Reset()
+	if err := cli.Run(context.Background(), []string{"next"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Next: issue #124 in /srv/repo (task task-2, score 0.75") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+	if last := fake.requests[len(fake.requests)-1]; last != "GET /api/v1/queue/next?peek=true" {
+		t.Errorf("Expected next to peek without claiming, requested %s", last)
+	}
+}
+
+// TestCancel tests cancelling tasks
+func TestCancel(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "", false)
+	fake.tasks = []Task{{ID: "task-1", IssueID: "123", Status: "processing"}}
+
+	if err := cli.Run(context.Background(), []string{"cancel", "task-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Cancelled task task-1 (issue #123)") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	if err := cli.Run(context.Background(), []string{"cancel", "missing"}); err == nil {
+		t.Error("Expected an error for an unknown task")
+	}
+	if err := cli.Run(context.Background(), []string{"cancel"}); err == nil || !strings.Contains(err.Error(), "usage: cancel <task-id>") {
+		t.Errorf("Expected the usage, got %v", err)
+	}
+}
+
+// TestLogs tests printing and following task logs
+func TestLogs(t *testing.T) {
+	cli, _, out := newTestCLI(t, "", false)
+
+	if err := cli.Run(context.Background(), []string{"logs", "task-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "building\ndone\n" {
+		t.Errorf("Unexpected log %q", out.String())
+	}
+
+	out.Reset()
+	if err := cli.Run(context.Background(), []string{"logs", "-f", "task-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "building\n\nPipeline failed with exit code 2\n" {
+		t.Errorf("Unexpected followed log %q", out.String())
+	}
+}
+
+// TestExit tests offering to stop pipelines in progress when leaving
+func TestExit(t *testing.T) {
+	cli, fake, _ := newTestCLI(t, "y\n", true)
+	fake.tasks = []Task{{ID: "task-1", IssueID: "123", Status: "processing"}}
+
+	if err := cli.Run(context.Background(), []string{"exit"}); !errors.Is(err, errExit) {
+		t.Fatalf("Expected errExit, got %v", err)
+	}
+	if len(fake.cancelled) != 1 || fake.cancelled[0] != "task-1" {
+		t.Errorf("Expected task-1 to be cancelled, got %v", fake.cancelled)
+	}
+}
+
+// TestREPL tests running commands until exit
+func TestREPL(t *testing.T) {
+	cli, _, out := newTestCLI(t, "bogus\nlist\nexit\nlist\n", false)
+
+	cli.REPL()
+
+	if strings.Count(out.String(), replPrompt) != 3 {
+		t.Errorf("Expected 3 prompts, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), `Error: unknown command "bogus"`) || strings.Count(out.String(), "No repositories registered") != 1 {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/model"
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// StatusUpdateMessage is defined in contracts-go/events
+type StatusUpdateMessage = events.StatusUpdateMessage
+
+// issueLookupTimeout bounds looking up the issue of a task, which holds up the
+// following status messages
+const issueLookupTimeout = 2 * time.Second
+
+// WatchStatus prints a live message for every task status change published on
+// tasks.status.*, e.g. "Working on issue #123..." when a worker starts a task
+func (cli *CLI) WatchStatus(nc *nats.Conn) (*nats.Subscription, error) {
+	return nc.Subscribe(subjects.TaskStatusSubject("*"), func(msg *nats.Msg) {
+		var update StatusUpdateMessage
+		if err := json.Unmarshal(msg.Data, &update); err != nil {
+			return
+		}
+		cli.handleStatusUpdate(&update)
+	})
+}
+
+// handleStatusUpdate prints the message of a status update once per task and
+// status. Tasks are forgotten once they reached a terminal status.
+func (cli *CLI) handleStatusUpdate(update *StatusUpdateMessage) {
+	cli.mu.Lock()
+	repeated := cli.lastStatus[update.TaskID] == update.Status
+	cli.lastStatus[update.TaskID] = update.Status
+	cli.mu.Unlock()
+	if repeated {
+		return
+	}
+
+	message := statusMessage(cli.issueID(update.TaskID), update.Status, update.ErrorMessage)
+	if message != "" {
+		cli.notify(message)
+	}
+
+	if model.IsTerminal(update.Status) {
+		cli.mu.Lock()
+		delete(cli.lastStatus, update.TaskID)
+		delete(cli.issues, update.TaskID)
+		cli.mu.Unlock()
+	}
+}
+
+// issueID returns the issue of a task, looked up in queue-go once. Tasks that
+// can't be looked up are shown by their ID.
+func (cli *CLI) issueID(taskID string) string {
+	cli.mu.Lock()
+	issueID, ok := cli.issues[taskID]
+	cli.mu.Unlock()
+	if ok {
+		return issueID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), issueLookupTimeout)
+	defer cancel()
+	task, err := cli.client.GetTask(ctx, taskID)
+	if err != nil {
+		return ""
+	}
+
+	cli.mu.Lock()
+	cli.issues[taskID] = task.IssueID
+	cli.mu.Unlock()
+	return task.IssueID
+}
+
+// notify prints a live message, reprinting the prompt when the REPL waits for a command
+func (cli *CLI) notify(message string) {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	if cli.prompting {
+		fmt.Fprintf(cli.out, "\n%s\n%s", message, replPrompt)
+		return
+	}
+	fmt.Fprintln(cli.out, message)
+}
+
+// statusMessage describes a task status for the user, or returns "" for
+// statuses not worth interrupting them
+func statusMessage(issueID, status, errorMessage string) string {
+	issue := "issue #" + issueID
+	if issueID == "" {
+		issue = "an issue"
+	}
+
+	switch status {
+	case model.StatusAssigned:
+		return fmt.Sprintf("Starting %s...", issue)
+	case model.StatusProcessing:
+		return fmt.Sprintf("Working on %s...", issue)
+	case model.StatusCompleted:
+		return fmt.Sprintf("Finished %s", issue)
+	case model.StatusFailed:
+		if errorMessage != "" {
+			return fmt.Sprintf("Failed %s: %s", issue, errorMessage)
+		}
+		return fmt.Sprintf("Failed %s", issue)
+	case model.StatusCancelled:
+		return fmt.Sprintf("Cancelled %s", issue)
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStatusMessage tests the live messages of task statuses
+func TestStatusMessage(t *testing.T) {
+	tests := []struct {
+		issueID, status, errorMessage string
+		want                          string
+	}{
+		{"123", "processing", "", "Working on issue #123..."},
+		{"123", "completed", "", "Finished issue #123"},
+		{"123", "failed", "exit status 2", "Failed issue #123: exit status 2"},
+		{"123", "cancelled", "", "Cancelled issue #123"},
+		{"", "processing", "", "Working on an issue..."},
+		{"123", "pending", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := statusMessage(tt.issueID, tt.status, tt.errorMessage); got != tt.want {
+			t.Errorf("statusMessage(%q, %q) = %q, want %q", tt.issueID, tt.status, got, tt.want)
+		}
+	}
+}
+
+// TestHandleStatusUpdate tests that status updates are printed once, with the
+// issue looked up in queue-go
+func TestHandleStatusUpdate(t *testing.T) {
+	cli, fake, out := newTestCLI(t, "", false)
+	fake.tasks = []Task{{ID: "task-1", IssueID: "123", Status: "processing"}}
+
+	cli.handleStatusUpdate(&StatusUpdateMessage{TaskID: "task-1", Status: "processing"})
+	cli.handleStatusUpdate(&StatusUpdateMessage{TaskID: "task-1", Status: "processing"})
+	cli.handleStatusUpdate(&StatusUpdateMessage{TaskID: "task-1", Status: "completed"})
+
+	if out.String() != "Working on issue #123...\nFinished issue #123\n" {
+		t.Errorf("Unexpected messages %q", out.String())
+	}
+
+	lookups := 0
+	for _, request := range fake.requests {
+		if strings.HasPrefix(request, "GET /api/tasks/task-1") {
+			lookups++
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected the issue to be looked up once, got %d lookups", lookups)
+	}
+	if len(cli.lastStatus) != 0 || len(cli.issues) != 0 {
+		t.Errorf("Expected the finished task to be forgotten, got %v and %v", cli.lastStatus, cli.issues)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// replPrompt is shown when the REPL waits for a command
+const replPrompt = "🤖 agent666> "
+
+func main() {
+	queueURL := getEnv("QUEUE_URL", "http://localhost:8081")
+	intelURL := getEnv("AGENT_INTEL_URL", "http://localhost:8082")
+	natsURL := getEnv("NATS_URL", "nats://localhost:4222")
+
+	cli := NewCLI(NewClient(queueURL, intelURL), os.Stdin, os.Stdout, isTerminal(os.Stdin))
+
+	// One-shot mode: agent666 <command> [args]
+	if len(os.Args) > 1 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if err := cli.Run(ctx, os.Args[1:]); err != nil && !errors.Is(err, errExit) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Live status messages are best effort, the REPL works without NATS
+	nc, err := nats.Connect(natsURL, nats.Timeout(5*time.Second), nats.MaxReconnects(-1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: live status unavailable, failed to connect to NATS at %s: %v\n", natsURL, err)
+	} else {
+		defer nc.Close()
+		if _, err := cli.WatchStatus(nc); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to subscribe to status updates: %v\n", err)
+		}
+	}
+
+	cli.REPL()
+}
+
+// REPL reads and runs commands until exit or the end of input. Ctrl+C stops
+// the running command, e.g. logs -f, and returns to the prompt.
+func (cli *CLI) REPL() {
+	cli.printf("agent666 - queue %s, agent-intel %s\nType help for the list of commands.\n", cli.client.queueURL, cli.client.intelURL)
+
+	for {
+		cli.mu.Lock()
+		fmt.Fprint(cli.out, replPrompt)
+		cli.prompting = true
+		cli.mu.Unlock()
+
+		line, readErr := cli.in.ReadString('\n')
+
+		cli.mu.Lock()
+		cli.prompting = false
+		cli.mu.Unlock()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := cli.Run(ctx, strings.Fields(line))
+		stop()
+
+		if errors.Is(err, errExit) {
+			return
+		}
+		if err != nil {
+			cli.printf("Error: %v\n", err)
+		}
+		if readErr != nil {
+			cli.printf("\n")
+			return
+		}
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,288 @@
+// Package backoff holds the redelivery delay policies shared by the services
+// consuming JetStream messages. The same policy delays Nak'd messages and
+// fills the consumers' BackOff schedule for messages never acknowledged.
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Policy names accepted by New
+const (
+	PolicyFixed       = "fixed"
+	PolicyExponential = "exponential"
+)
+
+// Error classes accepted in BACKOFF_CLASSES
+const (
+	ClassTimeout     = "timeout"     // Deadlines and request timeouts
+	ClassUnavailable = "unavailable" // NATS or a peer service can't be reached
+)
+
+// Defaults of the environment configuration
+const (
+	DefaultInitial = time.Second
+	DefaultMax     = time.Minute
+)
+
+// Policy decides how long a failed message waits before it is redelivered
+type Policy interface {
+	// Delay returns the redelivery delay after delivery attempt (1-based) failed with err
+	Delay(attempt int, err error) time.Duration
+}
+
+// Fixed redelivers after the same interval on every attempt
+type Fixed struct {
+	Interval time.Duration
+}
+
+// Delay implements Policy
+func (b Fixed) Delay(attempt int, err error) time.Duration {
+	return b.Interval
+}
+
+// Exponential doubles (by Multiplier) the delay on every attempt up to Max.
+// Jitter randomizes each delay by up to the given fraction so failing messages
+// don't get redelivered in lockstep.
+type Exponential struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64 // 0 disables jitter, 0.2 spreads delays by ±20%
+}
+
+// Delay implements Policy
+func (b Exponential) Delay(attempt int, err error) time.Duration {
+	delay := b.base(attempt)
+
+	if b.Jitter > 0 {
+		spread := float64(delay) * b.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// base returns the delay for an attempt without jitter
+func (b Exponential) base(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		return b.Max
+	}
+	return time.Duration(delay)
+}
+
+// ErrorClass routes errors matching Match to its own policy
+type ErrorClass struct {
+	Name   string
+	Match  func(err error) bool
+	Policy Policy
+}
+
+// ErrorClasses picks the policy of the first error class matching the
+// failure, falling back to Default
+type ErrorClasses struct {
+	Classes []ErrorClass
+	Default Policy
+}
+
+// Delay implements Policy
+func (b ErrorClasses) Delay(attempt int, err error) time.Duration {
+	for _, class := range b.Classes {
+		if err != nil && class.Match(err) {
+			return class.Policy.Delay(attempt, err)
+		}
+	}
+	return b.Default.Delay(attempt, err)
+}
+
+// ErrorIs returns an error class matcher for errors wrapping one of targets
+func ErrorIs(targets ...error) func(error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// classMatchers are the error classes that can be configured by name
+var classMatchers = map[string]func(error) bool{
+	ClassTimeout:     isTimeout,
+	ClassUnavailable: ErrorIs(nats.ErrNoResponders, nats.ErrNoServers, nats.ErrConnectionClosed, nats.ErrDisconnected, syscall.ECONNREFUSED),
+}
+
+// isTimeout matches deadlines, NATS request timeouts and network timeouts
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Default returns the policy used when none is configured
+func Default() Policy {
+	return Exponential{
+		Initial:    DefaultInitial,
+		Max:        DefaultMax,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+}
+
+// New builds a fixed or exponential policy from its name
+func New(name string, initial, max time.Duration) (Policy, error) {
+	if initial <= 0 {
+		return nil, fmt.Errorf("backoff initial delay must be positive, got %v", initial)
+	}
+
+	switch name {
+	case PolicyFixed:
+		return Fixed{Interval: initial}, nil
+	case PolicyExponential:
+		if max < initial {
+			return nil, fmt.Errorf("backoff max delay %v is lower than initial delay %v", max, initial)
+		}
+		return Exponential{Initial: initial, Max: max, Multiplier: 2, Jitter: 0.2}, nil
+	default:
+		return nil, fmt.Errorf("unknown backoff policy %q (expected %s or %s)", name, PolicyFixed, PolicyExponential)
+	}
+}
+
+// FromEnv builds the policy from BACKOFF_POLICY, BACKOFF_INITIAL and
+// BACKOFF_MAX, defaulting to exponential backoff with jitter. BACKOFF_CLASSES
+// gives error classes their own policy as comma-separated
+// class=policy:initial[:max] entries, e.g. "timeout=fixed:5s,unavailable=exponential:2s:5m".
+func FromEnv() (Policy, error) {
+	policy := Default()
+
+	if name := os.Getenv("BACKOFF_POLICY"); name != "" {
+		initial, err := envDuration("BACKOFF_INITIAL", DefaultInitial)
+		if err != nil {
+			return nil, err
+		}
+		max, err := envDuration("BACKOFF_MAX", DefaultMax)
+		if err != nil {
+			return nil, err
+		}
+		if policy, err = New(name, initial, max); err != nil {
+			return nil, err
+		}
+	}
+
+	classes, err := ParseClasses(os.Getenv("BACKOFF_CLASSES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKOFF_CLASSES: %w", err)
+	}
+	if len(classes) == 0 {
+		return policy, nil
+	}
+	return ErrorClasses{Classes: classes, Default: policy}, nil
+}
+
+// ParseClasses parses comma-separated class=policy:initial[:max] entries. The
+// max delay of exponential policies defaults to DefaultMax.
+func ParseClasses(value string) ([]ErrorClass, error) {
+	var classes []ErrorClass
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(entry, "=")
+		match, known := classMatchers[strings.TrimSpace(name)]
+		if !ok || !known {
+			return nil, fmt.Errorf("%q is not class=policy:initial[:max] with class %s or %s", entry, ClassTimeout, ClassUnavailable)
+		}
+
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("%q is not class=policy:initial[:max]", entry)
+		}
+		initial, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		max := DefaultMax
+		if len(parts) == 3 {
+			if max, err = time.ParseDuration(parts[2]); err != nil {
+				return nil, fmt.Errorf("%q: %w", entry, err)
+			}
+		}
+
+		policy, err := New(parts[0], initial, max)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		classes = append(classes, ErrorClass{Name: strings.TrimSpace(name), Match: match, Policy: policy})
+	}
+	return classes, nil
+}
+
+// envDuration parses a duration environment variable, or returns def when unset
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// Schedule returns the ConsumerConfig BackOff durations for a consumer: each
+// delivery waits ackWait for an acknowledgment plus the policy delay before
+// JetStream redelivers it. The server requires fewer values than maxDeliver.
+func Schedule(policy Policy, ackWait time.Duration, maxDeliver int) []time.Duration {
+	if maxDeliver <= 1 {
+		return nil
+	}
+
+	schedule := make([]time.Duration, maxDeliver-1)
+	for i := range schedule {
+		schedule[i] = ackWait + scheduleDelay(policy, i+1)
+	}
+	return schedule
+}
+
+// scheduleDelay returns the deterministic delay of an attempt, since the
+// schedule is stored in the consumer configuration. Unacknowledged deliveries
+// carry no error, so error classes use their default.
+func scheduleDelay(policy Policy, attempt int) time.Duration {
+	switch p := policy.(type) {
+	case Exponential:
+		return p.base(attempt)
+	case ErrorClasses:
+		return scheduleDelay(p.Default, attempt)
+	default:
+		return policy.Delay(attempt, nil)
+	}
+}
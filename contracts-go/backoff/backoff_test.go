@@ -0,0 +1,196 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestFixed(t *testing.T) {
+	policy := Fixed{Interval: 5 * time.Second}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if delay := policy.Delay(attempt, nil); delay != 5*time.Second {
+			t.Errorf("Attempt %d: expected 5s, got %v", attempt, delay)
+		}
+	}
+}
+
+func TestExponential(t *testing.T) {
+	policy := Exponential{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		if delay := policy.Delay(i+1, nil); delay != want {
+			t.Errorf("Attempt %d: expected %v, got %v", i+1, want, delay)
+		}
+	}
+}
+
+func TestExponentialJitter(t *testing.T) {
+	policy := Exponential{Initial: 10 * time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(2, nil)
+		if delay < 16*time.Second || delay > 24*time.Second {
+			t.Fatalf("Expected delay within 20s ±20%%, got %v", delay)
+		}
+	}
+
+	// Jitter never exceeds the maximum
+	for i := 0; i < 100; i++ {
+		if delay := policy.Delay(10, nil); delay > time.Minute {
+			t.Fatalf("Expected delay capped at 1m, got %v", delay)
+		}
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	errTransient := errors.New("transient")
+
+	policy := ErrorClasses{
+		Classes: []ErrorClass{
+			{Name: "transient", Match: ErrorIs(errTransient), Policy: Fixed{Interval: time.Second}},
+		},
+		Default: Fixed{Interval: time.Minute},
+	}
+
+	if delay := policy.Delay(1, errTransient); delay != time.Second {
+		t.Errorf("Expected transient errors to use 1s, got %v", delay)
+	}
+	if delay := policy.Delay(1, errors.Join(errors.New("wrapped"), errTransient)); delay != time.Second {
+		t.Errorf("Expected wrapped transient errors to use 1s, got %v", delay)
+	}
+	if delay := policy.Delay(1, errors.New("other")); delay != time.Minute {
+		t.Errorf("Expected other errors to use the default 1m, got %v", delay)
+	}
+	if delay := policy.Delay(1, nil); delay != time.Minute {
+		t.Errorf("Expected nil errors to use the default 1m, got %v", delay)
+	}
+}
+
+func TestNew(t *testing.T) {
+	policy, err := New(PolicyFixed, 2*time.Second, 0)
+	if err != nil {
+		t.Fatalf("Expected fixed policy, got error %v", err)
+	}
+	if _, ok := policy.(Fixed); !ok {
+		t.Errorf("Expected Fixed, got %T", policy)
+	}
+
+	policy, err = New(PolicyExponential, time.Second, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected exponential policy, got error %v", err)
+	}
+	if _, ok := policy.(Exponential); !ok {
+		t.Errorf("Expected Exponential, got %T", policy)
+	}
+
+	invalid := []struct {
+		name         string
+		initial, max time.Duration
+	}{
+		{"linear", time.Second, time.Minute},
+		{PolicyFixed, 0, 0},
+		{PolicyExponential, time.Minute, time.Second},
+	}
+	for _, tt := range invalid {
+		if _, err := New(tt.name, tt.initial, tt.max); err == nil {
+			t.Errorf("Expected error for %s (%v, %v)", tt.name, tt.initial, tt.max)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	const ackWait = 30 * time.Second
+	policy := Exponential{Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.5}
+
+	schedule := Schedule(policy, ackWait, 3)
+
+	// The server requires fewer backoff values than MaxDeliver
+	expected := []time.Duration{ackWait + time.Second, ackWait + 2*time.Second}
+	if len(schedule) != len(expected) {
+		t.Fatalf("Expected %d values, got %v", len(expected), schedule)
+	}
+	for i, want := range expected {
+		if schedule[i] != want {
+			t.Errorf("Value %d: expected %v, got %v", i, want, schedule[i])
+		}
+	}
+
+	if schedule := Schedule(policy, ackWait, 1); schedule != nil {
+		t.Errorf("Expected no schedule for a single delivery, got %v", schedule)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("BACKOFF_POLICY", PolicyFixed)
+	t.Setenv("BACKOFF_INITIAL", "3s")
+	t.Setenv("BACKOFF_CLASSES", "timeout=fixed:10s, unavailable=exponential:2s:5m")
+
+	policy, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"deadline", fmt.Errorf("store task: %w", context.DeadlineExceeded), 10 * time.Second},
+		{"request timeout", nats.ErrTimeout, 10 * time.Second},
+		{"no responders", fmt.Errorf("publish: %w", nats.ErrNoResponders), 2 * time.Second},
+		{"other", errors.New("handler failed"), 3 * time.Second},
+	}
+	for _, tt := range tests {
+		got := policy.Delay(1, tt.err)
+		if tt.name == "no responders" {
+			// Exponential policies are jittered by ±20%
+			if got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+				t.Errorf("%s: expected about %v, got %v", tt.name, tt.want, got)
+			}
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// The consumer schedule uses the default policy
+	if schedule := Schedule(policy, time.Second, 2); schedule[0] != 4*time.Second {
+		t.Errorf("Expected the default policy in the schedule, got %v", schedule)
+	}
+}
+
+func TestFromEnvDefault(t *testing.T) {
+	t.Setenv("BACKOFF_POLICY", "")
+	t.Setenv("BACKOFF_CLASSES", "")
+
+	policy, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if _, ok := policy.(Exponential); !ok {
+		t.Errorf("Expected the default exponential policy, got %T", policy)
+	}
+}
+
+func TestParseClassesInvalid(t *testing.T) {
+	for _, value := range []string{
+		"timeout",
+		"network=fixed:1s",
+		"timeout=fixed",
+		"timeout=linear:1s",
+		"timeout=fixed:soon",
+		"unavailable=exponential:1m:1s",
+	} {
+		if _, err := ParseClasses(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package deadletter moves messages that can never be processed from the TASKS
+// stream to TASKS_DLQ, keeping the failure reason and delivery count.
+package deadletter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Dead letter reasons
+const (
+	ReasonPoison     = "poison"      // Payload could not be decoded
+	ReasonMaxDeliver = "max_deliver" // Handler failed on every allowed delivery
+)
+
+// New builds the dead letter for a delivered JetStream message
+func New(msg *nats.Msg, reason string, cause error) *events.DeadLetter {
+	dl := &events.DeadLetter{
+		Subject:  msg.Subject,
+		Reason:   reason,
+		TaskID:   taskID(msg.Data),
+		Data:     msg.Data,
+		FailedAt: time.Now(),
+	}
+
+	if cause != nil {
+		dl.Error = cause.Error()
+	}
+
+	if meta, err := msg.Metadata(); err == nil {
+		dl.Stream = meta.Stream
+		dl.Consumer = meta.Consumer
+		dl.StreamSequence = meta.Sequence.Stream
+		dl.NumDelivered = meta.NumDelivered
+	}
+
+	return dl
+}
+
+// Exhausted reports whether msg is on its last delivery allowed by maxDeliver
+func Exhausted(msg *nats.Msg, maxDeliver int) bool {
+	if maxDeliver <= 0 {
+		return false
+	}
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		return false
+	}
+	return meta.NumDelivered >= uint64(maxDeliver)
+}
+
+// Publish publishes a dead letter to TASKS_DLQ. Dead letters are deduplicated
+// on the original stream sequence so retried publishes are dropped.
+func Publish(js nats.JetStreamContext, dl *events.DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	var opts []nats.PubOpt
+	if dl.Stream != "" && dl.StreamSequence > 0 {
+		opts = append(opts, nats.MsgId(fmt.Sprintf("%s-%d", dl.Stream, dl.StreamSequence)))
+	}
+
+	if _, err := js.Publish(subjects.DeadLetterSubject(dl.Subject), data, opts...); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// Move dead-letters msg and terminates it so JetStream stops redelivering it.
+// If the dead letter can't be published the message is Nak'd instead so it isn't lost.
+func Move(js nats.JetStreamContext, msg *nats.Msg, reason string, cause error) error {
+	if err := Publish(js, New(msg, reason, cause)); err != nil {
+		msg.Nak()
+		return err
+	}
+
+	return msg.Term()
+}
+
+// taskID extracts the task ID from a payload on a best effort basis
+func taskID(data []byte) string {
+	var payload struct {
+		ID     string `json:"id"`
+		TaskID string `json:"task_id"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return ""
+	}
+
+	if payload.ID != "" {
+		return payload.ID
+	}
+	return payload.TaskID
+}
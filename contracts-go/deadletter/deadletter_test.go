@@ -0,0 +1,91 @@
+package deadletter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// jetStreamMsg builds a message carrying the JetStream ack reply subject
+func jetStreamMsg(data string, delivered int) *nats.Msg {
+	return &nats.Msg{
+		Subject: subjects.TaskNew,
+		Reply:   fmt.Sprintf("$JS.ACK.TASKS.task-workers.%d.42.7.1700000000000000000.0", delivered),
+		Data:    []byte(data),
+		Sub:     &nats.Subscription{},
+	}
+}
+
+// TestNew tests building a dead letter from a JetStream message
+func TestNew(t *testing.T) {
+	msg := jetStreamMsg(`{"id":"task-1"}`, 3)
+
+	dl := New(msg, ReasonMaxDeliver, errors.New("handler failed"))
+
+	if dl.Subject != subjects.TaskNew {
+		t.Errorf("Expected subject %s, got %s", subjects.TaskNew, dl.Subject)
+	}
+	if dl.Stream != "TASKS" || dl.Consumer != "task-workers" {
+		t.Errorf("Expected TASKS/task-workers, got %s/%s", dl.Stream, dl.Consumer)
+	}
+	if dl.StreamSequence != 42 {
+		t.Errorf("Expected stream sequence 42, got %d", dl.StreamSequence)
+	}
+	if dl.NumDelivered != 3 {
+		t.Errorf("Expected 3 deliveries, got %d", dl.NumDelivered)
+	}
+	if dl.Reason != ReasonMaxDeliver || dl.Error != "handler failed" {
+		t.Errorf("Unexpected reason %q / error %q", dl.Reason, dl.Error)
+	}
+	if dl.TaskID != "task-1" {
+		t.Errorf("Expected task ID task-1, got %s", dl.TaskID)
+	}
+	if dl.FailedAt.IsZero() {
+		t.Error("Expected FailedAt to be set")
+	}
+}
+
+// TestNewPoison tests building a dead letter for an undecodable payload
+func TestNewPoison(t *testing.T) {
+	dl := New(jetStreamMsg("not json", 1), ReasonPoison, nil)
+
+	if dl.TaskID != "" {
+		t.Errorf("Expected no task ID, got %s", dl.TaskID)
+	}
+	if string(dl.Data) != "not json" {
+		t.Errorf("Expected original data to be kept, got %s", dl.Data)
+	}
+	if dl.Error != "" {
+		t.Errorf("Expected no error, got %s", dl.Error)
+	}
+}
+
+// TestExhausted tests detection of the last allowed delivery
+func TestExhausted(t *testing.T) {
+	tests := []struct {
+		delivered  int
+		maxDeliver int
+		want       bool
+	}{
+		{1, 3, false},
+		{2, 3, false},
+		{3, 3, true},
+		{4, 3, true},
+		{5, -1, false},
+	}
+
+	for _, tt := range tests {
+		if got := Exhausted(jetStreamMsg("{}", tt.delivered), tt.maxDeliver); got != tt.want {
+			t.Errorf("Exhausted(delivered=%d, max=%d) = %v, want %v", tt.delivered, tt.maxDeliver, got, tt.want)
+		}
+	}
+
+	// Core NATS messages carry no delivery metadata
+	if Exhausted(&nats.Msg{Subject: subjects.TaskNew}, 3) {
+		t.Error("Expected message without metadata not to be exhausted")
+	}
+}
@@ -0,0 +1,136 @@
+// Package events defines the payloads published on the subjects registered in
+// contracts-go/subjects.
+package events
+
+import (
+	"time"
+
+	"contracts-go/model"
+)
+
+// Pipeline completion statuses understood by agent-intel-go
+const (
+	PipelineStatusSuccess = "success"
+	PipelineStatusFailure = "failure"
+)
+
+// TaskMessage is published on tasks.new and tasks.update
+type TaskMessage = model.Task
+
+// StatusUpdateMessage is published on tasks.status.<status>
+type StatusUpdateMessage struct {
+	TaskID       string    `json:"task_id"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// DeleteMessage is published on tasks.delete
+type DeleteMessage struct {
+	TaskID    string    `json:"task_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// CancelMessage is published on tasks.cancel when a task is cancelled before it finished
+type CancelMessage struct {
+	TaskID      string    `json:"task_id"`
+	Reason      string    `json:"reason,omitempty"`
+	CancelledAt time.Time `json:"cancelled_at"`
+}
+
+// TaskNewEvent is published on agent.task.new
+type TaskNewEvent struct {
+	TaskID       string    `json:"task_id"`
+	IssueID      string    `json:"issue_id"`
+	Repository   string    `json:"repository"`
+	TaskFilePath string    `json:"task_file_path"`
+	SizeBytes    int64     `json:"size_bytes"`
+	CreatedAt    time.Time `json:"created_at"`
+	Capabilities []string  `json:"capabilities,omitempty"`
+}
+
+// PipelineCompletedEvent is published on agent.pipeline.completed
+type PipelineCompletedEvent struct {
+	TaskID            string    `json:"task_id"`
+	WorkerID          string    `json:"worker_id,omitempty"` // Worker that ran the pipeline
+	Repository        string    `json:"repository"`
+	PipelineRuntimeMs int64     `json:"pipeline_runtime_ms"`
+	Status            string    `json:"status"` // "success" or "failure"
+	ExitCode          int       `json:"exit_code"`
+	CompletedAt       time.Time `json:"completed_at"`
+	ErrorMessage      string    `json:"error_message,omitempty"`
+}
+
+// Output streams of a LogChunk
+const (
+	LogStdout = "stdout"
+	LogStderr = "stderr"
+)
+
+// LogChunk is published on logs.<task id> with pipeline output while a task
+// runs. The last chunk of a run has Final set and carries the exit code.
+type LogChunk struct {
+	TaskID   string    `json:"task_id"`
+	Stream   string    `json:"stream,omitempty"` // "stdout" or "stderr"
+	Data     string    `json:"data,omitempty"`
+	Final    bool      `json:"final,omitempty"`
+	ExitCode int       `json:"exit_code,omitempty"`
+	Error    string    `json:"error,omitempty"` // Set on the final chunk of a failed run
+	Time     time.Time `json:"time"`
+}
+
+// DeadLetter is published on dlq.<original subject> when a message is poison
+// or its handler failed on every allowed delivery
+type DeadLetter struct {
+	Sequence       uint64    `json:"sequence,omitempty"` // Sequence in TASKS_DLQ, set when read back
+	Subject        string    `json:"subject"`            // Subject the message was originally published on
+	Stream         string    `json:"stream"`
+	Consumer       string    `json:"consumer,omitempty"`
+	StreamSequence uint64    `json:"stream_sequence"`
+	NumDelivered   uint64    `json:"num_delivered"`
+	Reason         string    `json:"reason"`
+	Error          string    `json:"error,omitempty"`
+	TaskID         string    `json:"task_id,omitempty"`
+	Data           []byte    `json:"data"`
+	FailedAt       time.Time `json:"failed_at"`
+}
+
+// NewTaskNewEvent builds the agent.task.new event for a task
+func NewTaskNewEvent(t *model.Task, sizeBytes int64) *TaskNewEvent {
+	return &TaskNewEvent{
+		TaskID:       t.ID,
+		IssueID:      t.IssueID,
+		Repository:   t.Repository,
+		TaskFilePath: t.TaskFilePath,
+		SizeBytes:    sizeBytes,
+		CreatedAt:    t.CreatedAt,
+		Capabilities: t.Capabilities,
+	}
+}
+
+// NewCancelMessage builds the cancellation message for a task
+func NewCancelMessage(taskID, reason string) *CancelMessage {
+	return &CancelMessage{
+		TaskID:      taskID,
+		Reason:      reason,
+		CancelledAt: time.Now(),
+	}
+}
+
+// NewStatusUpdate builds the status update message for a task's current status
+func NewStatusUpdate(t *model.Task) *StatusUpdateMessage {
+	return &StatusUpdateMessage{
+		TaskID:       t.ID,
+		Status:       t.Status,
+		ErrorMessage: t.ErrorMessage,
+		UpdatedAt:    time.Now(),
+	}
+}
+
+// TaskStatus returns the canonical task status a pipeline result maps to
+func (e *PipelineCompletedEvent) TaskStatus() string {
+	if e.Status == PipelineStatusSuccess {
+		return model.StatusCompleted
+	}
+	return model.StatusFailed
+}
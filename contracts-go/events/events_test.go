@@ -0,0 +1,76 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"contracts-go/model"
+)
+
+// TestNewTaskNewEvent tests conversion from a task to the agent.task.new event
+func TestNewTaskNewEvent(t *testing.T) {
+	createdAt := time.Now()
+	tk := &model.Task{
+		ID:           "task-1",
+		IssueID:      "42",
+		Repository:   "/repo",
+		TaskFilePath: "/repo/docs/task/42-fix.md",
+		Status:       model.StatusPending,
+		CreatedAt:    createdAt,
+		Capabilities: []string{"docker", "go"},
+	}
+
+	event := NewTaskNewEvent(tk, 128)
+	if event.TaskID != tk.ID || event.IssueID != tk.IssueID || event.Repository != tk.Repository {
+		t.Errorf("Event does not match task: %+v", event)
+	}
+	if event.TaskFilePath != tk.TaskFilePath {
+		t.Errorf("Expected task file path %s, got %s", tk.TaskFilePath, event.TaskFilePath)
+	}
+	if event.SizeBytes != 128 {
+		t.Errorf("Expected size 128, got %d", event.SizeBytes)
+	}
+	if !event.CreatedAt.Equal(createdAt) {
+		t.Errorf("Expected created at %v, got %v", createdAt, event.CreatedAt)
+	}
+	if len(event.Capabilities) != 2 || event.Capabilities[0] != "docker" {
+		t.Errorf("Expected capabilities [docker go], got %v", event.Capabilities)
+	}
+}
+
+// TestNewStatusUpdate tests conversion from a task to a status update
+func TestNewStatusUpdate(t *testing.T) {
+	tk := &model.Task{ID: "task-1", Status: model.StatusFailed, ErrorMessage: "boom"}
+
+	update := NewStatusUpdate(tk)
+	if update.TaskID != "task-1" || update.Status != model.StatusFailed || update.ErrorMessage != "boom" {
+		t.Errorf("Status update does not match task: %+v", update)
+	}
+	if update.UpdatedAt.IsZero() {
+		t.Error("Expected UpdatedAt to be set")
+	}
+}
+
+// TestNewCancelMessage tests building a cancellation message
+func TestNewCancelMessage(t *testing.T) {
+	msg := NewCancelMessage("task-1", "duplicate issue")
+	if msg.TaskID != "task-1" || msg.Reason != "duplicate issue" {
+		t.Errorf("Cancel message does not match: %+v", msg)
+	}
+	if msg.CancelledAt.IsZero() {
+		t.Error("Expected CancelledAt to be set")
+	}
+}
+
+// TestPipelineCompletedTaskStatus tests mapping pipeline results to task statuses
+func TestPipelineCompletedTaskStatus(t *testing.T) {
+	success := &PipelineCompletedEvent{Status: PipelineStatusSuccess}
+	if got := success.TaskStatus(); got != model.StatusCompleted {
+		t.Errorf("Expected %s, got %s", model.StatusCompleted, got)
+	}
+
+	failure := &PipelineCompletedEvent{Status: PipelineStatusFailure}
+	if got := failure.TaskStatus(); got != model.StatusFailed {
+		t.Errorf("Expected %s, got %s", model.StatusFailed, got)
+	}
+}
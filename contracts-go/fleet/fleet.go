@@ -0,0 +1,164 @@
+// Package fleet is the registry of running queue-worker-go instances. Workers
+// write their record to the WORKERS key-value bucket on every heartbeat and
+// readers treat workers that missed several heartbeats as dead.
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Bucket is the JetStream key-value bucket holding one record per worker
+	Bucket = "WORKERS"
+
+	// BucketTTL removes records of workers that stopped heartbeating long ago
+	BucketTTL = 24 * time.Hour
+
+	// DefaultHeartbeatInterval is how often workers refresh their record
+	DefaultHeartbeatInterval = 10 * time.Second
+
+	// MissedHeartbeats is how many heartbeats a worker may miss before it is considered dead
+	MissedHeartbeats = 3
+)
+
+// Worker states. StateDead is never written by a worker, it is derived from LastSeen.
+const (
+	StateRunning  = "running"
+	StateDraining = "draining" // Shutting down, finishing in-flight tasks
+	StateStopped  = "stopped"  // Shut down cleanly
+	StateDead     = "dead"     // Missed MissedHeartbeats heartbeats
+)
+
+// Worker is the record a worker keeps in the WORKERS bucket
+type Worker struct {
+	ID                  string    `json:"id"`
+	Hostname            string    `json:"hostname"`
+	Mode                string    `json:"mode"`
+	Capabilities        []string  `json:"capabilities"`
+	Concurrency         int       `json:"concurrency"`
+	State               string    `json:"state"`
+	CurrentTasks        []string  `json:"current_tasks"`
+	StartedAt           time.Time `json:"started_at"`
+	LastSeen            time.Time `json:"last_seen"`
+	HeartbeatIntervalMs int64     `json:"heartbeat_interval_ms"`
+}
+
+// EnsureBucket creates the WORKERS bucket if it doesn't exist and returns it
+func EnsureBucket(js nats.JetStreamContext) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(Bucket)
+	if err == nil {
+		return kv, nil
+	}
+	if !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, fmt.Errorf("failed to open bucket %s: %w", Bucket, err)
+	}
+
+	kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:      Bucket,
+		Description: "Registry of queue-worker-go instances",
+		History:     1,
+		TTL:         BucketTTL,
+		Storage:     nats.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket %s: %w", Bucket, err)
+	}
+	return kv, nil
+}
+
+// OpenBucket opens the WORKERS bucket without creating it, failing with
+// nats.ErrBucketNotFound when no worker registered yet. Readers use it so
+// listing the fleet never creates the bucket.
+func OpenBucket(js nats.JetStreamContext) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bucket %s: %w", Bucket, err)
+	}
+	return kv, nil
+}
+
+// Key returns the bucket key of a worker ID, replacing characters keys don't allow
+func Key(workerID string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-' || r == '_' || r == '=':
+			return r
+		}
+		return '_'
+	}, workerID)
+}
+
+// Put writes a worker record, stamping LastSeen
+func Put(kv nats.KeyValue, w *Worker) error {
+	w.LastSeen = time.Now()
+
+	data, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("failed to marshal worker %s: %w", w.ID, err)
+	}
+
+	if _, err := kv.Put(Key(w.ID), data); err != nil {
+		return fmt.Errorf("failed to register worker %s: %w", w.ID, err)
+	}
+	return nil
+}
+
+// List returns every worker record in the bucket
+func List(kv nats.KeyValue) ([]Worker, error) {
+	keys, err := kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return []Worker{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+
+	workers := make([]Worker, 0, len(keys))
+	for _, key := range keys {
+		entry, err := kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			// Expired or deleted since listing
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get worker %s: %w", key, err)
+		}
+
+		var w Worker
+		if err := json.Unmarshal(entry.Value(), &w); err != nil {
+			return nil, fmt.Errorf("failed to decode worker %s: %w", key, err)
+		}
+		workers = append(workers, w)
+	}
+	return workers, nil
+}
+
+// HeartbeatInterval returns how often the worker refreshes its record
+func (w *Worker) HeartbeatInterval() time.Duration {
+	if w.HeartbeatIntervalMs <= 0 {
+		return DefaultHeartbeatInterval
+	}
+	return time.Duration(w.HeartbeatIntervalMs) * time.Millisecond
+}
+
+// Alive reports whether the worker heartbeated recently enough at now
+func (w *Worker) Alive(now time.Time) bool {
+	return now.Sub(w.LastSeen) <= MissedHeartbeats*w.HeartbeatInterval()
+}
+
+// CurrentState returns the worker's state at now, StateDead once a running or
+// draining worker missed too many heartbeats
+func (w *Worker) CurrentState(now time.Time) string {
+	if w.State != StateStopped && !w.Alive(now) {
+		return StateDead
+	}
+	return w.State
+}
@@ -0,0 +1,38 @@
+package fleet
+
+import (
+	"testing"
+	"time"
+)
+
+// TestKey tests that worker IDs are mapped to valid bucket keys
+func TestKey(t *testing.T) {
+	if got := Key("worker-1.example.com"); got != "worker-1_example_com" {
+		t.Errorf("Expected worker-1_example_com, got %s", got)
+	}
+}
+
+// TestCurrentState tests that workers missing heartbeats are reported dead
+func TestCurrentState(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		worker Worker
+		want   string
+	}{
+		{"recent heartbeat", Worker{State: StateRunning, LastSeen: now.Add(-5 * time.Second)}, StateRunning},
+		{"missed heartbeats", Worker{State: StateRunning, LastSeen: now.Add(-time.Minute)}, StateDead},
+		{"draining missed heartbeats", Worker{State: StateDraining, LastSeen: now.Add(-time.Minute)}, StateDead},
+		{"custom interval", Worker{State: StateRunning, LastSeen: now.Add(-time.Minute), HeartbeatIntervalMs: 30000}, StateRunning},
+		{"stopped", Worker{State: StateStopped, LastSeen: now.Add(-time.Hour)}, StateStopped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.worker.CurrentState(now); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
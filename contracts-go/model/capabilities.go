@@ -0,0 +1,61 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxCapabilities is the most capability labels a task may require
+const MaxCapabilities = 3
+
+// ErrInvalidCapability is returned for capability labels that can't be routed
+var ErrInvalidCapability = errors.New("invalid capability")
+
+// capabilityPattern restricts labels to a single NATS subject token
+var capabilityPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// NormalizeCapabilities lowercases, deduplicates and sorts capability labels
+// such as "go", "docker" or "repo-agent666", rejecting labels that aren't
+// lowercase letters, digits and dashes
+func NormalizeCapabilities(labels []string) ([]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool, len(labels))
+	normalized := make([]string, 0, len(labels))
+
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if !capabilityPattern.MatchString(label) {
+			return nil, fmt.Errorf("%w %q (use lowercase letters, digits and dashes)", ErrInvalidCapability, label)
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		normalized = append(normalized, label)
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// CanRun reports whether a worker with the given capabilities may run a task
+// requiring required
+func CanRun(capabilities, required []string) bool {
+	declared := make(map[string]bool, len(capabilities))
+	for _, capability := range capabilities {
+		declared[capability] = true
+	}
+
+	for _, label := range required {
+		if !declared[label] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestNormalizeCapabilities tests label normalization and validation
+func TestNormalizeCapabilities(t *testing.T) {
+	got, err := NormalizeCapabilities([]string{" Go", "docker", "go", "repo-agent666"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"docker", "go", "repo-agent666"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeCapabilities = %v, want %v", got, want)
+	}
+
+	for _, label := range []string{"", "node.js", "tasks>", "-go", "with space"} {
+		if _, err := NormalizeCapabilities([]string{label}); !errors.Is(err, ErrInvalidCapability) {
+			t.Errorf("NormalizeCapabilities(%q) error = %v, want ErrInvalidCapability", label, err)
+		}
+	}
+}
+
+// TestCanRun tests matching required capabilities against a worker
+func TestCanRun(t *testing.T) {
+	tests := []struct {
+		capabilities []string
+		required     []string
+		want         bool
+	}{
+		{nil, nil, true},
+		{[]string{"go"}, nil, true},
+		{[]string{"docker", "go"}, []string{"go"}, true},
+		{[]string{"go"}, []string{"docker", "go"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanRun(tt.capabilities, tt.required); got != tt.want {
+			t.Errorf("CanRun(%v, %v) = %v, want %v", tt.capabilities, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package model defines the canonical task entity and status vocabulary shared
+// by queue-go, queue-worker-go and agent-intel-go.
+//
+// Task lifecycle:
+//
+//	pending ──► assigned ──► processing ──► completed
+//	   │           │             │
+//	   │           │             └────────► failed
+//	   │           └──► pending (lease expired, requeued)
+//	   │
+//	   └──► processing / completed / failed (stream mode workers skip assignment)
+//
+// Any non-terminal status may move to cancelled. completed, failed and
+// cancelled are terminal. The legacy "in_progress" status is accepted as an
+// alias of processing.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Canonical task statuses
+const (
+	StatusPending    = "pending"    // Queued, waiting for a worker
+	StatusAssigned   = "assigned"   // Claimed by a worker under a lease
+	StatusProcessing = "processing" // Pipeline running
+	StatusCompleted  = "completed"  // Pipeline succeeded
+	StatusFailed     = "failed"     // Pipeline failed or attempts exhausted
+	StatusCancelled  = "cancelled"  // Cancelled by a user
+)
+
+// Status errors
+var (
+	ErrInvalidStatus     = errors.New("invalid task status")
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+// LegacyStatusInProgress is the status queue-go used before processing was introduced
+const LegacyStatusInProgress = "in_progress"
+
+// Statuses lists every canonical status in lifecycle order
+var Statuses = []string{
+	StatusPending,
+	StatusAssigned,
+	StatusProcessing,
+	StatusCompleted,
+	StatusFailed,
+	StatusCancelled,
+}
+
+// transitions holds the allowed target statuses for each status
+var transitions = map[string][]string{
+	StatusPending:    {StatusAssigned, StatusProcessing, StatusCompleted, StatusFailed, StatusCancelled},
+	StatusAssigned:   {StatusPending, StatusProcessing, StatusCompleted, StatusFailed, StatusCancelled},
+	StatusProcessing: {StatusPending, StatusCompleted, StatusFailed, StatusCancelled},
+	StatusCompleted:  {},
+	StatusFailed:     {},
+	StatusCancelled:  {},
+}
+
+// Task is the canonical task entity, published as-is on tasks.new
+type Task struct {
+	ID           string    `json:"id"`
+	IssueID      string    `json:"issue_id"`
+	Repository   string    `json:"repository"`
+	TaskFilePath string    `json:"task_file_path"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	Capabilities []string  `json:"capabilities,omitempty"` // Labels a worker must declare to run the task
+}
+
+// NormalizeStatus returns the canonical form of a status, mapping legacy aliases
+func NormalizeStatus(status string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == LegacyStatusInProgress {
+		return StatusProcessing, nil
+	}
+
+	if !IsValidStatus(status) {
+		return "", fmt.Errorf("%w %q", ErrInvalidStatus, status)
+	}
+	return status, nil
+}
+
+// IsValidStatus reports whether status is a canonical status
+func IsValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// IsTerminal reports whether no further transitions are allowed from status
+func IsTerminal(status string) bool {
+	next, ok := transitions[status]
+	return ok && len(next) == 0
+}
+
+// IsActive reports whether a task with this status still occupies the queue
+func IsActive(status string) bool {
+	return IsValidStatus(status) && !IsTerminal(status)
+}
+
+// CanTransition reports whether a task may move from one status to another.
+// Setting the current status again is allowed so replays stay idempotent.
+func CanTransition(from, to string) bool {
+	if from == to {
+		return IsValidStatus(from)
+	}
+
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SourcesOf returns the statuses a task may move to status from
+func SourcesOf(status string) []string {
+	var sources []string
+	for _, from := range Statuses {
+		if from != status && CanTransition(from, status) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+// Transition moves the task to a new status, rejecting invalid transitions
+func (t *Task) Transition(status string) error {
+	to, err := NormalizeStatus(status)
+	if err != nil {
+		return err
+	}
+
+	from, err := NormalizeStatus(t.Status)
+	if err != nil {
+		return err
+	}
+
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	t.Status = to
+	t.UpdatedAt = time.Now()
+	return nil
+}
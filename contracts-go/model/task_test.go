@@ -0,0 +1,112 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestNormalizeStatus tests canonical and legacy status normalization
+func TestNormalizeStatus(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"pending", StatusPending, false},
+		{"in_progress", StatusProcessing, false},
+		{" Processing ", StatusProcessing, false},
+		{"cancelled", StatusCancelled, false},
+		{"done", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeStatus(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeStatus(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeStatus(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestCanTransition tests the task state machine
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusPending, StatusAssigned, true},
+		{StatusPending, StatusProcessing, true},
+		{StatusAssigned, StatusPending, true},
+		{StatusAssigned, StatusProcessing, true},
+		{StatusProcessing, StatusCompleted, true},
+		{StatusProcessing, StatusFailed, true},
+		{StatusProcessing, StatusCancelled, true},
+		{StatusCompleted, StatusPending, false},
+		{StatusFailed, StatusProcessing, false},
+		{StatusCancelled, StatusPending, false},
+		{StatusCompleted, StatusCompleted, true},
+		{"unknown", StatusPending, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// TestTerminalStatuses tests terminal and active status classification
+func TestTerminalStatuses(t *testing.T) {
+	for _, status := range []string{StatusCompleted, StatusFailed, StatusCancelled} {
+		if !IsTerminal(status) || IsActive(status) {
+			t.Errorf("Expected %s to be terminal", status)
+		}
+	}
+
+	for _, status := range []string{StatusPending, StatusAssigned, StatusProcessing} {
+		if IsTerminal(status) || !IsActive(status) {
+			t.Errorf("Expected %s to be active", status)
+		}
+	}
+}
+
+// TestSourcesOf tests the statuses a terminal status can be reached from
+func TestSourcesOf(t *testing.T) {
+	sources := SourcesOf(StatusCompleted)
+	want := []string{StatusPending, StatusAssigned, StatusProcessing}
+
+	if len(sources) != len(want) {
+		t.Fatalf("Expected sources %v, got %v", want, sources)
+	}
+	for i := range want {
+		if sources[i] != want[i] {
+			t.Errorf("Expected sources %v, got %v", want, sources)
+		}
+	}
+}
+
+// TestTaskTransition tests transitions on a task including legacy statuses
+func TestTaskTransition(t *testing.T) {
+	task := &Task{ID: "1", Status: LegacyStatusInProgress}
+
+	if err := task.Transition(StatusCompleted); err != nil {
+		t.Fatalf("Expected transition to succeed, got %v", err)
+	}
+	if task.Status != StatusCompleted {
+		t.Errorf("Expected status %s, got %s", StatusCompleted, task.Status)
+	}
+	if task.UpdatedAt.IsZero() {
+		t.Error("Expected UpdatedAt to be set")
+	}
+
+	if err := task.Transition(StatusPending); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+	if err := task.Transition("bogus"); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("Expected ErrInvalidStatus, got %v", err)
+	}
+}
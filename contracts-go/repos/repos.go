@@ -0,0 +1,172 @@
+// Package repos is the registry of repositories agent666 works on. queue-go
+// keeps one record per repository in the REPOSITORIES key-value bucket and only
+// accepts tasks for registered repositories that are not paused.
+package repos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Bucket is the JetStream key-value bucket holding one record per repository
+	Bucket = "REPOSITORIES"
+
+	// DefaultMaxIterations is the iteration limit of repositories registered without one
+	DefaultMaxIterations = 5
+
+	// MaxIterationsLimit is the highest iteration limit a repository may have
+	MaxIterationsLimit = 100
+)
+
+var (
+	// ErrExists is returned when registering a repository twice
+	ErrExists = errors.New("repository already registered")
+
+	// ErrNotFound is returned when a repository is not registered
+	ErrNotFound = errors.New("repository not found")
+
+	// ErrConflict is returned when a record changed since it was read
+	ErrConflict = errors.New("repository was changed concurrently")
+)
+
+// Repository is the record of a registered repository
+type Repository struct {
+	ID            string    `json:"id"`
+	Path          string    `json:"path"`           // Absolute path of the working tree
+	GitHubEnabled bool      `json:"github_enabled"` // Whether pipelines may push and open pull requests
+	MaxIterations int       `json:"max_iterations"` // Pipeline iterations allowed per task
+	Paused        bool      `json:"paused"`         // Paused repositories accept no new tasks
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ID returns the ID of the repository at path. IDs are derived from the cleaned
+// path, so a path can only be registered once.
+func ID(path string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(path)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// New builds the record of a repository with the default settings
+func New(path string) *Repository {
+	path = filepath.Clean(path)
+	now := time.Now()
+	return &Repository{
+		ID:            ID(path),
+		Path:          path,
+		MaxIterations: DefaultMaxIterations,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// Validate checks the fields of a record. It doesn't check the path on disk,
+// which only the service owning the repository can see.
+func (r *Repository) Validate() error {
+	if !filepath.IsAbs(r.Path) {
+		return fmt.Errorf("repository path must be absolute: %q", r.Path)
+	}
+	if r.MaxIterations < 1 || r.MaxIterations > MaxIterationsLimit {
+		return fmt.Errorf("max_iterations must be between 1 and %d", MaxIterationsLimit)
+	}
+	return nil
+}
+
+// EnsureBucket creates the REPOSITORIES bucket if it doesn't exist and returns it
+func EnsureBucket(js nats.JetStreamContext) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(Bucket)
+	if err == nil {
+		return kv, nil
+	}
+	if !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, fmt.Errorf("failed to open bucket %s: %w", Bucket, err)
+	}
+
+	kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:      Bucket,
+		Description: "Repositories registered with agent666",
+		History:     1,
+		Storage:     nats.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket %s: %w", Bucket, err)
+	}
+	return kv, nil
+}
+
+// Create writes the record of a new repository, failing with ErrExists when
+// its path is already registered
+func Create(kv nats.KeyValue, r *Repository) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal repository %s: %w", r.Path, err)
+	}
+
+	if _, err := kv.Create(r.ID, data); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return ErrExists
+		}
+		return fmt.Errorf("failed to register repository %s: %w", r.Path, err)
+	}
+	return nil
+}
+
+// Get reads the record of a repository along with its revision, failing with
+// ErrNotFound when it is not registered
+func Get(kv nats.KeyValue, id string) (*Repository, uint64, error) {
+	entry, err := kv.Get(id)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read repository %s: %w", id, err)
+	}
+
+	r, err := Decode(entry.Value())
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, entry.Revision(), nil
+}
+
+// Update writes the record of a repository read at revision, failing with
+// ErrConflict when it was changed since
+func Update(kv nats.KeyValue, r *Repository, revision uint64) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal repository %s: %w", r.Path, err)
+	}
+
+	if _, err := kv.Update(r.ID, data, revision); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return ErrConflict
+		}
+		return fmt.Errorf("failed to update repository %s: %w", r.Path, err)
+	}
+	return nil
+}
+
+// Delete removes the record of a repository
+func Delete(kv nats.KeyValue, id string) error {
+	if err := kv.Delete(id); err != nil {
+		return fmt.Errorf("failed to remove repository %s: %w", id, err)
+	}
+	return nil
+}
+
+// Decode decodes a record read from the bucket
+func Decode(data []byte) (*Repository, error) {
+	var r Repository
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode repository: %w", err)
+	}
+	return &r, nil
+}
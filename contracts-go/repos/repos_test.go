@@ -0,0 +1,42 @@
+package repos
+
+import "testing"
+
+// TestID tests that IDs are derived from the cleaned path
+func TestID(t *testing.T) {
+	if ID("/srv/repo") != ID("/srv/repo/") || ID("/srv/repo") != ID("/srv/other/../repo") {
+		t.Error("Expected equivalent paths to have the same ID")
+	}
+	if ID("/srv/repo") == ID("/srv/repo2") {
+		t.Error("Expected different paths to have different IDs")
+	}
+	if len(ID("/srv/repo")) != 16 {
+		t.Errorf("Expected a 16 character ID, got %q", ID("/srv/repo"))
+	}
+}
+
+// TestValidate tests validating repository records
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		maxIterations int
+		valid         bool
+	}{
+		{"defaults", "/srv/repo", DefaultMaxIterations, true},
+		{"limit", "/srv/repo", MaxIterationsLimit, true},
+		{"relative path", "srv/repo", DefaultMaxIterations, false},
+		{"no iterations", "/srv/repo", 0, false},
+		{"too many iterations", "/srv/repo", MaxIterationsLimit + 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.path)
+			r.MaxIterations = tt.maxIterations
+			if err := r.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package subjects
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Stream describes a JetStream stream and the subjects it captures
+type Stream struct {
+	Name        string
+	Description string
+	Subjects    []string
+	Retention   nats.RetentionPolicy
+	MaxAge      time.Duration
+}
+
+// Contract describes a subject, the stream that must capture it and its payload
+type Contract struct {
+	Subject    string   // May contain wildcards for templated subjects (tasks.status.*)
+	Stream     string   // Stream the subject is bound to
+	Payload    string   // Payload type in contracts-go/events
+	Publishers []string // Services publishing on the subject
+	Consumers  []string // Services consuming the subject
+}
+
+// Streams lists every stream used by the system
+var Streams = []Stream{
+	{
+		Name:        StreamTasks,
+		Description: "Task queue for Agent666",
+		Subjects:    []string{TaskNew, TaskNewRouted, TaskUpdate},
+		Retention:   nats.WorkQueuePolicy, // Messages deleted after acknowledgment
+		MaxAge:      7 * 24 * time.Hour,
+	},
+	{
+		Name:        StreamTaskEvents,
+		Description: "Task status changes, deletions and cancellations, consumed by every queue-go replica",
+		Subjects:    []string{TaskDelete, TaskStatus + ".*", TaskCancel},
+		Retention:   nats.LimitsPolicy, // Each replica has its own consumer
+		MaxAge:      7 * 24 * time.Hour,
+	},
+	{
+		Name:        StreamTasksDLQ,
+		Description: "Dead letters of tasks that exceeded MaxDeliver or could not be decoded",
+		Subjects:    []string{DeadLetterTasks},
+		Retention:   nats.LimitsPolicy, // Kept until requeued or purged
+		MaxAge:      30 * 24 * time.Hour,
+	},
+	{
+		Name:        StreamLogs,
+		Description: "Pipeline output of running tasks, tailed live by queue-go",
+		Subjects:    []string{TaskLogs + ".*"},
+		Retention:   nats.LimitsPolicy, // Complete logs are kept in the task log object store
+		MaxAge:      24 * time.Hour,
+	},
+	{
+		Name:        StreamAgent,
+		Description: "Agent Intel Service events",
+		Subjects:    []string{"agent.>"},
+		Retention:   nats.LimitsPolicy,
+		MaxAge:      7 * 24 * time.Hour,
+	},
+}
+
+// Contracts lists every subject used by the system
+var Contracts = []Contract{
+	{
+		Subject:    TaskNew,
+		Stream:     StreamTasks,
+		Payload:    "TaskMessage",
+		Publishers: []string{ServiceQueue},
+		Consumers:  []string{ServiceWorker},
+	},
+	{
+		Subject:    TaskNewRouted,
+		Stream:     StreamTasks,
+		Payload:    "TaskMessage",
+		Publishers: []string{ServiceQueue},
+		Consumers:  []string{ServiceWorker},
+	},
+	{
+		Subject: TaskUpdate,
+		Stream:  StreamTasks,
+		Payload: "TaskMessage",
+	},
+	{
+		Subject:    TaskDelete,
+		Stream:     StreamTaskEvents,
+		Payload:    "DeleteMessage",
+		Publishers: []string{ServiceQueue},
+		Consumers:  []string{ServiceQueue},
+	},
+	{
+		Subject:    TaskStatus + ".*",
+		Stream:     StreamTaskEvents,
+		Payload:    "StatusUpdateMessage",
+		Publishers: []string{ServiceQueue, ServiceWorker},
+		Consumers:  []string{ServiceQueue, ServiceCLI},
+	},
+	{
+		Subject:    TaskCancel,
+		Stream:     StreamTaskEvents,
+		Payload:    "CancelMessage",
+		Publishers: []string{ServiceQueue, ServiceAgentIntel},
+		Consumers:  []string{ServiceQueue, ServiceWorker, ServiceAgentIntel},
+	},
+	{
+		Subject:    DeadLetterTasks,
+		Stream:     StreamTasksDLQ,
+		Payload:    "DeadLetter",
+		Publishers: []string{ServiceQueue, ServiceWorker},
+		Consumers:  []string{ServiceQueue},
+	},
+	{
+		Subject:    AgentTaskNew,
+		Stream:     StreamAgent,
+		Payload:    "TaskNewEvent",
+		Publishers: []string{ServiceQueue},
+		Consumers:  []string{ServiceAgentIntel, ServiceQueue},
+	},
+	{
+		Subject:    AgentPipelineCompleted,
+		Stream:     StreamAgent,
+		Payload:    "PipelineCompletedEvent",
+		Publishers: []string{ServiceWorker},
+		Consumers:  []string{ServiceAgentIntel},
+	},
+	{
+		Subject:    TaskLogs + ".*",
+		Stream:     StreamLogs,
+		Payload:    "LogChunk",
+		Publishers: []string{ServiceWorker},
+		Consumers:  []string{ServiceQueue},
+	},
+}
+
+// GetStream returns the stream definition with the given name
+func GetStream(name string) (Stream, bool) {
+	for _, stream := range Streams {
+		if stream.Name == name {
+			return stream, true
+		}
+	}
+	return Stream{}, false
+}
+
+// StreamConfig returns the JetStream configuration of a stream
+func (s Stream) StreamConfig() *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:        s.Name,
+		Description: s.Description,
+		Subjects:    s.Subjects,
+		Retention:   s.Retention,
+		MaxAge:      s.MaxAge,
+		Storage:     nats.FileStorage, // Persist to disk
+		Replicas:    1,                // Single replica for now
+		Discard:     nats.DiscardOld,  // Discard old messages when limits reached
+	}
+}
+
+// PublishedBy returns the subjects a service publishes on
+func PublishedBy(service string) []Contract {
+	var contracts []Contract
+	for _, contract := range Contracts {
+		for _, publisher := range contract.Publishers {
+			if publisher == service {
+				contracts = append(contracts, contract)
+				break
+			}
+		}
+	}
+	return contracts
+}
+
+// Validate checks that every contract is captured by its bound stream and by no other stream
+func Validate() error {
+	for _, contract := range Contracts {
+		bound, ok := GetStream(contract.Stream)
+		if !ok {
+			return fmt.Errorf("subject %s is bound to unknown stream %s", contract.Subject, contract.Stream)
+		}
+
+		if !Covers(bound.Subjects, contract.Subject) {
+			return fmt.Errorf("subject %s is not captured by stream %s (subjects %v)", contract.Subject, bound.Name, bound.Subjects)
+		}
+
+		for _, other := range Streams {
+			if other.Name != bound.Name && Covers(other.Subjects, contract.Subject) {
+				return fmt.Errorf("subject %s is captured by both %s and %s", contract.Subject, bound.Name, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Covers reports whether any of the stream subject patterns captures every
+// subject matched by subject, which may itself contain wildcards
+func Covers(patterns []string, subject string) bool {
+	for _, pattern := range patterns {
+		if subjectWithin(subject, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectWithin reports whether all subjects matched by subject are matched by pattern
+func subjectWithin(subject, pattern string) bool {
+	subjectTokens := strings.Split(subject, ".")
+	patternTokens := strings.Split(pattern, ".")
+
+	for i, pt := range patternTokens {
+		if pt == ">" {
+			// Needs at least one more subject token
+			return i < len(subjectTokens)
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+
+		st := subjectTokens[i]
+		switch {
+		case st == ">":
+			return false
+		case pt == "*":
+			continue
+		case st == "*" || st != pt:
+			return false
+		}
+	}
+
+	return len(subjectTokens) == len(patternTokens)
+}
+
+// EnsureStream creates the stream if it doesn't exist or updates an existing
+// stream so it captures all registered subjects
+func EnsureStream(js nats.JetStreamContext, name string) error {
+	stream, ok := GetStream(name)
+	if !ok {
+		return fmt.Errorf("unknown stream %s", name)
+	}
+
+	_, err := js.StreamInfo(name)
+	if err == nats.ErrStreamNotFound {
+		if _, err := js.AddStream(stream.StreamConfig()); err != nil {
+			return fmt.Errorf("failed to create stream %s: %w", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get stream info for %s: %w", name, err)
+	}
+
+	if _, err := js.UpdateStream(stream.StreamConfig()); err != nil {
+		return fmt.Errorf("failed to update stream %s: %w", name, err)
+	}
+	return nil
+}
+
+// VerifyPublished checks against the server that every subject published by
+// the service is captured by its bound stream, so events are never silently dropped
+func VerifyPublished(js nats.JetStreamContext, service string) error {
+	for _, contract := range PublishedBy(service) {
+		info, err := js.StreamInfo(contract.Stream)
+		if err != nil {
+			return fmt.Errorf("stream %s for subject %s is unavailable: %w", contract.Stream, contract.Subject, err)
+		}
+
+		if !Covers(info.Config.Subjects, contract.Subject) {
+			return fmt.Errorf("subject %s is not captured by stream %s (subjects %v)", contract.Subject, contract.Stream, info.Config.Subjects)
+		}
+	}
+	return nil
+}
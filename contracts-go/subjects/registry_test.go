@@ -0,0 +1,162 @@
+package subjects
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// TestValidate tests that the registry is consistent with the stream definitions
+func TestValidate(t *testing.T) {
+	if err := Validate(); err != nil {
+		t.Fatalf("Registry is invalid: %v", err)
+	}
+}
+
+// TestCovers tests subject coverage including wildcard subjects
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		subject  string
+		want     bool
+	}{
+		{[]string{"tasks.>"}, "tasks.new", true},
+		{[]string{"tasks.>"}, "tasks.status.completed", true},
+		{[]string{"tasks.>"}, "tasks.status.*", true},
+		{[]string{"tasks.*"}, "tasks.new", true},
+		{[]string{"tasks.*"}, "tasks.status.completed", false},
+		{[]string{"tasks.*"}, "tasks.status.*", false},
+		{[]string{"tasks.*"}, "tasks.>", false},
+		{[]string{"agent.*"}, "agent.task.new", false},
+		{[]string{"agent.>"}, "agent.task.new", true},
+		{[]string{"agent.>"}, "agent", false},
+		{[]string{"agent.>"}, "tasks.new", false},
+		{[]string{"tasks.new"}, "tasks.*", false},
+		{[]string{"tasks.new"}, "tasks.new", true},
+		{[]string{"tasks.new", "agent.>"}, "agent.pipeline.completed", true},
+	}
+
+	for _, tt := range tests {
+		if got := Covers(tt.patterns, tt.subject); got != tt.want {
+			t.Errorf("Covers(%v, %q) = %v, want %v", tt.patterns, tt.subject, got, tt.want)
+		}
+	}
+}
+
+// TestPublishedBy tests that each service publishes on the expected subjects
+func TestPublishedBy(t *testing.T) {
+	published := PublishedBy(ServiceWorker)
+	statusSubject := TaskStatus + ".*"
+	logSubject := TaskLogs + ".*"
+	if len(published) != 4 || published[0].Subject != statusSubject || published[1].Subject != DeadLetterTasks ||
+		published[2].Subject != AgentPipelineCompleted || published[3].Subject != logSubject {
+		t.Errorf("Expected %s to publish %s, %s, %s and %s, got %v", ServiceWorker, statusSubject, DeadLetterTasks, AgentPipelineCompleted, logSubject, published)
+	}
+
+	for _, contract := range PublishedBy(ServiceQueue) {
+		if contract.Subject == AgentPipelineCompleted {
+			t.Errorf("%s should not publish %s", ServiceQueue, AgentPipelineCompleted)
+		}
+	}
+}
+
+// TestStreamConfig tests the generated JetStream configuration
+func TestStreamConfig(t *testing.T) {
+	stream, ok := GetStream(StreamTasks)
+	if !ok {
+		t.Fatalf("Stream %s not registered", StreamTasks)
+	}
+
+	config := stream.StreamConfig()
+	if config.Name != StreamTasks {
+		t.Errorf("Expected name %s, got %s", StreamTasks, config.Name)
+	}
+	if len(config.Subjects) != 3 || config.Subjects[0] != TaskNew || config.Subjects[1] != TaskNewRouted || config.Subjects[2] != TaskUpdate {
+		t.Errorf("Expected subjects [%s %s %s], got %v", TaskNew, TaskNewRouted, TaskUpdate, config.Subjects)
+	}
+	if config.Retention != nats.WorkQueuePolicy {
+		t.Errorf("Expected work queue retention, got %v", config.Retention)
+	}
+
+	events, ok := GetStream(StreamTaskEvents)
+	if !ok {
+		t.Fatalf("Stream %s not registered", StreamTaskEvents)
+	}
+	if events.Retention == nats.WorkQueuePolicy {
+		t.Errorf("Expected %s to allow a consumer per replica", StreamTaskEvents)
+	}
+	if !Covers(events.Subjects, TaskCancel) {
+		t.Errorf("Expected %s to capture %s so every worker receives cancellations", StreamTaskEvents, TaskCancel)
+	}
+
+	if _, ok := GetStream("UNKNOWN"); ok {
+		t.Error("Expected unknown stream to be missing")
+	}
+}
+
+// TestTaskStatusSubject tests status subject construction
+func TestTaskStatusSubject(t *testing.T) {
+	if got := TaskStatusSubject("completed"); got != "tasks.status.completed" {
+		t.Errorf("Expected tasks.status.completed, got %s", got)
+	}
+}
+
+// TestTaskNewSubject tests routing subjects and consumers for required capabilities
+func TestTaskNewSubject(t *testing.T) {
+	tests := []struct {
+		capabilities []string
+		subject      string
+		consumer     string
+	}{
+		{nil, "tasks.new", "task-workers"},
+		{[]string{"go"}, "tasks.new.go", "task-workers-go"},
+		{[]string{"docker", "go"}, "tasks.new.docker.go", "task-workers-docker_go"},
+	}
+
+	for _, tt := range tests {
+		if got := TaskNewSubject(tt.capabilities); got != tt.subject {
+			t.Errorf("TaskNewSubject(%v) = %s, want %s", tt.capabilities, got, tt.subject)
+		}
+		if got := TaskWorkersConsumer(tt.capabilities); got != tt.consumer {
+			t.Errorf("TaskWorkersConsumer(%v) = %s, want %s", tt.capabilities, got, tt.consumer)
+		}
+	}
+
+	if !Covers([]string{TaskNewRouted}, "tasks.new.docker.go") || Covers([]string{TaskNewRouted}, TaskNew) {
+		t.Errorf("Expected %s to capture routed tasks only", TaskNewRouted)
+	}
+}
+
+// TestTaskLogSubject tests log subject construction
+func TestTaskLogSubject(t *testing.T) {
+	if got := TaskLogSubject("abc-123"); got != "logs.abc-123" {
+		t.Errorf("Expected logs.abc-123, got %s", got)
+	}
+	if got := TaskLogSubject("task.1"); got != "logs.task-1" {
+		t.Errorf("Expected logs.task-1, got %s", got)
+	}
+}
+
+// TestInstanceConsumer tests per-instance consumer names
+func TestInstanceConsumer(t *testing.T) {
+	if got := InstanceConsumer(ConsumerStatusUpdates, "queue-1.example.com"); got != "status-updates-queue-1-example-com" {
+		t.Errorf("Expected status-updates-queue-1-example-com, got %s", got)
+	}
+}
+
+// TestDeadLetterSubject tests dead letter subject mapping
+func TestDeadLetterSubject(t *testing.T) {
+	subject := DeadLetterSubject(TaskNew)
+	if subject != "dlq.tasks.new" {
+		t.Errorf("Expected dlq.tasks.new, got %s", subject)
+	}
+	if !Covers([]string{DeadLetterTasks}, subject) {
+		t.Errorf("Expected %s to capture %s", DeadLetterTasks, subject)
+	}
+	if Covers([]string{"tasks.>"}, subject) {
+		t.Errorf("Expected TASKS not to capture %s", subject)
+	}
+	if got := OriginalSubject(subject); got != TaskNew {
+		t.Errorf("Expected %s, got %s", TaskNew, got)
+	}
+}
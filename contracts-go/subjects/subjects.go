@@ -0,0 +1,141 @@
+// Package subjects is the single definition of every NATS subject, stream and
+// consumer shared by queue-go, queue-worker-go and agent-intel-go.
+package subjects
+
+import "strings"
+
+// Stream names
+const (
+	StreamTasks      = "TASKS"
+	StreamTaskEvents = "TASK_EVENTS"
+	StreamTasksDLQ   = "TASKS_DLQ"
+	StreamAgent      = "AGENT"
+	StreamLogs       = "LOGS"
+)
+
+// TASKS stream subjects (owned by queue-go). The stream is a work queue, each
+// message is handled by a single consumer.
+const (
+	TaskNew       = "tasks.new"
+	TaskNewRouted = TaskNew + ".>" // Tasks requiring capabilities, see TaskNewSubject
+	TaskUpdate    = "tasks.update"
+)
+
+// TASK_EVENTS stream subjects. Every queue-go replica consumes them to keep its
+// task list in sync, so they live outside the TASKS work queue.
+const (
+	TaskDelete = "tasks.delete"
+	TaskStatus = "tasks.status" // Published as tasks.status.<status>
+	TaskCancel = "tasks.cancel" // Also consumed by every worker, which stops the task if it runs it
+)
+
+// TASKS_DLQ stream subjects. Dead letters keep the original subject behind the
+// prefix (dlq.tasks.new), outside the task subjects so their streams don't capture them
+const (
+	DeadLetterPrefix = "dlq"
+	DeadLetterTasks  = DeadLetterPrefix + ".tasks.>"
+)
+
+// AGENT stream subjects (consumed by agent-intel-go)
+const (
+	AgentTaskNew           = "agent.task.new"
+	AgentPipelineCompleted = "agent.pipeline.completed"
+)
+
+// LOGS stream subjects. Workers publish pipeline output while a task runs so it
+// can be tailed live; complete logs are kept in the contracts-go/tasklogs object store.
+const (
+	TaskLogs = "logs" // Published as logs.<task id>
+)
+
+// Durable consumer names. Consumers used by every queue-go replica are
+// suffixed with the instance ID, see InstanceConsumer.
+const (
+	ConsumerTaskWorkers                = "task-workers"
+	ConsumerStatusUpdates              = "status-updates"
+	ConsumerTaskDeletes                = "task-deletes"
+	ConsumerTaskCancels                = "task-cancels"
+	ConsumerWorkerCancels              = "worker-cancels"
+	ConsumerQueueTaskNew               = "queue-task-new"
+	ConsumerAgentIntelTaskNew          = "agent-intel-task-new"
+	ConsumerAgentIntelPipelineComplete = "agent-intel-pipeline-completed"
+	ConsumerAgentIntelTaskCancel       = "agent-intel-task-cancel"
+)
+
+// Service names used in the registry
+const (
+	ServiceQueue      = "queue-go"
+	ServiceWorker     = "queue-worker-go"
+	ServiceAgentIntel = "agent-intel-go"
+	ServiceCLI        = "cli-go"
+)
+
+// TaskStatusSubject returns the subject a status update is published on
+func TaskStatusSubject(status string) string {
+	return TaskStatus + "." + status
+}
+
+// TaskNewSubject returns the subject a new task requiring the given sorted
+// capabilities is published on: tasks.new without capabilities, otherwise
+// tasks.new.<capability>... (tasks.new.docker.go)
+func TaskNewSubject(capabilities []string) string {
+	if len(capabilities) == 0 {
+		return TaskNew
+	}
+	return TaskNew + "." + strings.Join(capabilities, ".")
+}
+
+// TaskNewCapabilities returns the capabilities required by the tasks published
+// on subject, the reverse of TaskNewSubject. It returns false for subjects
+// outside tasks.new.
+func TaskNewCapabilities(subject string) ([]string, bool) {
+	if subject == TaskNew {
+		return nil, true
+	}
+	route, ok := strings.CutPrefix(subject, TaskNew+".")
+	if !ok || route == "" {
+		return nil, false
+	}
+	return strings.Split(route, "."), true
+}
+
+// TaskWorkersConsumer returns the durable consumer shared by the workers able to
+// run tasks requiring the given sorted capabilities (task-workers-docker_go)
+func TaskWorkersConsumer(capabilities []string) string {
+	if len(capabilities) == 0 {
+		return ConsumerTaskWorkers
+	}
+	return ConsumerTaskWorkers + "-" + strings.Join(capabilities, "_")
+}
+
+// TaskLogSubject returns the subject a task's pipeline output is published on
+func TaskLogSubject(taskID string) string {
+	return TaskLogs + "." + token(taskID)
+}
+
+// InstanceConsumer returns the durable consumer name of a service instance, so
+// every instance receives all messages instead of sharing them
+func InstanceConsumer(consumer, instance string) string {
+	return consumer + "-" + token(instance)
+}
+
+// token replaces the characters that can't appear in a subject token or consumer name
+func token(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '/', '\\':
+			return '-'
+		}
+		return r
+	}, value)
+}
+
+// DeadLetterSubject returns the subject a failed message from subject is dead-lettered on
+func DeadLetterSubject(subject string) string {
+	return DeadLetterPrefix + "." + subject
+}
+
+// OriginalSubject returns the subject a dead letter was published on before it failed
+func OriginalSubject(deadLetterSubject string) string {
+	return strings.TrimPrefix(deadLetterSubject, DeadLetterPrefix+".")
+}
@@ -0,0 +1,80 @@
+// Package tasklogs stores the complete output of pipeline runs in the TASK_LOGS
+// JetStream object store, which splits large logs into chunks. Workers save a
+// task's log once its pipeline finished; while it runs the output is only
+// available as chunks on logs.<task id>.
+package tasklogs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Bucket is the object store holding one log per task, named after the task ID
+	Bucket = "TASK_LOGS"
+
+	// BucketTTL removes logs of old tasks
+	BucketTTL = 7 * 24 * time.Hour
+)
+
+// ErrNotFound is returned when no complete log was saved for a task
+var ErrNotFound = errors.New("task log not found")
+
+// EnsureStore creates the TASK_LOGS object store if it doesn't exist and returns it
+func EnsureStore(js nats.JetStreamContext) (nats.ObjectStore, error) {
+	store, err := js.ObjectStore(Bucket)
+	if err == nil {
+		return store, nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) && !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, fmt.Errorf("failed to open object store %s: %w", Bucket, err)
+	}
+
+	store, err = js.CreateObjectStore(&nats.ObjectStoreConfig{
+		Bucket:      Bucket,
+		Description: "Complete pipeline output of each task",
+		TTL:         BucketTTL,
+		Storage:     nats.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store %s: %w", Bucket, err)
+	}
+	return store, nil
+}
+
+// OpenStore opens the TASK_LOGS object store without creating it, failing with
+// ErrNotFound when no worker saved a log yet. Readers use it so fetching a log
+// never creates the store.
+func OpenStore(js nats.JetStreamContext) (nats.ObjectStore, error) {
+	store, err := js.ObjectStore(Bucket)
+	if errors.Is(err, nats.ErrStreamNotFound) || errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object store %s: %w", Bucket, err)
+	}
+	return store, nil
+}
+
+// Put saves the log of a task, replacing the log of an earlier run
+func Put(store nats.ObjectStore, taskID string, log []byte) error {
+	if _, err := store.PutBytes(taskID, log); err != nil {
+		return fmt.Errorf("failed to save log of task %s: %w", taskID, err)
+	}
+	return nil
+}
+
+// Get returns the saved log of a task
+func Get(store nats.ObjectStore, taskID string) ([]byte, error) {
+	log, err := store.GetBytes(taskID)
+	if errors.Is(err, nats.ErrObjectNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log of task %s: %w", taskID, err)
+	}
+	return log, nil
+}
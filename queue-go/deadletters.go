@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	natsClient "queue-go/nats"
+)
+
+// defaultDeadLetterLimit is the number of dead letters listed when no limit is given
+const defaultDeadLetterLimit = 100
+
+// PurgeDeadLettersResponse represents the response of a dead letter purge
+type PurgeDeadLettersResponse struct {
+	Purged uint64 `json:"purged"`
+}
+
+// natsAvailable writes a 503 response and returns false when NATS is not connected
+func natsAvailable(w http.ResponseWriter) bool {
+	if nats == nil || !nats.IsConnected() {
+		http.Error(w, "Message queue unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// ListDeadLettersHandler returns a page of the dead letters in TASKS_DLQ, oldest first
+func ListDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeadLetterLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	if !natsAvailable(w) {
+		return
+	}
+
+	deadLetters, err := nats.ListDeadLetters(offset, limit)
+	if err != nil {
+		log.Printf("Failed to list dead letters: %v", err)
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deadLetters)
+}
+
+// GetDeadLetterHandler returns a single dead letter including its original payload
+func GetDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	seq, _, ok := parseDeadLetterPath(w, r)
+	if !ok || !natsAvailable(w) {
+		return
+	}
+
+	dl, err := nats.GetDeadLetter(seq)
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dl)
+}
+
+// RequeueDeadLetterHandler republishes a dead letter on its original subject
+func RequeueDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	seq, action, ok := parseDeadLetterPath(w, r)
+	if !ok {
+		return
+	}
+	if action != "requeue" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !natsAvailable(w) {
+		return
+	}
+
+	dl, err := nats.RequeueDeadLetter(seq)
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+
+	log.Printf("Dead letter %d requeued on %s (task: %s)", seq, dl.Subject, dl.TaskID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dl)
+}
+
+// DeleteDeadLetterHandler removes a single dead letter
+func DeleteDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	seq, _, ok := parseDeadLetterPath(w, r)
+	if !ok || !natsAvailable(w) {
+		return
+	}
+
+	if err := nats.DeleteDeadLetter(seq); err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+
+	log.Printf("Dead letter %d deleted", seq)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeDeadLettersHandler removes all dead letters
+func PurgeDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !natsAvailable(w) {
+		return
+	}
+
+	purged, err := nats.PurgeDeadLetters()
+	if err != nil {
+		log.Printf("Failed to purge dead letters: %v", err)
+		http.Error(w, "Failed to purge dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Purged %d dead letters", purged)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PurgeDeadLettersResponse{Purged: purged})
+}
+
+// parseDeadLetterPath extracts the sequence and optional action from /api/dlq/{seq}[/{action}]
+func parseDeadLetterPath(w http.ResponseWriter, r *http.Request) (uint64, string, bool) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/dlq/")
+	parts := strings.Split(path, "/")
+
+	seq, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || seq == 0 {
+		http.Error(w, "Invalid dead letter sequence", http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+	return seq, action, true
+}
+
+// writeDeadLetterError maps dead letter errors to HTTP responses
+func writeDeadLetterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, natsClient.ErrDeadLetterNotFound) {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Dead letter operation failed: %v", err)
+	http.Error(w, "Dead letter operation failed", http.StatusInternalServerError)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDeadLetterHandlersWithoutNATS tests that dead letter endpoints report an unavailable queue
+func TestDeadLetterHandlersWithoutNATS(t *testing.T) {
+	nats = nil
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"list", "GET", "/api/dlq", ListDeadLettersHandler},
+		{"purge", "DELETE", "/api/dlq", PurgeDeadLettersHandler},
+		{"inspect", "GET", "/api/dlq/1", GetDeadLetterHandler},
+		{"requeue", "POST", "/api/dlq/1/requeue", RequeueDeadLetterHandler},
+		{"delete", "DELETE", "/api/dlq/1", DeleteDeadLetterHandler},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusServiceUnavailable, rr.Code)
+		}
+	}
+}
+
+// TestDeadLetterHandlersInvalidRequests tests request validation before NATS is used
+func TestDeadLetterHandlersInvalidRequests(t *testing.T) {
+	nats = nil
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		handler  http.HandlerFunc
+		wantCode int
+	}{
+		{"invalid limit", "GET", "/api/dlq?limit=abc", ListDeadLettersHandler, http.StatusBadRequest},
+		{"negative limit", "GET", "/api/dlq?limit=-1", ListDeadLettersHandler, http.StatusBadRequest},
+		{"invalid offset", "GET", "/api/dlq?offset=abc", ListDeadLettersHandler, http.StatusBadRequest},
+		{"negative offset", "GET", "/api/dlq?offset=-5", ListDeadLettersHandler, http.StatusBadRequest},
+		{"invalid sequence", "GET", "/api/dlq/abc", GetDeadLetterHandler, http.StatusBadRequest},
+		{"zero sequence", "DELETE", "/api/dlq/0", DeleteDeadLetterHandler, http.StatusBadRequest},
+		{"missing action", "POST", "/api/dlq/1", RequeueDeadLetterHandler, http.StatusNotFound},
+		{"unknown action", "POST", "/api/dlq/1/retry", RequeueDeadLetterHandler, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantCode, rr.Code)
+		}
+	}
+}
@@ -3,6 +3,8 @@ module queue-go
 go 1.21
 
 require (
+	contracts-go v0.0.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/google/uuid v1.6.0
 	github.com/nats-io/nats.go v1.31.0
 )
@@ -14,3 +16,5 @@ require (
 	golang.org/x/crypto v0.6.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
 )
+
+replace contracts-go => ../contracts-go
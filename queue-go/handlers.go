@@ -2,21 +2,27 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
+	"contracts-go/events"
+	"contracts-go/model"
+
 	"github.com/google/uuid"
 	natsClient "queue-go/nats"
 )
 
 // CreateTaskRequest represents the request to create a task
 type CreateTaskRequest struct {
-	IssueID      string `json:"issue_id"`
-	Repository   string `json:"repository"`
-	TaskFilePath string `json:"task_file_path"`
+	IssueID      string   `json:"issue_id"`
+	Repository   string   `json:"repository"`
+	TaskFilePath string   `json:"task_file_path"`
+	Capabilities []string `json:"capabilities,omitempty"` // Required worker capabilities, e.g. ["go", "docker"]
 }
 
 // UpdateTaskStatusRequest represents the request to update task status
@@ -28,9 +34,11 @@ type UpdateTaskStatusRequest struct {
 type QueueStatusResponse struct {
 	TotalTasks      int   `json:"total_tasks"`
 	PendingTasks    int   `json:"pending_tasks"`
-	InProgressTasks int   `json:"in_progress_tasks"`
+	AssignedTasks   int   `json:"assigned_tasks"`
+	ProcessingTasks int   `json:"processing_tasks"`
 	CompletedTasks  int   `json:"completed_tasks"`
 	FailedTasks     int   `json:"failed_tasks"`
+	CancelledTasks  int   `json:"cancelled_tasks"`
 	CurrentTask     *Task `json:"current_task,omitempty"`
 }
 
@@ -45,9 +53,11 @@ func GetQueueStatusHandler(w http.ResponseWriter, r *http.Request) {
 	response := QueueStatusResponse{
 		TotalTasks:      taskQueue.Size(),
 		PendingTasks:    taskQueue.CountByStatus(StatusPending),
-		InProgressTasks: taskQueue.CountByStatus(StatusInProgress),
+		AssignedTasks:   taskQueue.CountByStatus(StatusAssigned),
+		ProcessingTasks: taskQueue.CountByStatus(StatusProcessing),
 		CompletedTasks:  taskQueue.CountByStatus(StatusCompleted),
 		FailedTasks:     taskQueue.CountByStatus(StatusFailed),
+		CancelledTasks:  taskQueue.CountByStatus(StatusCancelled),
 		CurrentTask:     taskQueue.GetCurrentTask(),
 	}
 
@@ -80,6 +90,26 @@ func CreateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Tasks are only accepted for registered repositories that are not paused
+	if err := checkRepository(req.Repository); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrRepositoryPaused) {
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("Repository %s: %v", req.Repository, err), status)
+		return
+	}
+
+	capabilities, err := model.NormalizeCapabilities(req.Capabilities)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(capabilities) > model.MaxCapabilities {
+		http.Error(w, fmt.Sprintf("A task may require at most %d capabilities", model.MaxCapabilities), http.StatusBadRequest)
+		return
+	}
+
 	// Create new task
 	task := &Task{
 		ID:           uuid.New().String(),
@@ -89,29 +119,47 @@ func CreateTaskHandler(w http.ResponseWriter, r *http.Request) {
 		Status:       StatusPending,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
+		Capabilities: capabilities,
 	}
 
-	// Add to local queue for caching
-	taskQueue.Enqueue(task)
+	if err := submitTask(task); err != nil {
+		log.Printf("Failed to publish task to NATS: %v", err)
+		http.Error(w, "Failed to publish task to message queue", http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(task)
+}
+
+// submitTask publishes a new task to the workers and agent-intel-go and adds it
+// to the local queue. Tasks that couldn't be published are not queued.
+func submitTask(task *Task) error {
 	// Publish to NATS JetStream
 	if nats != nil && nats.IsConnected() {
 		taskMsg := convertTaskToNATSMessage(task)
 		if err := nats.PublishNewTask(taskMsg); err != nil {
-			log.Printf("Failed to publish task to NATS: %v", err)
-			http.Error(w, "Failed to publish task to message queue", http.StatusInternalServerError)
-			return
+			return err
 		}
 		log.Printf("Task published to NATS: ID=%s, IssueID=%s, Repository=%s", task.ID, task.IssueID, task.Repository)
+
+		// Add to local queue for caching before other replicas learn about it
+		taskQueue.Enqueue(task)
+
+		// Bridge the task into the Agent Intel Service prioritization queue
+		if err := nats.PublishAgentTaskNew(convertTaskToAgentEvent(task)); err != nil {
+			log.Printf("Failed to publish agent.task.new event: %v", err)
+		} else {
+			log.Printf("Task bridged to agent-intel: ID=%s", task.ID)
+		}
 	} else {
+		taskQueue.Enqueue(task)
 		log.Printf("NATS not connected, task only added to local queue")
 	}
 
 	log.Printf("Task created: ID=%s, IssueID=%s, Repository=%s", task.ID, task.IssueID, task.Repository)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(task)
+	return nil
 }
 
 // GetTaskHandler returns a specific task by ID
@@ -144,27 +192,24 @@ func UpdateTaskStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate status
-	validStatuses := []string{StatusPending, StatusInProgress, StatusCompleted, StatusFailed}
-	isValid := false
-	for _, status := range validStatuses {
-		if req.Status == status {
-			isValid = true
-			break
-		}
-	}
-
-	if !isValid {
+	// Validate status (legacy "in_progress" is accepted as processing)
+	status, err := model.NormalizeStatus(req.Status)
+	if err != nil {
 		http.Error(w, "Invalid status", http.StatusBadRequest)
 		return
 	}
+	req.Status = status
 
 	// Update task status
-	err := taskQueue.UpdateTaskStatus(taskID, req.Status)
-	if err != nil {
+	err = taskQueue.UpdateTaskStatus(taskID, req.Status)
+	if errors.Is(err, ErrTaskNotFound) {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 
 	// Publish status update to NATS
 	if nats != nil && nats.IsConnected() {
@@ -178,6 +223,11 @@ func UpdateTaskStatusHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			log.Printf("Task status update published to NATS: ID=%s, Status=%s", taskID, req.Status)
 		}
+
+		// Stop the task on the worker running it
+		if req.Status == StatusCancelled {
+			publishTaskCancel(taskID, "cancelled through the queue API")
+		}
 	}
 
 	// Get updated task
@@ -196,6 +246,7 @@ func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
 	taskID := strings.Split(path, "/")[0]
 
+	task := taskQueue.GetTaskByID(taskID)
 	err := taskQueue.RemoveTask(taskID)
 	if err != nil {
 		http.Error(w, "Task not found", http.StatusNotFound)
@@ -209,6 +260,11 @@ func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			log.Printf("Task delete event published to NATS: ID=%s", taskID)
 		}
+
+		// A deleted task must not keep running on a worker
+		if task != nil && !model.IsTerminal(task.Status) {
+			publishTaskCancel(taskID, "task deleted")
+		}
 	}
 
 	log.Printf("Task deleted: ID=%s", taskID)
@@ -216,16 +272,38 @@ func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// publishTaskCancel publishes a task cancellation, logging failures
+func publishTaskCancel(taskID, reason string) {
+	if err := nats.PublishTaskCancel(taskID, reason); err != nil {
+		log.Printf("Failed to publish cancel event to NATS: %v", err)
+		return
+	}
+	log.Printf("Task cancel event published to NATS: ID=%s", taskID)
+}
+
 // convertTaskToNATSMessage converts Task to NATS TaskMessage
 func convertTaskToNATSMessage(task *Task) *natsClient.TaskMessage {
-	return &natsClient.TaskMessage{
-		ID:           task.ID,
-		IssueID:      task.IssueID,
-		Repository:   task.Repository,
-		TaskFilePath: task.TaskFilePath,
-		Status:       task.Status,
-		CreatedAt:    task.CreatedAt,
-		UpdatedAt:    task.UpdatedAt,
-		ErrorMessage: task.ErrorMessage,
+	// Task and TaskMessage are the same canonical type, copy so the published
+	// message doesn't change with the queued task
+	msg := *task
+	return &msg
+}
+
+// convertTaskToAgentEvent converts Task to the agent.task.new event
+func convertTaskToAgentEvent(task *Task) *natsClient.TaskNewEvent {
+	return events.NewTaskNewEvent(task, taskFileSize(task.TaskFilePath))
+}
+
+// taskFileSize returns the size of the task file in bytes, or 0 if it can't be read
+// (agent-intel-go falls back to a default size score for unknown sizes)
+func taskFileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Warning: Failed to stat task file %s: %v", path, err)
+		return 0
+	}
+	if info.IsDir() {
+		return 0
 	}
+	return info.Size()
 }
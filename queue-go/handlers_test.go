@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // TestHealthHandler tests the health endpoint
@@ -78,7 +82,7 @@ func TestListTasksHandler(t *testing.T) {
 	taskQueue = NewTaskQueue()
 
 	task1 := &Task{ID: "1", IssueID: "1", Status: StatusPending}
-	task2 := &Task{ID: "2", IssueID: "2", Status: StatusInProgress}
+	task2 := &Task{ID: "2", IssueID: "2", Status: StatusProcessing}
 
 	taskQueue.Enqueue(task1)
 	taskQueue.Enqueue(task2)
@@ -111,6 +115,7 @@ func TestListTasksHandler(t *testing.T) {
 // TestCreateTaskHandler tests creating a new task
 func TestCreateTaskHandler(t *testing.T) {
 	taskQueue = NewTaskQueue()
+	registerTestRepository("/test/repo")
 
 	createReq := CreateTaskRequest{
 		IssueID:      "2",
@@ -211,6 +216,57 @@ func TestCreateTaskHandlerMissingFields(t *testing.T) {
 	}
 }
 
+// TestCreateTaskHandlerCapabilities tests normalizing and validating required capabilities
+func TestCreateTaskHandlerCapabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities []string
+		wantStatus   int
+		want         []string
+	}{
+		{"none", nil, http.StatusCreated, nil},
+		{"normalized", []string{"Go", "docker", "go"}, http.StatusCreated, []string{"docker", "go"}},
+		{"invalid label", []string{"node.js"}, http.StatusBadRequest, nil},
+		{"too many", []string{"a", "b", "c", "d"}, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskQueue = NewTaskQueue()
+			registerTestRepository("/test/repo")
+
+			body, _ := json.Marshal(CreateTaskRequest{
+				IssueID:      "2",
+				Repository:   "/test/repo",
+				TaskFilePath: "/test/repo/docs/task/2-test.md",
+				Capabilities: tt.capabilities,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			CreateTaskHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if taskQueue.Size() != 0 {
+					t.Errorf("Expected rejected task not to be queued")
+				}
+				return
+			}
+
+			var task Task
+			if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if !reflect.DeepEqual(task.Capabilities, tt.want) {
+				t.Errorf("Expected capabilities %v, got %v", tt.want, task.Capabilities)
+			}
+		})
+	}
+}
+
 // TestGetTaskHandler tests getting a specific task
 func TestGetTaskHandler(t *testing.T) {
 	taskQueue = NewTaskQueue()
@@ -270,7 +326,7 @@ func TestUpdateTaskStatusHandler(t *testing.T) {
 	taskQueue.Enqueue(task)
 
 	updateReq := UpdateTaskStatusRequest{
-		Status: StatusInProgress,
+		Status: StatusProcessing,
 	}
 
 	body, err := json.Marshal(updateReq)
@@ -300,8 +356,40 @@ func TestUpdateTaskStatusHandler(t *testing.T) {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	if updatedTask.Status != StatusInProgress {
-		t.Errorf("Expected status '%s', got '%s'", StatusInProgress, updatedTask.Status)
+	if updatedTask.Status != StatusProcessing {
+		t.Errorf("Expected status '%s', got '%s'", StatusProcessing, updatedTask.Status)
+	}
+}
+
+// TestUpdateTaskStatusHandlerTransitions tests legacy statuses and rejected transitions
+func TestUpdateTaskStatusHandlerTransitions(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	taskQueue.Enqueue(&Task{ID: "123", IssueID: "2", Status: StatusPending})
+
+	tests := []struct {
+		status     string
+		wantCode   int
+		wantStatus string
+	}{
+		{"in_progress", http.StatusOK, StatusProcessing},
+		{"unknown", http.StatusBadRequest, StatusProcessing},
+		{StatusCompleted, http.StatusOK, StatusCompleted},
+		{StatusPending, http.StatusConflict, StatusCompleted},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(UpdateTaskStatusRequest{Status: tt.status})
+		req := httptest.NewRequest("PATCH", "/api/tasks/123/status", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		UpdateTaskStatusHandler(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("Status %q: expected code %d, got %d", tt.status, tt.wantCode, rr.Code)
+		}
+		if got := taskQueue.GetTaskByID("123").Status; got != tt.wantStatus {
+			t.Errorf("Status %q: expected task status %s, got %s", tt.status, tt.wantStatus, got)
+		}
 	}
 }
 
@@ -350,3 +438,46 @@ func TestDeleteTaskHandlerNotFound(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
 	}
 }
+
+// TestConvertTaskToAgentEvent tests the agent.task.new event built from a task
+func TestConvertTaskToAgentEvent(t *testing.T) {
+	taskFile := filepath.Join(t.TempDir(), "7-bridge.md")
+	content := []byte("# Bridge task\n- Publish agent.task.new\n")
+	if err := os.WriteFile(taskFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task := &Task{
+		ID:           "task-7",
+		IssueID:      "7",
+		Repository:   filepath.Dir(taskFile),
+		TaskFilePath: taskFile,
+		Status:       StatusPending,
+		CreatedAt:    time.Now(),
+	}
+
+	event := convertTaskToAgentEvent(task)
+
+	if event.TaskID != task.ID {
+		t.Errorf("Expected task ID '%s', got '%s'", task.ID, event.TaskID)
+	}
+
+	if event.SizeBytes != int64(len(content)) {
+		t.Errorf("Expected size %d, got %d", len(content), event.SizeBytes)
+	}
+
+	if !event.CreatedAt.Equal(task.CreatedAt) {
+		t.Errorf("Expected created_at %v, got %v", task.CreatedAt, event.CreatedAt)
+	}
+}
+
+// TestTaskFileSizeMissingFile tests that unreadable task files report an unknown size
+func TestTaskFileSizeMissingFile(t *testing.T) {
+	if size := taskFileSize("/nonexistent/docs/task/1-missing.md"); size != 0 {
+		t.Errorf("Expected size 0 for missing file, got %d", size)
+	}
+
+	if size := taskFileSize(t.TempDir()); size != 0 {
+		t.Errorf("Expected size 0 for directory, got %d", size)
+	}
+}
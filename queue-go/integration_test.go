@@ -13,6 +13,7 @@ import (
 func TestQueueFullWorkflow(t *testing.T) {
 	// Initialize fresh queue
 	taskQueue = NewTaskQueue()
+	registerTestRepository("/repo1", "/repo2")
 
 	// Create a test server
 	mux := http.NewServeMux()
@@ -126,6 +127,7 @@ func TestQueueFullWorkflow(t *testing.T) {
 // TestConcurrentTaskCreation tests creating tasks concurrently
 func TestConcurrentTaskCreation(t *testing.T) {
 	taskQueue = NewTaskQueue()
+	registerTestRepository("/repo")
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/tasks", CreateTaskHandler)
@@ -186,13 +188,13 @@ func TestTaskLifecycle(t *testing.T) {
 
 	// Update to in-progress
 	time.Sleep(10 * time.Millisecond)
-	err := taskQueue.UpdateTaskStatus("lifecycle-test", StatusInProgress)
+	err := taskQueue.UpdateTaskStatus("lifecycle-test", StatusProcessing)
 	if err != nil {
 		t.Fatalf("Failed to update to in-progress: %v", err)
 	}
 
-	if task.Status != StatusInProgress {
-		t.Errorf("Expected status %s, got %s", StatusInProgress, task.Status)
+	if task.Status != StatusProcessing {
+		t.Errorf("Expected status %s, got %s", StatusProcessing, task.Status)
 	}
 
 	// Update to completed
@@ -252,7 +254,7 @@ func TestErrorHandling(t *testing.T) {
 	taskQueue = NewTaskQueue()
 
 	// Test updating non-existent task
-	err := taskQueue.UpdateTaskStatus("nonexistent", StatusInProgress)
+	err := taskQueue.UpdateTaskStatus("nonexistent", StatusProcessing)
 	if err == nil {
 		t.Error("Expected error when updating non-existent task")
 	}
@@ -324,7 +326,7 @@ func TestQueueStatusCalculations(t *testing.T) {
 	// Add tasks with different statuses
 	taskQueue.Enqueue(&Task{ID: "1", IssueID: "1", Status: StatusPending})
 	taskQueue.Enqueue(&Task{ID: "2", IssueID: "2", Status: StatusPending})
-	taskQueue.Enqueue(&Task{ID: "3", IssueID: "3", Status: StatusInProgress})
+	taskQueue.Enqueue(&Task{ID: "3", IssueID: "3", Status: StatusProcessing})
 	taskQueue.Enqueue(&Task{ID: "4", IssueID: "4", Status: StatusCompleted})
 	taskQueue.Enqueue(&Task{ID: "5", IssueID: "5", Status: StatusFailed})
 
@@ -353,8 +355,8 @@ func TestQueueStatusCalculations(t *testing.T) {
 		t.Errorf("Expected 2 pending tasks, got %d", status.PendingTasks)
 	}
 
-	if status.InProgressTasks != 1 {
-		t.Errorf("Expected 1 in-progress task, got %d", status.InProgressTasks)
+	if status.ProcessingTasks != 1 {
+		t.Errorf("Expected 1 processing task, got %d", status.ProcessingTasks)
 	}
 
 	if status.CompletedTasks != 1 {
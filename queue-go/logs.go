@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"contracts-go/model"
+	"contracts-go/tasklogs"
+
+	natsClient "queue-go/nats"
+)
+
+const (
+	// logStreamCheckInterval is how often a tailed task's status is checked
+	logStreamCheckInterval = 5 * time.Second
+
+	// logStreamIdleTimeout ends log streams that received no chunk for this long
+	logStreamIdleTimeout = 10 * time.Minute
+)
+
+// Reasons watchLogStream ends a log stream for
+const (
+	logStreamFinished = "finished"
+	logStreamIdle     = "idle"
+)
+
+// GetTaskLogHandler returns the captured pipeline output of a task as plain text
+func GetTaskLogHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
+	taskID := strings.Split(path, "/")[0]
+
+	if !natsAvailable(w) {
+		return
+	}
+
+	output, err := nats.GetTaskLog(taskID)
+	if errors.Is(err, tasklogs.ErrNotFound) {
+		http.Error(w, "Task log not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get log of task %s: %v", taskID, err)
+		http.Error(w, "Failed to get task log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
+}
+
+// StreamTaskLogHandler tails the pipeline output of a task over Server-Sent
+// Events. Each chunk is sent as a "log" event; an "end" event carrying the exit
+// code closes the stream once the run finished. Streams also end once the task
+// is finished in the queue without a final chunk, or after logStreamIdleTimeout
+// without output.
+func StreamTaskLogHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
+	taskID := strings.Split(path, "/")[0]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if !natsAvailable(w) {
+		return
+	}
+
+	live, err := nats.HasTaskLogChunks(taskID)
+	if err != nil {
+		log.Printf("Failed to get log of task %s: %v", taskID, err)
+		http.Error(w, "Failed to get task log", http.StatusInternalServerError)
+		return
+	}
+
+	// Without retained chunks, tail tasks that haven't run yet and replay the
+	// saved log of older ones
+	var saved []byte
+	if task := taskQueue.GetTaskByID(taskID); !live && (task == nil || !model.IsActive(task.Status)) {
+		saved, err = nats.GetTaskLog(taskID)
+		if errors.Is(err, tasklogs.ErrNotFound) {
+			http.Error(w, "Task log not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get log of task %s: %v", taskID, err)
+			http.Error(w, "Failed to get task log", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if saved != nil {
+		// The exit code is no longer known once the run's chunks expired
+		writeSSE(w, "log", &natsClient.LogChunk{TaskID: taskID, Data: string(saved), Time: time.Now()})
+		writeSSE(w, "end", &natsClient.LogChunk{TaskID: taskID, Final: true, Time: time.Now()})
+		flusher.Flush()
+		return
+	}
+
+	// The worker may never publish a final chunk, e.g. when it crashed
+	var mu sync.Mutex
+	lastChunk := time.Now()
+	tailCtx, stopTail := context.WithCancel(r.Context())
+	defer stopTail()
+	reason := make(chan string, 1)
+	go func() {
+		reason <- watchLogStream(tailCtx, taskID, func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return lastChunk
+		}, logStreamCheckInterval, logStreamIdleTimeout)
+		stopTail()
+	}()
+
+	err = nats.TailTaskLog(tailCtx, taskID, func(chunk *natsClient.LogChunk) error {
+		mu.Lock()
+		lastChunk = time.Now()
+		mu.Unlock()
+
+		event := "log"
+		if chunk.Final {
+			event = "end"
+		}
+		if err := writeSSE(w, event, chunk); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	stopTail()
+
+	switch <-reason {
+	case logStreamFinished:
+		// The exit code is only known from the final chunk
+		end := &natsClient.LogChunk{TaskID: taskID, Final: true, Time: time.Now()}
+		if task := taskQueue.GetTaskByID(taskID); task != nil {
+			end.Error = task.ErrorMessage
+		}
+		writeSSE(w, "end", end)
+		flusher.Flush()
+		return
+	case logStreamIdle:
+		log.Printf("Stopped tailing log of task %s: no output for %v", taskID, logStreamIdleTimeout)
+		return
+	}
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("Stopped tailing log of task %s: %v", taskID, err)
+	}
+}
+
+// watchLogStream checks every interval whether the log stream of a task should
+// end: once the task is no longer active in the queue on two checks in a row,
+// leaving the worker time to publish the final chunk, or once lastChunk is
+// older than idleTimeout. It returns the reason, or an empty string when ctx
+// is cancelled first.
+func watchLogStream(ctx context.Context, taskID string, lastChunk func() time.Time, interval, idleTimeout time.Duration) string {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	finished := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-ticker.C:
+		}
+
+		if time.Since(lastChunk()) > idleTimeout {
+			return logStreamIdle
+		}
+
+		task := taskQueue.GetTaskByID(taskID)
+		if task != nil && model.IsActive(task.Status) {
+			finished = false
+			continue
+		}
+		if finished {
+			return logStreamFinished
+		}
+		finished = true
+	}
+}
+
+// writeSSE writes one Server-Sent Event with data encoded as JSON
+func writeSSE(w io.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"contracts-go/model"
+
+	natsClient "queue-go/nats"
+)
+
+// TestTaskLogHandlersWithoutNATS tests that task log endpoints report an unavailable queue
+func TestTaskLogHandlersWithoutNATS(t *testing.T) {
+	nats = nil
+
+	tests := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"fetch", "/api/tasks/task-1/logs", GetTaskLogHandler},
+		{"stream", "/api/tasks/task-1/logs/stream", StreamTaskLogHandler},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusServiceUnavailable, rr.Code)
+		}
+	}
+}
+
+// TestWriteSSE tests Server-Sent Event framing
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSSE(&buf, "end", &natsClient.LogChunk{TaskID: "task-1", Final: true, ExitCode: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "event: end\ndata: {\"task_id\":\"task-1\",\"final\":true,\"exit_code\":2,\"time\":\"0001-01-01T00:00:00Z\"}\n\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+// TestWatchLogStream tests ending log streams of finished tasks and idle streams
+func TestWatchLogStream(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	task := &Task{ID: "task-1", Status: model.StatusProcessing}
+	taskQueue.Enqueue(task)
+	now := func() time.Time { return time.Now() }
+
+	// Running tasks are tailed until ctx is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if got := watchLogStream(ctx, "task-1", now, 5*time.Millisecond, time.Hour); got != "" {
+		t.Errorf("Expected the stream of a running task to continue, got %q", got)
+	}
+
+	tests := []struct {
+		name      string
+		status    string
+		lastChunk func() time.Time
+		want      string
+	}{
+		{"finished", model.StatusCompleted, now, logStreamFinished},
+		{"idle", model.StatusProcessing, func() time.Time { return time.Now().Add(-time.Minute) }, logStreamIdle},
+	}
+
+	for _, tt := range tests {
+		task.Status = tt.status
+		if got := watchLogStream(context.Background(), "task-1", tt.lastChunk, 5*time.Millisecond, time.Second); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	// Tasks missing from the queue are finished
+	if got := watchLogStream(context.Background(), "missing", now, 5*time.Millisecond, time.Hour); got != logStreamFinished {
+		t.Errorf("Expected the stream of an unknown task to end, got %q", got)
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
+
+	"contracts-go/backoff"
+	"contracts-go/repos"
 
 	natsClient "queue-go/nats"
 )
@@ -16,6 +24,9 @@ var taskQueue *TaskQueue
 // Global NATS client
 var nats *natsClient.Client
 
+// Global repository watcher, nil when WATCH_ENABLED is false
+var watcher *Watcher
+
 func main() {
 	// Initialize task queue
 	taskQueue = NewTaskQueue()
@@ -35,6 +46,54 @@ func main() {
 
 	log.Println("Successfully initialized NATS JetStream client")
 
+	// Name this replica's consumers after INSTANCE_ID (defaults to the hostname)
+	if instanceID := os.Getenv("INSTANCE_ID"); instanceID != "" {
+		nats.SetInstanceID(instanceID)
+	}
+
+	// Configure redelivery backoff for failed messages
+	policy, err := backoff.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid backoff configuration: %v", err)
+	}
+	nats.SetBackoffPolicy(policy)
+
+	// Dead-letter tasks whose deliveries all timed out
+	if _, err := nats.WatchMaxDeliveries(); err != nil {
+		log.Printf("Warning: Failed to watch max deliveries: %v", err)
+	}
+
+	// Keep this replica's task list in sync with the tasks created, updated and
+	// deleted through any instance, and with the statuses reported by workers
+	if _, err := nats.SubscribeToTaskCreated(HandleTaskCreated); err != nil {
+		log.Printf("Warning: Failed to subscribe to task.new events: %v", err)
+	}
+	if _, err := nats.SubscribeToStatusUpdates(HandleStatusUpdate); err != nil {
+		log.Printf("Warning: Failed to subscribe to status updates: %v", err)
+	}
+	if _, err := nats.SubscribeToDeletes(HandleTaskDelete); err != nil {
+		log.Printf("Warning: Failed to subscribe to deletes: %v", err)
+	}
+	if _, err := nats.SubscribeToCancels(HandleTaskCancel); err != nil {
+		log.Printf("Warning: Failed to subscribe to cancels: %v", err)
+	}
+
+	// Enqueue the task files of registered repositories
+	watcher, err = watcherFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid watcher configuration: %v", err)
+	}
+	if watcher != nil {
+		go watcher.Run(context.Background())
+	}
+
+	// Keep the repository registry in sync with the REPOSITORIES bucket, which
+	// also watches every registered repository that is not paused
+	if _, err := nats.WatchRepositories(applyRepository); err != nil {
+		log.Printf("Warning: Failed to watch repositories: %v", err)
+	}
+	registerRepositoriesFromEnv()
+
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -62,7 +121,14 @@ func main() {
 	http.HandleFunc("/api/tasks/", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			GetTaskHandler(w, r)
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/logs/stream"):
+				StreamTaskLogHandler(w, r)
+			case strings.HasSuffix(r.URL.Path, "/logs"):
+				GetTaskLogHandler(w, r)
+			default:
+				GetTaskHandler(w, r)
+			}
 		case http.MethodPatch:
 			UpdateTaskStatusHandler(w, r)
 		case http.MethodDelete:
@@ -72,6 +138,69 @@ func main() {
 		}
 	})
 
+	http.HandleFunc("/api/workers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ListWorkersHandler(w, r)
+	})
+
+	http.HandleFunc("/api/dlq", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			ListDeadLettersHandler(w, r)
+		case http.MethodDelete:
+			PurgeDeadLettersHandler(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/dlq/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetDeadLetterHandler(w, r)
+		case http.MethodPost:
+			RequeueDeadLetterHandler(w, r)
+		case http.MethodDelete:
+			DeleteDeadLetterHandler(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/repositories", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			ListRepositoriesHandler(w, r)
+		case http.MethodPost:
+			CreateRepositoryHandler(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/repositories/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			GetRepositoryHandler(w, r)
+		case http.MethodPatch:
+			UpdateRepositoryHandler(w, r)
+		case http.MethodDelete:
+			DeleteRepositoryHandler(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/watcher", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ListWatchedRepositoriesHandler(w, r)
+	})
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
@@ -83,12 +212,69 @@ func main() {
 	log.Printf("  GET  /health - Health check")
 	log.Printf("  GET  /api/queue/status - Get queue status")
 	log.Printf("  GET  /api/tasks - List all tasks")
-	log.Printf("  POST /api/tasks - Create a new task (publishes to NATS)")
+	log.Printf("  POST /api/tasks - Create a new task for a registered repository (publishes to NATS)")
 	log.Printf("  GET  /api/tasks/{id} - Get task by ID")
-	log.Printf("  PATCH /api/tasks/{id}/status - Update task status (publishes to NATS)")
-	log.Printf("  DELETE /api/tasks/{id} - Delete task (publishes to NATS)")
+	log.Printf("  GET  /api/tasks/{id}/logs - Get the pipeline output of a task")
+	log.Printf("  GET  /api/tasks/{id}/logs/stream - Tail the pipeline output of a task (Server-Sent Events)")
+	log.Printf("  PATCH /api/tasks/{id}/status - Update task status (publishes to NATS, cancelled stops the worker)")
+	log.Printf("  DELETE /api/tasks/{id} - Delete task (publishes to NATS, cancels unfinished tasks)")
+	log.Printf("  GET  /api/workers - List registered workers")
+	log.Printf("  GET  /api/dlq - List dead letters")
+	log.Printf("  DELETE /api/dlq - Purge dead letters")
+	log.Printf("  GET  /api/dlq/{seq} - Inspect a dead letter")
+	log.Printf("  POST /api/dlq/{seq}/requeue - Requeue a dead letter")
+	log.Printf("  DELETE /api/dlq/{seq} - Delete a dead letter")
+	log.Printf("  GET  /api/repositories - List registered repositories")
+	log.Printf("  POST /api/repositories - Register a git repository")
+	log.Printf("  GET  /api/repositories/{id} - Get a repository by ID")
+	log.Printf("  PATCH /api/repositories/{id} - Update repository settings, pause or resume it")
+	log.Printf("  DELETE /api/repositories/{id} - Unregister a repository")
+	log.Printf("  GET  /api/watcher - List repositories watched for task files")
 
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// watcherFromEnv creates the watcher of registered repositories, polling every
+// WATCH_POLL_INTERVAL when file notifications are unavailable or WATCH_POLLING
+// is true. It returns nil when WATCH_ENABLED is false.
+func watcherFromEnv() (*Watcher, error) {
+	if os.Getenv("WATCH_ENABLED") == "false" {
+		return nil, nil
+	}
+
+	interval := DefaultWatchPollInterval
+	if value := os.Getenv("WATCH_POLL_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid WATCH_POLL_INTERVAL: %q", value)
+		}
+		interval = parsed
+	}
+
+	return NewWatcher(interval, os.Getenv("WATCH_POLLING") == "true"), nil
+}
+
+// registerRepositoriesFromEnv registers the comma-separated repository paths in
+// WATCH_REPOSITORIES with the default settings, keeping the settings of
+// repositories that are already registered
+func registerRepositoriesFromEnv() {
+	for _, path := range strings.Split(os.Getenv("WATCH_REPOSITORIES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		repo := repos.New(path)
+		err := repo.Validate()
+		if err == nil {
+			err = validateRepositoryPath(repo.Path)
+		}
+		if err == nil {
+			err = registerRepository(repo)
+		}
+		if err != nil && !errors.Is(err, repos.ErrExists) {
+			log.Printf("Warning: Failed to register %s: %v", path, err)
+		}
+	}
+}
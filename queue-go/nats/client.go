@@ -3,27 +3,57 @@ package nats
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
+	"contracts-go/backoff"
+	"contracts-go/subjects"
+
 	"github.com/nats-io/nats.go"
 )
 
+// Stream, subject and consumer names are shared with the other services via contracts-go
 const (
 	// Stream and subject names
-	StreamName        = "TASKS"
-	SubjectTaskNew    = "tasks.new"
-	SubjectTaskUpdate = "tasks.update"
-	SubjectTaskDelete = "tasks.delete"
-	SubjectTaskStatus = "tasks.status"
+	StreamName        = subjects.StreamTasks
+	SubjectTaskNew    = subjects.TaskNew
+	SubjectTaskUpdate = subjects.TaskUpdate
+	SubjectTaskDelete = subjects.TaskDelete
+	SubjectTaskStatus = subjects.TaskStatus
+	SubjectTaskCancel = subjects.TaskCancel
 
 	// Consumer name
-	ConsumerName = "task-workers"
+	ConsumerName = subjects.ConsumerTaskWorkers
+
+	// MaxDeliver is the number of delivery attempts before a message is dead-lettered
+	MaxDeliver = 3
+
+	// AckWait is how long JetStream waits for an acknowledgment before redelivering
+	AckWait = 30 * time.Second
+
+	// Task events stream, consumed by every replica
+	EventsStreamName = subjects.StreamTaskEvents
+
+	// InstanceConsumerTTL is how long a replica's consumers survive without a subscriber
+	InstanceConsumerTTL = time.Hour
+
+	// Dead letter stream
+	DLQStreamName = subjects.StreamTasksDLQ
+
+	// Agent Intel Service stream and subjects
+	AgentStreamName     = subjects.StreamAgent
+	SubjectAgentTaskNew = subjects.AgentTaskNew
+
+	// Pipeline output stream
+	LogsStreamName = subjects.StreamLogs
 )
 
 // Client wraps NATS JetStream connection
 type Client struct {
-	nc *nats.Conn
-	js nats.JetStreamContext
+	nc       *nats.Conn
+	js       nats.JetStreamContext
+	backoff  backoff.Policy
+	instance string // Replica identity used to name per-instance consumers
 }
 
 // NewClient creates a new NATS client and establishes connection
@@ -53,9 +83,12 @@ func NewClient(url string) (*Client, error) {
 		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
 	}
 
+	instance, _ := os.Hostname()
 	client := &Client{
-		nc: nc,
-		js: js,
+		nc:       nc,
+		js:       js,
+		backoff:  backoff.Default(),
+		instance: instance,
 	}
 
 	// Initialize streams
@@ -64,48 +97,59 @@ func NewClient(url string) (*Client, error) {
 		return nil, fmt.Errorf("failed to initialize streams: %w", err)
 	}
 
+	// Fail fast if a subject we publish on is not captured by its stream,
+	// otherwise JetStream would drop the events silently
+	if err := subjects.VerifyPublished(js, subjects.ServiceQueue); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("subject contract violated: %w", err)
+	}
+
 	log.Printf("Successfully connected to NATS at %s", url)
 	return client, nil
 }
 
-// initializeStreams creates or updates the required JetStream streams
+// initializeStreams creates or updates the TASKS stream, the TASK_EVENTS stream,
+// the dead letter stream, the AGENT stream consumed by agent-intel-go, so
+// task.new events are not dropped when queue-go starts before agent-intel-go,
+// and the LOGS stream tailed for task output
 func (c *Client) initializeStreams() error {
-	// Define the TASKS stream configuration
-	streamConfig := &nats.StreamConfig{
-		Name:        StreamName,
-		Description: "Task queue for Agent666",
-		Subjects:    []string{"tasks.*"},
-		Retention:   nats.WorkQueuePolicy, // Messages deleted after acknowledgment
-		MaxAge:      7 * 24 * time.Hour,   // Keep messages for 7 days max
-		Storage:     nats.FileStorage,     // Persist to disk
-		Replicas:    1,                    // Single replica for now
-		Discard:     nats.DiscardOld,      // Discard old messages when limits reached
+	c.removeLegacyConsumers()
+
+	for _, name := range []string{StreamName, EventsStreamName, DLQStreamName, AgentStreamName, LogsStreamName} {
+		if err := subjects.EnsureStream(c.js, name); err != nil {
+			return err
+		}
+		log.Printf("Stream %s is ready", name)
 	}
 
-	// Try to get existing stream info
-	_, err := c.js.StreamInfo(StreamName)
-	if err != nil {
-		// Stream doesn't exist, create it
-		if err == nats.ErrStreamNotFound {
-			log.Printf("Creating stream: %s", StreamName)
-			_, err = c.js.AddStream(streamConfig)
-			if err != nil {
-				return fmt.Errorf("failed to create stream: %w", err)
-			}
-			log.Printf("Stream %s created successfully", StreamName)
-		} else {
-			return fmt.Errorf("failed to get stream info: %w", err)
+	return nil
+}
+
+// removeLegacyConsumers deletes the shared status and delete consumers from the
+// TASKS stream. Status updates and deletes moved to TASK_EVENTS, where each
+// replica has its own consumers.
+func (c *Client) removeLegacyConsumers() {
+	for _, name := range []string{subjects.ConsumerStatusUpdates, subjects.ConsumerTaskDeletes} {
+		err := c.js.DeleteConsumer(StreamName, name)
+		if err == nil {
+			log.Printf("Removed legacy consumer %s from stream %s", name, StreamName)
+			continue
 		}
-	} else {
-		// Stream exists, update it
-		log.Printf("Stream %s already exists, updating configuration", StreamName)
-		_, err = c.js.UpdateStream(streamConfig)
-		if err != nil {
-			log.Printf("Warning: failed to update stream: %v", err)
+		if err != nats.ErrConsumerNotFound && err != nats.ErrStreamNotFound {
+			log.Printf("Warning: failed to remove legacy consumer %s: %v", name, err)
 		}
 	}
+}
 
-	return nil
+// SetInstanceID sets the replica identity used to name per-instance consumers
+// (defaults to the hostname). It must be called before subscribing.
+func (c *Client) SetInstanceID(id string) {
+	c.instance = id
+}
+
+// instanceConsumer returns the durable name of this replica's consumer
+func (c *Client) instanceConsumer(consumer string) string {
+	return subjects.InstanceConsumer(consumer, c.instance)
 }
 
 // CreateConsumer creates a durable consumer for processing tasks
@@ -114,8 +158,9 @@ func (c *Client) CreateConsumer() error {
 		Durable:       ConsumerName,
 		Description:   "Durable consumer for processing tasks",
 		AckPolicy:     nats.AckExplicitPolicy, // Require explicit acknowledgment
-		MaxDeliver:    3,                      // Maximum delivery attempts
-		AckWait:       30 * time.Second,       // Wait 30s for acknowledgment
+		MaxDeliver:    MaxDeliver,             // Maximum delivery attempts
+		AckWait:       AckWait,                // Wait 30s for acknowledgment
+		BackOff:       c.backoffSchedule(),    // Redelivery delays for unacknowledged messages
 		DeliverPolicy: nats.DeliverNewPolicy,  // Only deliver new messages
 		FilterSubject: SubjectTaskNew,         // Only subscribe to new tasks
 		MaxAckPending: 100,                    // Max unacknowledged messages
@@ -136,12 +181,28 @@ func (c *Client) CreateConsumer() error {
 			return fmt.Errorf("failed to get consumer info: %w", err)
 		}
 	} else {
-		log.Printf("Consumer %s already exists", ConsumerName)
+		// Consumer exists, update it so backoff changes take effect
+		log.Printf("Consumer %s already exists, updating configuration", ConsumerName)
+		_, err = c.js.UpdateConsumer(StreamName, consumerConfig)
+		if err != nil {
+			log.Printf("Warning: failed to update consumer: %v", err)
+		}
 	}
 
 	return nil
 }
 
+// SetBackoffPolicy sets the policy used to delay redelivery of failed messages.
+// It must be called before subscribing so consumers are created with its schedule.
+func (c *Client) SetBackoffPolicy(policy backoff.Policy) {
+	c.backoff = policy
+}
+
+// backoffSchedule returns the consumer BackOff schedule of the configured policy
+func (c *Client) backoffSchedule() []time.Duration {
+	return backoff.Schedule(c.backoff, AckWait, MaxDeliver)
+}
+
 // Close closes the NATS connection
 func (c *Client) Close() {
 	if c.nc != nil {
@@ -1,6 +1,7 @@
 package nats
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -60,6 +61,34 @@ func TestDeleteMessage(t *testing.T) {
 	}
 }
 
+func TestTaskNewEvent(t *testing.T) {
+	event := &TaskNewEvent{
+		TaskID:       "test-id",
+		IssueID:      "11",
+		Repository:   "/test/repo",
+		TaskFilePath: "/test/repo/docs/task/11-test.md",
+		SizeBytes:    2048,
+		CreatedAt:    time.Now(),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v", err)
+	}
+
+	// agent-intel-go decodes these exact field names
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+
+	for _, field := range []string{"task_id", "issue_id", "repository", "task_file_path", "size_bytes", "created_at"} {
+		if _, ok := decoded[field]; !ok {
+			t.Errorf("Expected field %s in task.new event", field)
+		}
+	}
+}
+
 func TestConstants(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -72,6 +101,9 @@ func TestConstants(t *testing.T) {
 		{"SubjectTaskDelete", SubjectTaskDelete, "tasks.delete"},
 		{"SubjectTaskStatus", SubjectTaskStatus, "tasks.status"},
 		{"ConsumerName", ConsumerName, "task-workers"},
+		{"AgentStreamName", AgentStreamName, "AGENT"},
+		{"SubjectAgentTaskNew", SubjectAgentTaskNew, "agent.task.new"},
+		{"DLQStreamName", DLQStreamName, "TASKS_DLQ"},
 	}
 
 	for _, tt := range tests {
@@ -82,3 +114,28 @@ func TestConstants(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxDeliveriesAdvisory(t *testing.T) {
+	if maxDeliveriesAdvisory != "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.TASKS.*" {
+		t.Errorf("Unexpected advisory subject %s", maxDeliveriesAdvisory)
+	}
+	for consumer, want := range map[string]bool{"task-workers": true, "task-workers-docker_go": true, "queue-task-new-a": false} {
+		if got := isTaskWorkersConsumer(consumer); got != want {
+			t.Errorf("isTaskWorkersConsumer(%q) = %v, want %v", consumer, got, want)
+		}
+	}
+
+	data := []byte(`{"type":"io.nats.jetstream.advisory.v1.max_deliver","stream":"TASKS","consumer":"task-workers","stream_seq":42,"deliveries":3}`)
+
+	var event maxDeliveriesEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Failed to unmarshal advisory: %v", err)
+	}
+
+	if event.Stream != StreamName || event.Consumer != ConsumerName {
+		t.Errorf("Expected %s/%s, got %s/%s", StreamName, ConsumerName, event.Stream, event.Consumer)
+	}
+	if event.StreamSeq != 42 || event.Deliveries != 3 {
+		t.Errorf("Expected sequence 42 with 3 deliveries, got %d with %d", event.StreamSeq, event.Deliveries)
+	}
+}
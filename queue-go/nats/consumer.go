@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 
+	"contracts-go/deadletter"
+	"contracts-go/subjects"
+
 	"github.com/nats-io/nats.go"
 )
 
@@ -57,8 +60,8 @@ func (c *Client) processMessage(msg *nats.Msg, handler TaskHandler) error {
 	var task TaskMessage
 	if err := json.Unmarshal(msg.Data, &task); err != nil {
 		log.Printf("Failed to unmarshal task message: %v", err)
-		// Acknowledge to remove bad message from queue
-		msg.Nak()
+		// Malformed messages will never succeed, move them to the dead letter stream
+		c.deadLetter(msg, deadletter.ReasonPoison, err)
 		return fmt.Errorf("failed to unmarshal: %w", err)
 	}
 
@@ -67,8 +70,8 @@ func (c *Client) processMessage(msg *nats.Msg, handler TaskHandler) error {
 	// Process the task
 	if err := handler(&task); err != nil {
 		log.Printf("Handler failed for task %s: %v", task.ID, err)
-		// Negative acknowledgment - message will be redelivered
-		msg.Nak()
+		// Negative acknowledgment - message will be redelivered until MaxDeliver
+		c.retryOrDeadLetter(msg, err)
 		return err
 	}
 
@@ -82,7 +85,8 @@ func (c *Client) processMessage(msg *nats.Msg, handler TaskHandler) error {
 	return nil
 }
 
-// SubscribeToStatusUpdates subscribes to task status updates
+// SubscribeToStatusUpdates subscribes this replica to task status updates
+// published by any instance or worker
 func (c *Client) SubscribeToStatusUpdates(handler func(*StatusUpdateMessage) error) (*nats.Subscription, error) {
 	subject := fmt.Sprintf("%s.*", SubjectTaskStatus)
 
@@ -90,18 +94,26 @@ func (c *Client) SubscribeToStatusUpdates(handler func(*StatusUpdateMessage) err
 		var update StatusUpdateMessage
 		if err := json.Unmarshal(msg.Data, &update); err != nil {
 			log.Printf("Failed to unmarshal status update: %v", err)
-			msg.Nak()
+			c.deadLetter(msg, deadletter.ReasonPoison, err)
 			return
 		}
 
 		if err := handler(&update); err != nil {
 			log.Printf("Handler failed for status update: %v", err)
-			msg.Nak()
+			c.retryOrDeadLetter(msg, err)
 			return
 		}
 
 		msg.Ack()
-	}, nats.Durable("status-updates"), nats.ManualAck())
+	},
+		nats.Durable(c.instanceConsumer(subjects.ConsumerStatusUpdates)),
+		nats.DeliverNew(),
+		nats.InactiveThreshold(InstanceConsumerTTL),
+		nats.ManualAck(),
+		nats.MaxDeliver(MaxDeliver),
+		nats.AckWait(AckWait),
+		nats.BackOff(c.backoffSchedule()),
+	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to subscribe to status updates: %w", err)
@@ -110,24 +122,32 @@ func (c *Client) SubscribeToStatusUpdates(handler func(*StatusUpdateMessage) err
 	return sub, nil
 }
 
-// SubscribeToDeletes subscribes to task deletion messages
+// SubscribeToDeletes subscribes this replica to task deletions published by any instance
 func (c *Client) SubscribeToDeletes(handler func(*DeleteMessage) error) (*nats.Subscription, error) {
 	sub, err := c.js.Subscribe(SubjectTaskDelete, func(msg *nats.Msg) {
 		var delMsg DeleteMessage
 		if err := json.Unmarshal(msg.Data, &delMsg); err != nil {
 			log.Printf("Failed to unmarshal delete message: %v", err)
-			msg.Nak()
+			c.deadLetter(msg, deadletter.ReasonPoison, err)
 			return
 		}
 
 		if err := handler(&delMsg); err != nil {
 			log.Printf("Handler failed for delete message: %v", err)
-			msg.Nak()
+			c.retryOrDeadLetter(msg, err)
 			return
 		}
 
 		msg.Ack()
-	}, nats.Durable("task-deletes"), nats.ManualAck())
+	},
+		nats.Durable(c.instanceConsumer(subjects.ConsumerTaskDeletes)),
+		nats.DeliverNew(),
+		nats.InactiveThreshold(InstanceConsumerTTL),
+		nats.ManualAck(),
+		nats.MaxDeliver(MaxDeliver),
+		nats.AckWait(AckWait),
+		nats.BackOff(c.backoffSchedule()),
+	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to subscribe to deletes: %w", err)
@@ -135,3 +155,106 @@ func (c *Client) SubscribeToDeletes(handler func(*DeleteMessage) error) (*nats.S
 
 	return sub, nil
 }
+
+// SubscribeToCancels subscribes this replica to task cancellations published
+// by any instance or agent-intel-go
+func (c *Client) SubscribeToCancels(handler func(*CancelMessage) error) (*nats.Subscription, error) {
+	sub, err := c.js.Subscribe(SubjectTaskCancel, func(msg *nats.Msg) {
+		var cancelMsg CancelMessage
+		if err := json.Unmarshal(msg.Data, &cancelMsg); err != nil {
+			log.Printf("Failed to unmarshal cancel message: %v", err)
+			c.deadLetter(msg, deadletter.ReasonPoison, err)
+			return
+		}
+
+		if err := handler(&cancelMsg); err != nil {
+			log.Printf("Handler failed for cancel message: %v", err)
+			c.retryOrDeadLetter(msg, err)
+			return
+		}
+
+		msg.Ack()
+	},
+		nats.Durable(c.instanceConsumer(subjects.ConsumerTaskCancels)),
+		nats.DeliverNew(),
+		nats.InactiveThreshold(InstanceConsumerTTL),
+		nats.ManualAck(),
+		nats.MaxDeliver(MaxDeliver),
+		nats.AckWait(AckWait),
+		nats.BackOff(c.backoffSchedule()),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to cancels: %w", err)
+	}
+
+	return sub, nil
+}
+
+// SubscribeToTaskCreated subscribes this replica to the agent.task.new events
+// published for tasks created through any instance
+func (c *Client) SubscribeToTaskCreated(handler func(*TaskNewEvent) error) (*nats.Subscription, error) {
+	sub, err := c.js.Subscribe(SubjectAgentTaskNew, func(msg *nats.Msg) {
+		var event TaskNewEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			// agent-intel-go owns poison handling on this stream, just skip it here
+			log.Printf("Failed to unmarshal task.new event: %v", err)
+			msg.Term()
+			return
+		}
+
+		if err := handler(&event); err != nil {
+			// Not dead-lettered, the event stays in the AGENT stream for agent-intel-go
+			log.Printf("Handler failed for task.new event: %v", err)
+			msg.Nak()
+			return
+		}
+
+		msg.Ack()
+	},
+		nats.Durable(c.instanceConsumer(subjects.ConsumerQueueTaskNew)),
+		nats.DeliverNew(),
+		nats.InactiveThreshold(InstanceConsumerTTL),
+		nats.ManualAck(),
+		nats.MaxDeliver(MaxDeliver),
+		nats.AckWait(AckWait),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to task.new events: %w", err)
+	}
+
+	return sub, nil
+}
+
+// retryOrDeadLetter Naks a failed message for redelivery after the backoff
+// delay, or moves it to the dead letter stream when it was on its last allowed delivery
+func (c *Client) retryOrDeadLetter(msg *nats.Msg, cause error) {
+	if deadletter.Exhausted(msg, MaxDeliver) {
+		c.deadLetter(msg, deadletter.ReasonMaxDeliver, cause)
+		return
+	}
+
+	attempt := 1
+	if meta, err := msg.Metadata(); err == nil {
+		attempt = int(meta.NumDelivered)
+	}
+
+	delay := c.backoff.Delay(attempt, cause)
+	if err := msg.NakWithDelay(delay); err != nil {
+		log.Printf("Failed to nak message on %s: %v", msg.Subject, err)
+		return
+	}
+
+	log.Printf("Message on %s will be redelivered in %v (attempt %d/%d)", msg.Subject, delay, attempt, MaxDeliver)
+}
+
+// deadLetter moves a message to the dead letter stream
+func (c *Client) deadLetter(msg *nats.Msg, reason string, cause error) {
+	if err := deadletter.Move(c.js, msg, reason, cause); err != nil {
+		log.Printf("Failed to dead-letter message on %s: %v", msg.Subject, err)
+		return
+	}
+
+	log.Printf("Message on %s moved to %s (reason: %s)", msg.Subject, DLQStreamName, reason)
+}
@@ -0,0 +1,222 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"contracts-go/deadletter"
+	"contracts-go/events"
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DeadLetter is a message moved to the TASKS_DLQ stream
+type DeadLetter = events.DeadLetter
+
+// deadLetterReadTimeout bounds the wait for each dead letter while listing them
+const deadLetterReadTimeout = 5 * time.Second
+
+// ErrDeadLetterNotFound is returned when no dead letter has the requested sequence
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// maxDeliveriesAdvisory is published by JetStream when a message of a task
+// consumer exceeded MaxDeliver without being acknowledged. Workers share one
+// consumer per capability route (task-workers, task-workers-go, ...), so all
+// TASKS consumers are watched and filtered with isTaskWorkersConsumer.
+var maxDeliveriesAdvisory = fmt.Sprintf("$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.%s.*", StreamName)
+
+// maxDeliveriesEvent is the payload of the max deliveries advisory
+type maxDeliveriesEvent struct {
+	Stream     string `json:"stream"`
+	Consumer   string `json:"consumer"`
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries uint64 `json:"deliveries"`
+}
+
+// WatchMaxDeliveries dead-letters tasks whose deliveries all timed out (e.g. the
+// worker crashed), which JetStream would otherwise stop delivering silently
+func (c *Client) WatchMaxDeliveries() (*nats.Subscription, error) {
+	sub, err := c.nc.Subscribe(maxDeliveriesAdvisory, func(msg *nats.Msg) {
+		var event maxDeliveriesEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			log.Printf("Failed to unmarshal max deliveries advisory: %v", err)
+			return
+		}
+		if !isTaskWorkersConsumer(event.Consumer) {
+			return
+		}
+
+		if err := c.deadLetterSequence(&event); err != nil {
+			log.Printf("Failed to dead-letter message %d: %v", event.StreamSeq, err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to max deliveries advisory: %w", err)
+	}
+
+	return sub, nil
+}
+
+// isTaskWorkersConsumer reports whether consumer is the worker consumer of a capability route
+func isTaskWorkersConsumer(consumer string) bool {
+	return consumer == ConsumerName || strings.HasPrefix(consumer, ConsumerName+"-")
+}
+
+// deadLetterSequence moves the message referenced by an advisory to the dead letter stream
+func (c *Client) deadLetterSequence(event *maxDeliveriesEvent) error {
+	raw, err := c.js.GetMsg(event.Stream, event.StreamSeq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		// Acknowledged or dead-lettered in the meantime
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+
+	dl := deadletter.New(&nats.Msg{Subject: raw.Subject, Data: raw.Data}, deadletter.ReasonMaxDeliver,
+		fmt.Errorf("not acknowledged after %d deliveries", event.Deliveries))
+	dl.Stream = event.Stream
+	dl.Consumer = event.Consumer
+	dl.StreamSequence = event.StreamSeq
+	dl.NumDelivered = event.Deliveries
+
+	if err := deadletter.Publish(c.js, dl); err != nil {
+		return err
+	}
+
+	if err := c.js.DeleteMsg(event.Stream, event.StreamSeq); err != nil && !errors.Is(err, nats.ErrMsgNotFound) {
+		return fmt.Errorf("failed to delete dead-lettered message: %w", err)
+	}
+
+	log.Printf("Message %d on %s moved to %s after %d deliveries", event.StreamSeq, raw.Subject, DLQStreamName, event.Deliveries)
+	return nil
+}
+
+// ListDeadLetters returns up to limit dead letters after skipping the first
+// offset, oldest first
+func (c *Client) ListDeadLetters(offset, limit int) ([]*DeadLetter, error) {
+	info, err := c.js.StreamInfo(DLQStreamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream info: %w", err)
+	}
+
+	deadLetters := make([]*DeadLetter, 0)
+	if info.State.Msgs <= uint64(offset) || limit <= 0 {
+		return deadLetters, nil
+	}
+
+	// Stream the dead letters through an ordered ephemeral consumer instead of
+	// requesting every sequence, most of which may be requeued or deleted
+	sub, err := c.js.SubscribeSync(subjects.DeadLetterTasks,
+		nats.BindStream(DLQStreamName),
+		nats.OrderedConsumer(),
+		nats.DeliverAll(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	for skipped := 0; len(deadLetters) < limit; {
+		msg, err := sub.NextMsg(deadLetterReadTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letter metadata: %w", err)
+		}
+
+		if skipped < offset {
+			skipped++
+		} else {
+			dl, err := decodeDeadLetter(meta.Sequence.Stream, msg.Data)
+			if err != nil {
+				return nil, err
+			}
+			deadLetters = append(deadLetters, dl)
+		}
+
+		if meta.NumPending == 0 {
+			break
+		}
+	}
+
+	return deadLetters, nil
+}
+
+// GetDeadLetter returns the dead letter stored at the given sequence
+func (c *Client) GetDeadLetter(seq uint64) (*DeadLetter, error) {
+	raw, err := c.js.GetMsg(DLQStreamName, seq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	return decodeDeadLetter(raw.Sequence, raw.Data)
+}
+
+// decodeDeadLetter decodes the dead letter stored at seq
+func decodeDeadLetter(seq uint64, data []byte) (*DeadLetter, error) {
+	var dl DeadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter %d: %w", seq, err)
+	}
+	dl.Sequence = seq
+
+	return &dl, nil
+}
+
+// RequeueDeadLetter republishes a dead letter on its original subject and
+// removes it from the dead letter stream
+func (c *Client) RequeueDeadLetter(seq uint64) (*DeadLetter, error) {
+	dl, err := c.GetDeadLetter(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	// No MsgId: the original publish may still be inside the deduplication window
+	if _, err := c.js.Publish(dl.Subject, dl.Data); err != nil {
+		return nil, fmt.Errorf("failed to requeue dead letter: %w", err)
+	}
+
+	if err := c.DeleteDeadLetter(seq); err != nil {
+		return nil, err
+	}
+
+	return dl, nil
+}
+
+// DeleteDeadLetter removes a single dead letter
+func (c *Client) DeleteDeadLetter(seq uint64) error {
+	err := c.js.DeleteMsg(DLQStreamName, seq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeDeadLetters removes all dead letters and returns how many were removed
+func (c *Client) PurgeDeadLetters() (uint64, error) {
+	info, err := c.js.StreamInfo(DLQStreamName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stream info: %w", err)
+	}
+
+	if err := c.js.PurgeStream(DLQStreamName); err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+
+	return info.State.Msgs, nil
+}
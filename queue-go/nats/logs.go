@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/subjects"
+	"contracts-go/tasklogs"
+
+	"github.com/nats-io/nats.go"
+)
+
+// LogChunk is defined in contracts-go/events
+type LogChunk = events.LogChunk
+
+// logReadTimeout bounds the wait for each published chunk while reading a log back
+const logReadTimeout = 5 * time.Second
+
+// GetTaskLog returns the complete log of a task saved by the worker that ran
+// it, or the output published so far while the task still runs. It returns
+// tasklogs.ErrNotFound when the task produced no log.
+func (c *Client) GetTaskLog(taskID string) ([]byte, error) {
+	var log []byte
+	store, err := tasklogs.OpenStore(c.js)
+	if err == nil {
+		log, err = tasklogs.Get(store, taskID)
+	}
+	if !errors.Is(err, tasklogs.ErrNotFound) {
+		return log, err
+	}
+
+	published, err := c.HasTaskLogChunks(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !published {
+		return nil, tasklogs.ErrNotFound
+	}
+
+	var output bytes.Buffer
+	err = c.readTaskLog(context.Background(), taskID, true, func(chunk *LogChunk) error {
+		output.WriteString(chunk.Data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// HasTaskLogChunks reports whether output of a task's last run is still
+// retained in the LOGS stream
+func (c *Client) HasTaskLogChunks(taskID string) (bool, error) {
+	_, err := c.js.GetLastMsg(LogsStreamName, subjects.TaskLogSubject(taskID))
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up log of task %s: %w", taskID, err)
+	}
+	return true, nil
+}
+
+// TailTaskLog calls fn with every chunk published for a task, from the start
+// of its last run, until the final chunk or until ctx is cancelled
+func (c *Client) TailTaskLog(ctx context.Context, taskID string, fn func(*LogChunk) error) error {
+	return c.readTaskLog(ctx, taskID, false, fn)
+}
+
+// readTaskLog reads the chunks of a task with an ordered consumer, stopping
+// after the final chunk, or once no chunk is pending when untilCaughtUp is set
+func (c *Client) readTaskLog(ctx context.Context, taskID string, untilCaughtUp bool, fn func(*LogChunk) error) error {
+	sub, err := c.js.SubscribeSync(subjects.TaskLogSubject(taskID),
+		nats.OrderedConsumer(),
+		nats.DeliverAll(),
+		nats.BindStream(LogsStreamName),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to read log of task %s: %w", taskID, err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		msgCtx := ctx
+		cancel := func() {}
+		if untilCaughtUp {
+			msgCtx, cancel = context.WithTimeout(ctx, logReadTimeout)
+		}
+		msg, err := sub.NextMsgWithContext(msgCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read log of task %s: %w", taskID, err)
+		}
+
+		var chunk LogChunk
+		if err := json.Unmarshal(msg.Data, &chunk); err != nil {
+			// Skip chunks that can't be decoded rather than losing the rest of the log
+			continue
+		}
+		if err := fn(&chunk); err != nil {
+			return err
+		}
+		if chunk.Final {
+			return nil
+		}
+
+		if untilCaughtUp {
+			if meta, err := msg.Metadata(); err == nil && meta.NumPending == 0 {
+				return nil
+			}
+		}
+	}
+}
@@ -5,36 +5,23 @@ import (
 	"fmt"
 	"time"
 
+	"contracts-go/events"
+	"contracts-go/subjects"
+
 	"github.com/nats-io/nats.go"
 )
 
-// TaskMessage represents a task message for NATS
-type TaskMessage struct {
-	ID           string    `json:"id"`
-	IssueID      string    `json:"issue_id"`
-	Repository   string    `json:"repository"`
-	TaskFilePath string    `json:"task_file_path"`
-	Status       string    `json:"status"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ErrorMessage string    `json:"error_message,omitempty"`
-}
-
-// StatusUpdateMessage represents a status update message
-type StatusUpdateMessage struct {
-	TaskID       string    `json:"task_id"`
-	Status       string    `json:"status"`
-	ErrorMessage string    `json:"error_message,omitempty"`
-	UpdatedAt    time.Time `json:"updated_at"`
-}
-
-// DeleteMessage represents a task deletion message
-type DeleteMessage struct {
-	TaskID    string    `json:"task_id"`
-	DeletedAt time.Time `json:"deleted_at"`
-}
+// Message payloads are defined in contracts-go/events
+type (
+	TaskMessage         = events.TaskMessage
+	StatusUpdateMessage = events.StatusUpdateMessage
+	DeleteMessage       = events.DeleteMessage
+	CancelMessage       = events.CancelMessage
+	TaskNewEvent        = events.TaskNewEvent
+)
 
-// PublishNewTask publishes a new task to the stream
+// PublishNewTask publishes a new task to the stream, on the subject routing it to
+// the workers declaring its required capabilities
 func (c *Client) PublishNewTask(task *TaskMessage) error {
 	data, err := json.Marshal(task)
 	if err != nil {
@@ -42,7 +29,7 @@ func (c *Client) PublishNewTask(task *TaskMessage) error {
 	}
 
 	// Publish to JetStream with message deduplication
-	_, err = c.js.Publish(SubjectTaskNew, data, nats.MsgId(task.ID))
+	_, err = c.js.Publish(subjects.TaskNewSubject(task.Capabilities), data, nats.MsgId(task.ID))
 	if err != nil {
 		return fmt.Errorf("failed to publish task: %w", err)
 	}
@@ -50,6 +37,22 @@ func (c *Client) PublishNewTask(task *TaskMessage) error {
 	return nil
 }
 
+// PublishAgentTaskNew publishes a task.new event for the Agent Intel Service
+func (c *Client) PublishAgentTaskNew(event *TaskNewEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task.new event: %w", err)
+	}
+
+	// Deduplicate on task ID so retried publishes are dropped by JetStream
+	_, err = c.js.Publish(SubjectAgentTaskNew, data, nats.MsgId(event.TaskID))
+	if err != nil {
+		return fmt.Errorf("failed to publish task.new event: %w", err)
+	}
+
+	return nil
+}
+
 // PublishTaskStatusUpdate publishes a task status update
 func (c *Client) PublishTaskStatusUpdate(update *StatusUpdateMessage) error {
 	data, err := json.Marshal(update)
@@ -57,7 +60,7 @@ func (c *Client) PublishTaskStatusUpdate(update *StatusUpdateMessage) error {
 		return fmt.Errorf("failed to marshal status update: %w", err)
 	}
 
-	subject := fmt.Sprintf("%s.%s", SubjectTaskStatus, update.Status)
+	subject := subjects.TaskStatusSubject(update.Status)
 	_, err = c.js.Publish(subject, data)
 	if err != nil {
 		return fmt.Errorf("failed to publish status update: %w", err)
@@ -86,6 +89,22 @@ func (c *Client) PublishTaskDelete(taskID string) error {
 	return nil
 }
 
+// PublishTaskCancel publishes a task cancellation, stopping the task on the
+// worker running it and in agent-intel-go
+func (c *Client) PublishTaskCancel(taskID, reason string) error {
+	data, err := json.Marshal(events.NewCancelMessage(taskID, reason))
+	if err != nil {
+		return fmt.Errorf("failed to marshal cancel message: %w", err)
+	}
+
+	_, err = c.js.Publish(SubjectTaskCancel, data)
+	if err != nil {
+		return fmt.Errorf("failed to publish cancel message: %w", err)
+	}
+
+	return nil
+}
+
 // GetStreamInfo returns information about the TASKS stream
 func (c *Client) GetStreamInfo() (*nats.StreamInfo, error) {
 	info, err := c.js.StreamInfo(StreamName)
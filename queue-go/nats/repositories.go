@@ -0,0 +1,92 @@
+package nats
+
+import (
+	"log"
+
+	"contracts-go/repos"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Repository is defined in contracts-go/repos
+type Repository = repos.Repository
+
+// CreateRepository registers a repository in the REPOSITORIES bucket, failing
+// with repos.ErrExists when it is already registered
+func (c *Client) CreateRepository(r *Repository) error {
+	kv, err := repos.EnsureBucket(c.js)
+	if err != nil {
+		return err
+	}
+	return repos.Create(kv, r)
+}
+
+// UpdateRepository applies change to the current record of a registered
+// repository and writes it back, failing with repos.ErrConflict when another
+// replica changed the record in between and with repos.ErrNotFound when it is
+// not registered
+func (c *Client) UpdateRepository(id string, change func(r *Repository) error) (*Repository, error) {
+	kv, err := repos.EnsureBucket(c.js)
+	if err != nil {
+		return nil, err
+	}
+
+	r, revision, err := repos.Get(kv, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(r); err != nil {
+		return nil, err
+	}
+	if err := repos.Update(kv, r, revision); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DeleteRepository unregisters a repository
+func (c *Client) DeleteRepository(id string) error {
+	kv, err := repos.EnsureBucket(c.js)
+	if err != nil {
+		return err
+	}
+	return repos.Delete(kv, id)
+}
+
+// WatchRepositories calls fn with every registered repository, then with every
+// change made through any replica. Removed repositories are passed as their ID
+// and a nil record.
+func (c *Client) WatchRepositories(fn func(id string, r *Repository)) (nats.KeyWatcher, error) {
+	kv, err := repos.EnsureBucket(c.js)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := kv.WatchAll()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for entry := range watcher.Updates() {
+			// A nil entry marks the end of the initial records
+			if entry == nil {
+				continue
+			}
+
+			if entry.Operation() != nats.KeyValuePut {
+				fn(entry.Key(), nil)
+				continue
+			}
+
+			r, err := repos.Decode(entry.Value())
+			if err != nil {
+				log.Printf("Warning: skipping repository %s: %v", entry.Key(), err)
+				continue
+			}
+			fn(entry.Key(), r)
+		}
+	}()
+
+	return watcher, nil
+}
@@ -0,0 +1,23 @@
+package nats
+
+import (
+	"errors"
+
+	"contracts-go/fleet"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ListWorkers returns the records of every worker in the WORKERS registry, none
+// when no worker created the registry yet
+func (c *Client) ListWorkers() ([]fleet.Worker, error) {
+	kv, err := fleet.OpenBucket(c.js)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		return []fleet.Worker{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fleet.List(kv)
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -15,6 +16,8 @@ import (
 
 	natsClient "queue-go/nats"
 
+	"contracts-go/repos"
+
 	"github.com/nats-io/nats.go"
 )
 
@@ -134,6 +137,7 @@ func TestAPIWithNATS(t *testing.T) {
 
 	// Initialize task queue and NATS
 	taskQueue = NewTaskQueue()
+	registerTestRepository("/test/repo")
 	var err error
 	nats, err = natsClient.NewClient(natsURL)
 	if err != nil {
@@ -197,7 +201,7 @@ func TestStatusUpdatePublish(t *testing.T) {
 	// Publish status update
 	update := &natsClient.StatusUpdateMessage{
 		TaskID:    "test-task-123",
-		Status:    "in_progress",
+		Status:    "processing",
 		UpdatedAt: time.Now(),
 	}
 
@@ -230,3 +234,56 @@ func TestDeletePublish(t *testing.T) {
 
 	t.Log("Delete message published successfully")
 }
+
+// TestRepositoriesWithNATS tests registering, updating and unregistering
+// repositories through the REPOSITORIES bucket
+func TestRepositoriesWithNATS(t *testing.T) {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		t.Skip("Skipping integration test: NATS_URL not set")
+	}
+
+	registerTestRepository()
+	var err error
+	nats, err = natsClient.NewClient(natsURL)
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer func() {
+		nats.Close()
+		nats = nil
+	}()
+
+	dir := newGitDir(t)
+	rr := serveRepositories(http.MethodPost, "/api/repositories", map[string]interface{}{"path": dir})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	id := repos.ID(dir)
+	defer nats.DeleteRepository(id)
+
+	rr = serveRepositories(http.MethodPatch, "/api/repositories/"+id, map[string]interface{}{"max_iterations": 10, "paused": true})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if repo := repositories.Get(id); !repo.Paused || repo.MaxIterations != 10 {
+		t.Errorf("Unexpected settings %+v", repo)
+	}
+
+	// A change written by another replica in between is not overwritten
+	_, err = nats.UpdateRepository(id, func(r *Repository) error {
+		_, err := nats.UpdateRepository(id, func(r *Repository) error {
+			r.GitHubEnabled = true
+			return nil
+		})
+		return err
+	})
+	if !errors.Is(err, repos.ErrConflict) {
+		t.Errorf("Expected repos.ErrConflict, got %v", err)
+	}
+
+	rr = serveRepositories(http.MethodDelete, "/api/repositories/"+id, nil)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+}
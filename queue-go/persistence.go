@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"contracts-go/model"
 )
 
 // QdrantClient handles interactions with Qdrant vector database
@@ -109,6 +111,7 @@ func (c *QdrantClient) SaveTask(task *Task) error {
 			"created_at":     task.CreatedAt.Format(time.RFC3339),
 			"updated_at":     task.UpdatedAt.Format(time.RFC3339),
 			"error_message":  task.ErrorMessage,
+			"capabilities":   task.Capabilities,
 		},
 	}
 
@@ -292,6 +295,10 @@ func (c *QdrantClient) payloadToTask(id string, payload map[string]interface{})
 	}
 
 	if status, ok := payload["status"].(string); ok {
+		// Tasks persisted before the shared status vocabulary may use legacy statuses
+		if normalized, err := model.NormalizeStatus(status); err == nil {
+			status = normalized
+		}
 		task.Status = status
 	}
 
@@ -313,6 +320,14 @@ func (c *QdrantClient) payloadToTask(id string, payload map[string]interface{})
 		task.ErrorMessage = errorMessage
 	}
 
+	if capabilities, ok := payload["capabilities"].([]interface{}); ok {
+		for _, capability := range capabilities {
+			if label, ok := capability.(string); ok {
+				task.Capabilities = append(task.Capabilities, label)
+			}
+		}
+	}
+
 	return task, nil
 }
 
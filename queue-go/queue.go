@@ -4,28 +4,25 @@ import (
 	"errors"
 	"log"
 	"sync"
-	"time"
+
+	"contracts-go/model"
 )
 
-// Task status constants
+// Task status constants (see contracts-go/model for the state machine)
 const (
-	StatusPending    = "pending"
-	StatusInProgress = "in_progress"
-	StatusCompleted  = "completed"
-	StatusFailed     = "failed"
+	StatusPending    = model.StatusPending
+	StatusAssigned   = model.StatusAssigned
+	StatusProcessing = model.StatusProcessing
+	StatusCompleted  = model.StatusCompleted
+	StatusFailed     = model.StatusFailed
+	StatusCancelled  = model.StatusCancelled
 )
 
+// ErrTaskNotFound is returned when a task is not in the queue
+var ErrTaskNotFound = errors.New("task not found")
+
 // Task represents a task in the queue
-type Task struct {
-	ID           string    `json:"id"`
-	IssueID      string    `json:"issue_id"`
-	Repository   string    `json:"repository"`
-	TaskFilePath string    `json:"task_file_path"`
-	Status       string    `json:"status"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ErrorMessage string    `json:"error_message,omitempty"`
-}
+type Task = model.Task
 
 // TaskQueue represents the queue of tasks
 type TaskQueue struct {
@@ -127,8 +124,16 @@ func (q *TaskQueue) GetTaskByID(id string) *Task {
 	return nil
 }
 
-// UpdateTaskStatus updates the status of a task
+// UpdateTaskStatus updates the status of a task, rejecting transitions the
+// task state machine doesn't allow
 func (q *TaskQueue) UpdateTaskStatus(id string, status string) error {
+	_, err := q.SetTaskStatus(id, status, "")
+	return err
+}
+
+// SetTaskStatus moves a task to status and records its error message, rejecting
+// transitions the task state machine doesn't allow. It reports whether the task changed.
+func (q *TaskQueue) SetTaskStatus(id, status, errorMessage string) (bool, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -136,23 +141,28 @@ func (q *TaskQueue) UpdateTaskStatus(id string, status string) error {
 
 	for _, task := range q.tasks {
 		if task.ID == id {
-			task.Status = status
-			task.UpdatedAt = time.Now()
 			updatedTask = task
 			break
 		}
 	}
 
 	if updatedTask == nil && q.currentTask != nil && q.currentTask.ID == id {
-		q.currentTask.Status = status
-		q.currentTask.UpdatedAt = time.Now()
 		updatedTask = q.currentTask
 	}
 
 	if updatedTask == nil {
-		return errors.New("task not found")
+		return false, ErrTaskNotFound
 	}
 
+	if updatedTask.Status == status && updatedTask.ErrorMessage == errorMessage {
+		return false, nil
+	}
+
+	if err := updatedTask.Transition(status); err != nil {
+		return false, err
+	}
+	updatedTask.ErrorMessage = errorMessage
+
 	// Update in Qdrant if persistence is enabled
 	if q.usePersistence {
 		if err := q.qdrant.UpdateTask(updatedTask); err != nil {
@@ -160,7 +170,7 @@ func (q *TaskQueue) UpdateTaskStatus(id string, status string) error {
 		}
 	}
 
-	return nil
+	return true, nil
 }
 
 // ListTasks returns all tasks in the queue
@@ -201,7 +211,7 @@ func (q *TaskQueue) RemoveTask(id string) error {
 		}
 	}
 
-	return errors.New("task not found")
+	return ErrTaskNotFound
 }
 
 // SetCurrentTask sets the current task being processed
@@ -154,14 +154,14 @@ func TestUpdateTaskStatus(t *testing.T) {
 	oldUpdateTime := task.UpdatedAt
 	time.Sleep(10 * time.Millisecond)
 
-	err := queue.UpdateTaskStatus("1", StatusInProgress)
+	err := queue.UpdateTaskStatus("1", StatusProcessing)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if task.Status != StatusInProgress {
-		t.Errorf("Expected status '%s', got '%s'", StatusInProgress, task.Status)
+	if task.Status != StatusProcessing {
+		t.Errorf("Expected status '%s', got '%s'", StatusProcessing, task.Status)
 	}
 
 	if !task.UpdatedAt.After(oldUpdateTime) {
@@ -173,7 +173,7 @@ func TestUpdateTaskStatus(t *testing.T) {
 func TestUpdateNonExistentTask(t *testing.T) {
 	queue := NewTaskQueue()
 
-	err := queue.UpdateTaskStatus("nonexistent", StatusInProgress)
+	err := queue.UpdateTaskStatus("nonexistent", StatusProcessing)
 
 	if err == nil {
 		t.Error("Expected error when updating non-existent task")
@@ -185,7 +185,7 @@ func TestListTasks(t *testing.T) {
 	queue := NewTaskQueue()
 
 	task1 := &Task{ID: "1", IssueID: "1", Status: StatusPending}
-	task2 := &Task{ID: "2", IssueID: "2", Status: StatusInProgress}
+	task2 := &Task{ID: "2", IssueID: "2", Status: StatusProcessing}
 
 	queue.Enqueue(task1)
 	queue.Enqueue(task2)
@@ -199,7 +199,7 @@ func TestListTasks(t *testing.T) {
 
 // TestTaskStatusConstants tests task status constants
 func TestTaskStatusConstants(t *testing.T) {
-	statuses := []string{StatusPending, StatusInProgress, StatusCompleted, StatusFailed}
+	statuses := []string{StatusPending, StatusProcessing, StatusCompleted, StatusFailed}
 
 	for _, status := range statuses {
 		if status == "" {
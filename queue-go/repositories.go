@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"contracts-go/repos"
+)
+
+// Repository is defined in contracts-go/repos
+type Repository = repos.Repository
+
+var (
+	// ErrRepositoryNotRegistered is returned for tasks of unknown repositories
+	ErrRepositoryNotRegistered = errors.New("repository is not registered")
+
+	// ErrRepositoryPaused is returned for tasks of paused repositories
+	ErrRepositoryPaused = errors.New("repository is paused")
+
+	// ErrRegistryUnavailable is returned when changing repositories without
+	// NATS, since changes only made locally would diverge from other replicas
+	ErrRegistryUnavailable = errors.New("repository registry is unavailable")
+)
+
+// CreateRepositoryRequest represents the request to register a repository
+type CreateRepositoryRequest struct {
+	Path          string `json:"path"`
+	GitHubEnabled bool   `json:"github_enabled"`
+	MaxIterations *int   `json:"max_iterations,omitempty"` // Defaults to repos.DefaultMaxIterations
+	Paused        bool   `json:"paused"`
+}
+
+// UpdateRepositoryRequest represents the request to change a repository's
+// settings; fields left out are kept
+type UpdateRepositoryRequest struct {
+	GitHubEnabled *bool `json:"github_enabled,omitempty"`
+	MaxIterations *int  `json:"max_iterations,omitempty"`
+	Paused        *bool `json:"paused,omitempty"`
+}
+
+// RepositoryRegistry is this replica's copy of the REPOSITORIES bucket
+type RepositoryRegistry struct {
+	mu    sync.RWMutex
+	repos map[string]*Repository // By repository ID
+}
+
+// Global repository registry
+var repositories = NewRepositoryRegistry()
+
+// NewRepositoryRegistry creates an empty repository registry
+func NewRepositoryRegistry() *RepositoryRegistry {
+	return &RepositoryRegistry{repos: make(map[string]*Repository)}
+}
+
+// List returns copies of the registered repositories sorted by path
+func (reg *RepositoryRegistry) List() []*Repository {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	list := make([]*Repository, 0, len(reg.repos))
+	for _, r := range reg.repos {
+		copied := *r
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+// Get returns a copy of a repository by ID, or nil if it is not registered
+func (reg *RepositoryRegistry) Get(id string) *Repository {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	r, ok := reg.repos[id]
+	if !ok {
+		return nil
+	}
+	copied := *r
+	return &copied
+}
+
+// Find returns a copy of the repository registered at path, or nil
+func (reg *RepositoryRegistry) Find(path string) *Repository {
+	return reg.Get(repos.ID(path))
+}
+
+// set stores a repository record
+func (reg *RepositoryRegistry) set(r *Repository) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	copied := *r
+	reg.repos[r.ID] = &copied
+}
+
+// remove drops a repository record and returns it, or nil if it was not registered
+func (reg *RepositoryRegistry) remove(id string) *Repository {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	r := reg.repos[id]
+	delete(reg.repos, id)
+	return r
+}
+
+// checkRepository returns an error unless the repository at path is
+// registered and not paused
+func checkRepository(path string) error {
+	r := repositories.Find(path)
+	if r == nil {
+		return ErrRepositoryNotRegistered
+	}
+	if r.Paused {
+		return ErrRepositoryPaused
+	}
+	return nil
+}
+
+// registerRepository adds a repository to the REPOSITORIES bucket and the local registry
+func registerRepository(r *Repository) error {
+	if repositories.Get(r.ID) != nil {
+		return repos.ErrExists
+	}
+	if nats == nil || !nats.IsConnected() {
+		return ErrRegistryUnavailable
+	}
+	if err := nats.CreateRepository(r); err != nil {
+		return err
+	}
+	applyRepository(r.ID, r)
+	return nil
+}
+
+// saveRepository applies change to the record of a repository in the
+// REPOSITORIES bucket and stores the result in the local registry
+func saveRepository(id string, change func(r *Repository) error) (*Repository, error) {
+	if nats == nil || !nats.IsConnected() {
+		return nil, ErrRegistryUnavailable
+	}
+	r, err := nats.UpdateRepository(id, change)
+	if err != nil {
+		return nil, err
+	}
+	applyRepository(r.ID, r)
+	return r, nil
+}
+
+// unregisterRepository removes a repository from the REPOSITORIES bucket and the local registry
+func unregisterRepository(id string) error {
+	if nats == nil || !nats.IsConnected() {
+		return ErrRegistryUnavailable
+	}
+	if err := nats.DeleteRepository(id); err != nil {
+		return err
+	}
+	applyRepository(id, nil)
+	return nil
+}
+
+// applyRepository stores a repository record, or removes it when r is nil, and
+// watches the task files of registered repositories that are not paused. It
+// handles local changes as well as changes made through other replicas.
+func applyRepository(id string, r *Repository) {
+	if r == nil {
+		if removed := repositories.remove(id); removed != nil && watcher != nil {
+			watcher.Remove(removed.Path)
+		}
+		return
+	}
+
+	repositories.set(r)
+	if watcher == nil {
+		return
+	}
+	if r.Paused {
+		watcher.Remove(r.Path)
+	} else if !watcher.Watches(r.Path) {
+		if err := watcher.Add(r.Path); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// validateRepositoryPath checks that path is the top level of a git working tree
+func validateRepositoryPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("repository path not found: %s", path)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("repository path is not a directory: %s", path)
+	}
+	// .git is a file in worktrees and submodules
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return fmt.Errorf("repository path is not a git repository: %s", path)
+	}
+	return nil
+}
+
+// ListRepositoriesHandler returns the registered repositories sorted by path
+func ListRepositoriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(repositories.List())
+}
+
+// CreateRepositoryHandler registers a repository
+func CreateRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateRepositoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		http.Error(w, "Missing required field: path", http.StatusBadRequest)
+		return
+	}
+
+	repo := repos.New(req.Path)
+	repo.GitHubEnabled = req.GitHubEnabled
+	repo.Paused = req.Paused
+	if req.MaxIterations != nil {
+		repo.MaxIterations = *req.MaxIterations
+	}
+	if err := repo.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRepositoryPath(repo.Path); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := registerRepository(repo)
+	if errors.Is(err, repos.ErrExists) {
+		http.Error(w, "Repository already registered", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrRegistryUnavailable) {
+		http.Error(w, "Repository registry unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to register repository: %v", err)
+		http.Error(w, "Failed to register repository", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Repository registered: ID=%s, Path=%s", repo.ID, repo.Path)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(repo)
+}
+
+// GetRepositoryHandler returns a registered repository by ID
+func GetRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	repo := repositories.Get(repositoryID(r))
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(repo)
+}
+
+// UpdateRepositoryHandler changes the settings of a registered repository,
+// pausing or resuming it. A change made concurrently through another replica
+// is reported as a conflict instead of being overwritten.
+func UpdateRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := repositoryID(r)
+	repo := repositories.Get(id)
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	var req UpdateRepositoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	change := func(repo *Repository) error {
+		if req.GitHubEnabled != nil {
+			repo.GitHubEnabled = *req.GitHubEnabled
+		}
+		if req.MaxIterations != nil {
+			repo.MaxIterations = *req.MaxIterations
+		}
+		if req.Paused != nil {
+			repo.Paused = *req.Paused
+		}
+		repo.UpdatedAt = time.Now()
+		return repo.Validate()
+	}
+
+	// Reject invalid settings before touching the bucket
+	if err := change(repo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo, err := saveRepository(id, change)
+	switch {
+	case errors.Is(err, repos.ErrNotFound):
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repos.ErrConflict):
+		http.Error(w, "Repository was changed concurrently, retry the update", http.StatusConflict)
+		return
+	case errors.Is(err, ErrRegistryUnavailable):
+		http.Error(w, "Repository registry unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		log.Printf("Failed to update repository: %v", err)
+		http.Error(w, "Failed to update repository", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Repository updated: ID=%s, Path=%s, Paused=%v", repo.ID, repo.Path, repo.Paused)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(repo)
+}
+
+// DeleteRepositoryHandler unregisters a repository. Its existing tasks are kept.
+func DeleteRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := repositoryID(r)
+	if repositories.Get(id) == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	err := unregisterRepository(id)
+	if errors.Is(err, ErrRegistryUnavailable) {
+		http.Error(w, "Repository registry unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to remove repository: %v", err)
+		http.Error(w, "Failed to remove repository", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Repository removed: ID=%s", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// repositoryID extracts the repository ID from /api/repositories/{id}
+func repositoryID(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.Path, "/api/repositories/")
+	return strings.Split(path, "/")[0]
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"contracts-go/repos"
+)
+
+// registerTestRepository resets the registry to the given repositories,
+// skipping the git repository check
+func registerTestRepository(paths ...string) {
+	repositories = NewRepositoryRegistry()
+	for _, path := range paths {
+		repositories.set(repos.New(path))
+	}
+}
+
+// newGitDir creates a directory that looks like a git working tree
+func newGitDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// serveRepositories sends a request to the repository handler matching its method
+func serveRepositories(method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	rr := httptest.NewRecorder()
+
+	switch {
+	case method == http.MethodGet && path == "/api/repositories":
+		ListRepositoriesHandler(rr, req)
+	case method == http.MethodPost:
+		CreateRepositoryHandler(rr, req)
+	case method == http.MethodGet:
+		GetRepositoryHandler(rr, req)
+	case method == http.MethodPatch:
+		UpdateRepositoryHandler(rr, req)
+	case method == http.MethodDelete:
+		DeleteRepositoryHandler(rr, req)
+	}
+	return rr
+}
+
+// TestCreateRepositoryHandler tests registering repositories without NATS
+func TestCreateRepositoryHandler(t *testing.T) {
+	nats = nil
+	registerTestRepository()
+
+	// Registering only in this replica would diverge from the bucket
+	dir := newGitDir(t)
+	rr := serveRepositories(http.MethodPost, "/api/repositories", map[string]interface{}{"path": dir, "github_enabled": true})
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+	if repositories.Find(dir) != nil {
+		t.Error("Expected the repository not to be registered locally")
+	}
+
+	registerTestRepository(dir)
+	rr = serveRepositories(http.MethodPost, "/api/repositories", map[string]interface{}{"path": dir + "/"})
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a registered path, got %d", http.StatusConflict, rr.Code)
+	}
+
+	rr = serveRepositories(http.MethodGet, "/api/repositories", nil)
+	var list []Repository
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Path != dir {
+		t.Errorf("Unexpected repositories %+v", list)
+	}
+}
+
+// TestCreateRepositoryHandlerValidation tests rejecting invalid repositories
+func TestCreateRepositoryHandlerValidation(t *testing.T) {
+	nats = nil
+	registerTestRepository()
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"missing path", map[string]interface{}{}},
+		{"relative path", map[string]interface{}{"path": "repo"}},
+		{"missing directory", map[string]interface{}{"path": filepath.Join(t.TempDir(), "missing")}},
+		{"not a git repository", map[string]interface{}{"path": t.TempDir()}},
+		{"no iterations", map[string]interface{}{"path": newGitDir(t), "max_iterations": 0}},
+		{"too many iterations", map[string]interface{}{"path": newGitDir(t), "max_iterations": repos.MaxIterationsLimit + 1}},
+	}
+
+	for _, tt := range tests {
+		rr := serveRepositories(http.MethodPost, "/api/repositories", tt.body)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusBadRequest, rr.Code)
+		}
+	}
+
+	if count := len(repositories.List()); count != 0 {
+		t.Errorf("Expected no registered repositories, got %d", count)
+	}
+}
+
+// TestUpdateRepositoryHandler tests rejecting setting changes without NATS
+func TestUpdateRepositoryHandler(t *testing.T) {
+	nats = nil
+	registerTestRepository("/test/repo")
+	id := repos.ID("/test/repo")
+
+	rr := serveRepositories(http.MethodPatch, "/api/repositories/"+id, map[string]interface{}{"max_iterations": 10, "paused": true})
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+
+	rr = serveRepositories(http.MethodPatch, "/api/repositories/"+id, map[string]interface{}{"max_iterations": -1})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	repo := repositories.Get(id)
+	if repo.Paused || repo.MaxIterations != repos.DefaultMaxIterations {
+		t.Errorf("Expected rejected updates not to change the repository, got %+v", repo)
+	}
+
+	rr = serveRepositories(http.MethodPatch, "/api/repositories/unknown", map[string]interface{}{"paused": false})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+// TestDeleteRepositoryHandler tests rejecting unregistering without NATS
+func TestDeleteRepositoryHandler(t *testing.T) {
+	nats = nil
+	registerTestRepository("/test/repo")
+	id := repos.ID("/test/repo")
+
+	rr := serveRepositories(http.MethodDelete, "/api/repositories/"+id, nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if repositories.Get(id) == nil {
+		t.Error("Expected the repository to stay registered")
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		rr = serveRepositories(method, "/api/repositories/unknown", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", method, http.StatusNotFound, rr.Code)
+		}
+	}
+}
+
+// TestCreateTaskHandlerRepositoryChecks tests that tasks are only accepted for
+// registered repositories that are not paused
+func TestCreateTaskHandlerRepositoryChecks(t *testing.T) {
+	nats = nil
+
+	paused := repos.New("/paused/repo")
+	paused.Paused = true
+
+	tests := []struct {
+		name       string
+		repository string
+		wantStatus int
+	}{
+		{"registered", "/test/repo", http.StatusCreated},
+		{"unclean path", "/test/repo/", http.StatusCreated},
+		{"unregistered", "/other/repo", http.StatusBadRequest},
+		{"paused", "/paused/repo", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		taskQueue = NewTaskQueue()
+		registerTestRepository("/test/repo")
+		repositories.set(paused)
+
+		body, _ := json.Marshal(CreateTaskRequest{
+			IssueID:      "2",
+			Repository:   tt.repository,
+			TaskFilePath: tt.repository + "/docs/task/2-test.md",
+		})
+		rr := httptest.NewRecorder()
+		CreateTaskHandler(rr, httptest.NewRequest(http.MethodPost, "/api/tasks", bytes.NewBuffer(body)))
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+		}
+		if tt.wantStatus != http.StatusCreated && taskQueue.Size() != 0 {
+			t.Errorf("%s: expected rejected task not to be queued", tt.name)
+		}
+	}
+}
+
+// TestApplyRepositoryWatches tests that registered repositories are watched
+// unless they are paused
+func TestApplyRepositoryWatches(t *testing.T) {
+	nats = nil
+	taskQueue = NewTaskQueue()
+	registerTestRepository()
+	watcher = NewWatcher(time.Hour, true)
+	defer func() { watcher = nil }()
+
+	repo := repos.New(newGitDir(t))
+	applyRepository(repo.ID, repo)
+	if !watcher.Watches(repo.Path) {
+		t.Fatal("Expected a registered repository to be watched")
+	}
+
+	repo.Paused = true
+	applyRepository(repo.ID, repo)
+	if watcher.Watches(repo.Path) {
+		t.Error("Expected a paused repository not to be watched")
+	}
+
+	repo.Paused = false
+	applyRepository(repo.ID, repo)
+	if !watcher.Watches(repo.Path) {
+		t.Error("Expected a resumed repository to be watched")
+	}
+
+	applyRepository(repo.ID, nil)
+	if watcher.Watches(repo.Path) || repositories.Get(repo.ID) != nil {
+		t.Error("Expected a removed repository to be unregistered and unwatched")
+	}
+}
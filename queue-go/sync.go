@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"contracts-go/model"
+	natsClient "queue-go/nats"
+)
+
+// HandleStatusUpdate applies a status update published on tasks.status.<status>
+// (by queue-worker-go or any queue-go instance) to the task queue and its Qdrant copy.
+// Updates that can never apply, such as unknown tasks or transitions the state
+// machine rejects, are logged and dropped instead of being redelivered.
+func HandleStatusUpdate(update *natsClient.StatusUpdateMessage) error {
+	status, err := model.NormalizeStatus(update.Status)
+	if err != nil {
+		log.Printf("Warning: Ignoring status update for task %s: %v", update.TaskID, err)
+		return nil
+	}
+
+	changed, err := taskQueue.SetTaskStatus(update.TaskID, status, update.ErrorMessage)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		log.Printf("Warning: Ignoring status update for unknown task %s", update.TaskID)
+		return nil
+	case errors.Is(err, model.ErrInvalidTransition):
+		// Stale or out-of-order update, the task already moved on
+		log.Printf("Warning: Ignoring status update for task %s: %v", update.TaskID, err)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if changed {
+		log.Printf("Task status synced: ID=%s, Status=%s", update.TaskID, status)
+	}
+	return nil
+}
+
+// HandleTaskDelete removes a task deleted through any queue-go instance. The
+// instance that deleted it already removed it, so unknown tasks are ignored.
+func HandleTaskDelete(msg *natsClient.DeleteMessage) error {
+	err := taskQueue.RemoveTask(msg.TaskID)
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Task delete synced: ID=%s", msg.TaskID)
+	return nil
+}
+
+// HandleTaskCancel marks a task cancelled through any queue-go instance or
+// agent-intel-go. Tasks that are unknown or already finished are left alone.
+func HandleTaskCancel(msg *natsClient.CancelMessage) error {
+	changed, err := taskQueue.SetTaskStatus(msg.TaskID, StatusCancelled, msg.Reason)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		return nil
+	case errors.Is(err, model.ErrInvalidTransition):
+		log.Printf("Warning: Ignoring cancellation of task %s: %v", msg.TaskID, err)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if changed {
+		log.Printf("Task cancel synced: ID=%s", msg.TaskID)
+	}
+	return nil
+}
+
+// HandleTaskCreated adds a task created through another queue-go instance, using
+// the agent.task.new event published for every new task
+func HandleTaskCreated(event *natsClient.TaskNewEvent) error {
+	if taskQueue.GetTaskByID(event.TaskID) != nil {
+		return nil
+	}
+
+	taskQueue.Enqueue(&Task{
+		ID:           event.TaskID,
+		IssueID:      event.IssueID,
+		Repository:   event.Repository,
+		TaskFilePath: event.TaskFilePath,
+		Status:       StatusPending,
+		CreatedAt:    event.CreatedAt,
+		UpdatedAt:    event.CreatedAt,
+		Capabilities: event.Capabilities,
+	})
+
+	log.Printf("Task create synced: ID=%s", event.TaskID)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	natsClient "queue-go/nats"
+)
+
+// TestHandleStatusUpdate tests applying worker status updates to the queue
+func TestHandleStatusUpdate(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	taskQueue.Enqueue(&Task{ID: "task-1", IssueID: "1", Status: StatusPending})
+
+	// Legacy "in_progress" is accepted as processing
+	if err := HandleStatusUpdate(&natsClient.StatusUpdateMessage{TaskID: "task-1", Status: "in_progress"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if task := taskQueue.GetTaskByID("task-1"); task.Status != StatusProcessing {
+		t.Errorf("Expected status %s, got %s", StatusProcessing, task.Status)
+	}
+
+	update := &natsClient.StatusUpdateMessage{TaskID: "task-1", Status: StatusFailed, ErrorMessage: "pipeline exited with code 1"}
+	if err := HandleStatusUpdate(update); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	task := taskQueue.GetTaskByID("task-1")
+	if task.Status != StatusFailed {
+		t.Errorf("Expected status %s, got %s", StatusFailed, task.Status)
+	}
+	if task.ErrorMessage != update.ErrorMessage {
+		t.Errorf("Expected error message %q, got %q", update.ErrorMessage, task.ErrorMessage)
+	}
+}
+
+// TestHandleStatusUpdateDropped tests that updates which can never apply are acknowledged without changes
+func TestHandleStatusUpdateDropped(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	taskQueue.Enqueue(&Task{ID: "task-1", IssueID: "1", Status: StatusCompleted})
+
+	tests := []struct {
+		name   string
+		update *natsClient.StatusUpdateMessage
+	}{
+		{"unknown task", &natsClient.StatusUpdateMessage{TaskID: "missing", Status: StatusProcessing}},
+		{"invalid status", &natsClient.StatusUpdateMessage{TaskID: "task-1", Status: "bogus"}},
+		{"stale transition", &natsClient.StatusUpdateMessage{TaskID: "task-1", Status: StatusProcessing}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := HandleStatusUpdate(tt.update); err != nil {
+				t.Errorf("Expected update to be dropped without error, got %v", err)
+			}
+		})
+	}
+
+	if task := taskQueue.GetTaskByID("task-1"); task.Status != StatusCompleted {
+		t.Errorf("Expected status to stay %s, got %s", StatusCompleted, task.Status)
+	}
+}
+
+// TestHandleTaskDelete tests removing tasks deleted through another instance
+func TestHandleTaskDelete(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	taskQueue.Enqueue(&Task{ID: "task-1", IssueID: "1", Status: StatusPending})
+
+	if err := HandleTaskDelete(&natsClient.DeleteMessage{TaskID: "task-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if taskQueue.GetTaskByID("task-1") != nil {
+		t.Error("Expected task to be removed")
+	}
+
+	// Already removed by the instance that published the delete
+	if err := HandleTaskDelete(&natsClient.DeleteMessage{TaskID: "task-1"}); err != nil {
+		t.Errorf("Expected unknown task to be ignored, got %v", err)
+	}
+}
+
+// TestHandleTaskCancel tests cancelling tasks through another instance or agent-intel-go
+func TestHandleTaskCancel(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	taskQueue.Enqueue(&Task{ID: "task-1", IssueID: "1", Status: StatusProcessing})
+	taskQueue.Enqueue(&Task{ID: "task-2", IssueID: "2", Status: StatusCompleted})
+
+	cancel := &natsClient.CancelMessage{TaskID: "task-1", Reason: "duplicate"}
+	if err := HandleTaskCancel(cancel); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	task := taskQueue.GetTaskByID("task-1")
+	if task.Status != StatusCancelled || task.ErrorMessage != "duplicate" {
+		t.Errorf("Expected cancelled task with reason, got %+v", task)
+	}
+
+	// Replays, finished tasks and unknown tasks are ignored
+	for _, id := range []string{"task-1", "task-2", "missing"} {
+		if err := HandleTaskCancel(&natsClient.CancelMessage{TaskID: id, Reason: "duplicate"}); err != nil {
+			t.Errorf("Expected cancellation of %s to be ignored, got %v", id, err)
+		}
+	}
+	if got := taskQueue.GetTaskByID("task-2").Status; got != StatusCompleted {
+		t.Errorf("Expected completed task to stay %s, got %s", StatusCompleted, got)
+	}
+}
+
+// TestHandleTaskCreated tests adding tasks created through another instance
+func TestHandleTaskCreated(t *testing.T) {
+	taskQueue = NewTaskQueue()
+
+	event := &natsClient.TaskNewEvent{
+		TaskID:       "task-1",
+		IssueID:      "1",
+		Repository:   "/test/repo",
+		TaskFilePath: "/test/repo/docs/task/1-test.md",
+		CreatedAt:    time.Now(),
+		Capabilities: []string{"go"},
+	}
+
+	if err := HandleTaskCreated(event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Replays and the creating instance's own event are ignored
+	if err := HandleTaskCreated(event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if taskQueue.Size() != 1 {
+		t.Fatalf("Expected 1 task, got %d", taskQueue.Size())
+	}
+	task := taskQueue.GetTaskByID("task-1")
+	if task.Status != StatusPending || task.Repository != event.Repository {
+		t.Errorf("Expected pending task for %s, got %+v", event.Repository, task)
+	}
+	if len(task.Capabilities) != 1 || task.Capabilities[0] != "go" {
+		t.Errorf("Expected capabilities [go], got %v", task.Capabilities)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"contracts-go/model"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+const (
+	// TaskDir is the directory of a repository holding its task files
+	TaskDir = "docs/task"
+
+	// DefaultWatchPollInterval is how often repositories without file
+	// notifications are scanned
+	DefaultWatchPollInterval = 10 * time.Second
+
+	// watchDebounce lets a task file settle before it is read, editors and
+	// git write files in several steps
+	watchDebounce = 500 * time.Millisecond
+
+	// Watch modes of a repository
+	WatchModeNotify  = "fsnotify"
+	WatchModePolling = "polling"
+)
+
+// Report directories of processed task files, relative to TaskDir
+var reportDirs = []string{"end", "error"}
+
+// agentBranchPrefix starts the branches queue-worker-go commits the work and
+// report of an issue on, agent666/issue-<id>-<desc>
+const agentBranchPrefix = "agent666/issue-"
+
+// issueIDPattern matches the issue ID a task file name starts with, e.g. 16 in 16-agent-intel.md
+var issueIDPattern = regexp.MustCompile(`^(\d+)(?:[-_. ]|$)`)
+
+// Watcher enqueues the task files of registered repositories: every new or
+// modified docs/task/<issue>-<title>.md becomes a task. Repositories are watched
+// with file notifications, or scanned every poll interval when notifications
+// are unavailable.
+type Watcher struct {
+	notify       *fsnotify.Watcher // Nil when polling every repository
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	repos    map[string]string // Repository path to watch mode
+	seen     map[string]string // Version ID last handled of each task file
+	debounce map[string]*time.Timer
+}
+
+// WatchedRepository describes a registered repository
+type WatchedRepository struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"` // fsnotify or polling
+}
+
+// NewWatcher creates a watcher. Unless polling is forced it uses file
+// notifications, falling back to polling when they are unavailable.
+func NewWatcher(pollInterval time.Duration, forcePolling bool) *Watcher {
+	w := &Watcher{
+		pollInterval: pollInterval,
+		repos:        make(map[string]string),
+		seen:         make(map[string]string),
+		debounce:     make(map[string]*time.Timer),
+	}
+
+	if !forcePolling {
+		notify, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("Warning: file notifications unavailable, polling repositories: %v", err)
+		} else {
+			w.notify = notify
+		}
+	}
+	return w
+}
+
+// Add registers a repository and enqueues its task files that have no task yet
+func (w *Watcher) Add(repository string) error {
+	repository = filepath.Clean(repository)
+	info, err := os.Stat(repository)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", repository, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("failed to watch %s: not a directory", repository)
+	}
+
+	mode := WatchModePolling
+	if w.notify != nil {
+		// docs/task may not exist yet, it is picked up by polling once created
+		if err := w.notify.Add(filepath.Join(repository, TaskDir)); err == nil {
+			mode = WatchModeNotify
+		} else {
+			log.Printf("Warning: polling %s, file notifications failed: %v", repository, err)
+		}
+	}
+
+	w.mu.Lock()
+	w.repos[repository] = mode
+	w.mu.Unlock()
+
+	log.Printf("Watching %s for task files (%s)", repository, mode)
+	w.scan(repository)
+	return nil
+}
+
+// Remove stops watching a repository
+func (w *Watcher) Remove(repository string) {
+	repository = filepath.Clean(repository)
+
+	w.mu.Lock()
+	mode, ok := w.repos[repository]
+	delete(w.repos, repository)
+	for path := range w.seen {
+		if filepath.Dir(filepath.Dir(filepath.Dir(path))) == repository {
+			delete(w.seen, path)
+		}
+	}
+	w.mu.Unlock()
+
+	if ok && mode == WatchModeNotify {
+		w.notify.Remove(filepath.Join(repository, TaskDir))
+	}
+}
+
+// Watches reports whether a repository is registered
+func (w *Watcher) Watches(repository string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.repos[filepath.Clean(repository)]
+	return ok
+}
+
+// Repositories returns the registered repositories sorted by path
+func (w *Watcher) Repositories() []WatchedRepository {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	repos := make([]WatchedRepository, 0, len(w.repos))
+	for path, mode := range w.repos {
+		repos = append(repos, WatchedRepository{Path: path, Mode: mode})
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Path < repos[j].Path
+	})
+	return repos
+}
+
+// Run handles file notifications and polls repositories until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if w.notify != nil {
+		defer w.notify.Close()
+		events, errs = w.notify.Events, w.notify.Errors
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			switch {
+			case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+				w.schedule(event.Name)
+			case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+				w.forget(event.Name)
+				w.fallBack(event.Name)
+			}
+		case err := <-errs:
+			log.Printf("Warning: file notification error: %v", err)
+		case <-ticker.C:
+			for _, repo := range w.Repositories() {
+				if repo.Mode == WatchModePolling {
+					w.scan(repo.Path)
+				}
+			}
+		}
+	}
+}
+
+// fallBack polls the repository whose docs/task directory was removed, file
+// notifications stop once the watched directory is gone
+func (w *Watcher) fallBack(dir string) {
+	repository := filepath.Dir(filepath.Dir(dir))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if mode, ok := w.repos[repository]; ok && mode == WatchModeNotify && filepath.Join(repository, TaskDir) == dir {
+		w.repos[repository] = WatchModePolling
+		log.Printf("Warning: %s was removed, polling %s", dir, repository)
+	}
+}
+
+// schedule handles a task file once it stopped changing for watchDebounce
+func (w *Watcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if timer, ok := w.debounce[path]; ok {
+		timer.Reset(watchDebounce)
+		return
+	}
+	w.debounce[path] = time.AfterFunc(watchDebounce, func() {
+		w.mu.Lock()
+		delete(w.debounce, path)
+		w.mu.Unlock()
+
+		// path is <repository>/docs/task/<name>
+		w.handle(filepath.Dir(filepath.Dir(filepath.Dir(path))), path)
+	})
+}
+
+// scan handles every task file of a repository and forgets the files removed
+// since the last scan
+func (w *Watcher) scan(repository string) {
+	dir := filepath.Join(repository, TaskDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to scan %s: %v", repository, err)
+		return
+	}
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[filepath.Join(dir, entry.Name())] = true
+	}
+
+	w.mu.Lock()
+	for path := range w.seen {
+		if filepath.Dir(path) == dir && !present[path] {
+			delete(w.seen, path)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, entry := range entries {
+		w.handle(repository, filepath.Join(dir, entry.Name()))
+	}
+}
+
+// forget drops the handled version of a task file, e.g. once it was removed or
+// processed into a report
+func (w *Watcher) forget(path string) {
+	w.mu.Lock()
+	delete(w.seen, path)
+	w.mu.Unlock()
+}
+
+// retryLater handles a task file again after the poll interval, e.g. when its
+// task couldn't be published
+func (w *Watcher) retryLater(repository, path string) {
+	time.AfterFunc(w.pollInterval, func() {
+		if w.Watches(repository) {
+			w.handle(repository, path)
+		}
+	})
+}
+
+// handle creates a task for a task file unless this version of the file was
+// already handled, the file was already processed into a report, or the file
+// has a task that is still queued or was created after its last change
+func (w *Watcher) handle(repository, path string) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		w.forget(path)
+		return
+	}
+	if err != nil || !info.Mode().IsRegular() || filepath.Ext(path) != ".md" {
+		return
+	}
+
+	// Task IDs are derived from the file version, so replicas watching the same
+	// repository create the same task and JetStream drops the duplicates
+	id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("%s|%d|%d", path, info.ModTime().UnixNano(), info.Size()))).String()
+
+	w.mu.Lock()
+	_, registered := w.repos[repository]
+	handled := w.seen[path] == id
+	if registered && !handled {
+		// Claimed so concurrent notifications and scans handle the version once
+		w.seen[path] = id
+	}
+	w.mu.Unlock()
+	if !registered || handled {
+		return
+	}
+
+	name := filepath.Base(path)
+	issueID, ok := parseIssueID(name)
+	if !ok {
+		log.Printf("Warning: skipping task file %s, its name doesn't start with an issue ID", path)
+		return
+	}
+	if isReported(repository, issueID, name) {
+		w.forget(path)
+		return
+	}
+	if hasTask(repository, path, info.ModTime()) {
+		return
+	}
+
+	now := time.Now()
+	task := &Task{
+		ID:           id,
+		IssueID:      issueID,
+		Repository:   repository,
+		TaskFilePath: path,
+		Status:       StatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := submitTask(task); err != nil {
+		log.Printf("Failed to publish task for %s, retrying in %v: %v", path, w.pollInterval, err)
+		w.mu.Lock()
+		if w.seen[path] == id {
+			delete(w.seen, path)
+		}
+		w.mu.Unlock()
+		w.retryLater(repository, path)
+		return
+	}
+	log.Printf("Task file %s enqueued as task %s", path, task.ID)
+}
+
+// parseIssueID returns the issue ID a task file name starts with
+func parseIssueID(name string) (string, bool) {
+	match := issueIDPattern.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name)))
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// isReported reports whether a task file already has a report in docs/task/end
+// or docs/task/error, either in the checkout or on one of the issue's agent
+// branches. Workers running in a sandbox only commit the report to the agent
+// branch, so the checkout keeps the task file.
+func isReported(repository, issueID, name string) bool {
+	for _, dir := range reportDirs {
+		if _, err := os.Stat(filepath.Join(repository, TaskDir, dir, name)); err == nil {
+			return true
+		}
+	}
+
+	refs, err := exec.Command("git", "-C", repository, "for-each-ref", "--format=%(refname)",
+		"refs/heads/"+agentBranchPrefix+issueID+"-*").Output()
+	if err != nil {
+		return false
+	}
+	for _, ref := range strings.Fields(string(refs)) {
+		for _, dir := range reportDirs {
+			// Paths in git trees always use forward slashes
+			object := ref + ":" + TaskDir + "/" + dir + "/" + name
+			if exec.Command("git", "-C", repository, "cat-file", "-e", object).Run() == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasTask reports whether the queue holds a task for the file that is still
+// active or was created after the file was last modified
+func hasTask(repository, path string, modified time.Time) bool {
+	for _, task := range taskQueue.ListTasks() {
+		if task.Repository != repository || task.TaskFilePath != path {
+			continue
+		}
+		if model.IsActive(task.Status) || !task.CreatedAt.Before(modified) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListWatchedRepositoriesHandler returns the repositories watched for task files
+func ListWatchedRepositoriesHandler(w http.ResponseWriter, r *http.Request) {
+	repos := []WatchedRepository{}
+	if watcher != nil {
+		repos = watcher.Repositories()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(repos)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestRepository creates a repository with the given docs/task files
+func newTestRepository(t *testing.T, files ...string) string {
+	t.Helper()
+	repository := t.TempDir()
+	for _, name := range files {
+		writeTaskFile(t, repository, name, "# Task\n")
+	}
+	return repository
+}
+
+// writeTaskFile writes a file relative to the repository's docs/task directory
+func writeTaskFile(t *testing.T, repository, name, content string) string {
+	t.Helper()
+	path := filepath.Join(repository, TaskDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestParseIssueID tests parsing the issue ID from task file names
+func TestParseIssueID(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{"16-agent-intel.md", "16", true},
+		{"7_fix-login.md", "7", true},
+		{"42.md", "42", true},
+		{"003 spaces.md", "003", true},
+		{"agent-intel.md", "", false},
+		{"16agent.md", "", false},
+		{"README.md", "", false},
+	}
+
+	for _, tt := range tests {
+		issueID, ok := parseIssueID(tt.name)
+		if issueID != tt.expected || ok != tt.ok {
+			t.Errorf("parseIssueID(%q) = %q, %v; expected %q, %v", tt.name, issueID, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+// TestWatcherAddEnqueuesTaskFiles tests that registering a repository enqueues
+// its task files, skipping reported and unnumbered files
+func TestWatcherAddEnqueuesTaskFiles(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	nats = nil
+
+	repository := newTestRepository(t, "16-agent-intel.md", "17-done.md", "18-failed.md", "notes.md", "19-readme.txt")
+	writeTaskFile(t, repository, "end/17-done.md", "# Report\n")
+	writeTaskFile(t, repository, "error/18-failed.md", "# Report\n")
+	writeTaskFile(t, repository, "end/20-only-report.md", "# Report\n")
+
+	w := NewWatcher(time.Hour, true)
+	if err := w.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := taskQueue.ListTasks()
+	if len(tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d", len(tasks))
+	}
+	task := tasks[0]
+	if task.IssueID != "16" {
+		t.Errorf("Expected issue ID 16, got %s", task.IssueID)
+	}
+	if task.Repository != repository {
+		t.Errorf("Expected repository %s, got %s", repository, task.Repository)
+	}
+	if expected := filepath.Join(repository, TaskDir, "16-agent-intel.md"); task.TaskFilePath != expected {
+		t.Errorf("Expected task file %s, got %s", expected, task.TaskFilePath)
+	}
+	if task.Status != StatusPending {
+		t.Errorf("Expected status %s, got %s", StatusPending, task.Status)
+	}
+}
+
+// TestWatcherSkipsHandledFiles tests that rescanning doesn't enqueue a task
+// file twice, but a modified file is enqueued again once its task finished
+func TestWatcherSkipsHandledFiles(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	nats = nil
+
+	repository := newTestRepository(t, "16-agent-intel.md")
+	w := NewWatcher(time.Hour, true)
+	if err := w.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(repository)
+
+	if count := len(taskQueue.ListTasks()); count != 1 {
+		t.Fatalf("Expected 1 task after rescanning, got %d", count)
+	}
+
+	// A modified file is left alone while its task is still active
+	path := writeTaskFile(t, repository, "16-agent-intel.md", "# Task\n\nMore details\n")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(repository)
+	if count := len(taskQueue.ListTasks()); count != 1 {
+		t.Fatalf("Expected 1 task while the first is active, got %d", count)
+	}
+
+	// Once the task finished, the next change is enqueued
+	first := taskQueue.ListTasks()[0]
+	if err := taskQueue.UpdateTaskStatus(first.ID, StatusCompleted); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(repository)
+	if count := len(taskQueue.ListTasks()); count != 2 {
+		t.Errorf("Expected 2 tasks after the file changed, got %d", count)
+	}
+}
+
+// TestWatcherSkipsFilesReportedOnAgentBranches tests that task files whose
+// report was only committed to the issue's agent branch are not enqueued again
+func TestWatcherSkipsFilesReportedOnAgentBranches(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	taskQueue = NewTaskQueue()
+	nats = nil
+
+	repository := newTestRepository(t, "16-agent-intel.md", "17-pending.md")
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", repository, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("add", ".")
+	git("commit", "-q", "-m", "tasks")
+	git("checkout", "-q", "-b", "agent666/issue-16-agent-intel")
+	os.Remove(filepath.Join(repository, TaskDir, "16-agent-intel.md"))
+	writeTaskFile(t, repository, "end/16-agent-intel.md", "# Report\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "report")
+	git("checkout", "-q", "main")
+
+	w := NewWatcher(time.Hour, true)
+	if err := w.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := taskQueue.ListTasks()
+	if len(tasks) != 1 || tasks[0].IssueID != "17" {
+		t.Errorf("Expected only the task of issue 17, got %+v", tasks)
+	}
+}
+
+// TestWatcherForgetsRemovedFiles tests that handled versions are only kept
+// for task files that exist and aren't reported
+func TestWatcherForgetsRemovedFiles(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	nats = nil
+
+	repository := newTestRepository(t, "16-agent-intel.md", "17-reported.md")
+	writeTaskFile(t, repository, "end/17-reported.md", "# Report\n")
+	w := NewWatcher(time.Hour, true)
+	if err := w.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+	if count := len(w.seen); count != 1 {
+		t.Fatalf("Expected 1 handled file, got %v", w.seen)
+	}
+
+	os.Remove(filepath.Join(repository, TaskDir, "16-agent-intel.md"))
+	w.scan(repository)
+
+	if count := len(w.seen); count != 0 {
+		t.Errorf("Expected the removed file to be forgotten, got %v", w.seen)
+	}
+	if count := len(taskQueue.ListTasks()); count != 1 {
+		t.Errorf("Expected 1 task, got %d", count)
+	}
+}
+
+// TestWatcherPolling tests that polled repositories pick up new task files
+func TestWatcherPolling(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	nats = nil
+
+	repository := newTestRepository(t)
+	w := NewWatcher(10*time.Millisecond, true)
+	if err := w.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	writeTaskFile(t, repository, "21-new-task.md", "# New task\n")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(taskQueue.ListTasks()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the new task file to be enqueued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if issueID := taskQueue.ListTasks()[0].IssueID; issueID != "21" {
+		t.Errorf("Expected issue ID 21, got %s", issueID)
+	}
+}
+
+// TestWatcherAddAndRemove tests registering and unregistering repositories
+func TestWatcherAddAndRemove(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	nats = nil
+
+	w := NewWatcher(time.Hour, true)
+	if err := w.Add(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing repository")
+	}
+
+	repository := newTestRepository(t)
+	if err := w.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+	repos := w.Repositories()
+	if len(repos) != 1 || repos[0].Path != repository || repos[0].Mode != WatchModePolling {
+		t.Fatalf("Unexpected repositories: %+v", repos)
+	}
+
+	w.Remove(repository)
+	writeTaskFile(t, repository, "22-after-remove.md", "# Task\n")
+	w.handle(repository, filepath.Join(repository, TaskDir, "22-after-remove.md"))
+
+	if count := len(w.Repositories()); count != 0 {
+		t.Errorf("Expected no repositories, got %d", count)
+	}
+	if count := len(taskQueue.ListTasks()); count != 0 {
+		t.Errorf("Expected no tasks from a removed repository, got %d", count)
+	}
+}
+
+// TestListWatchedRepositoriesHandler tests listing watched repositories
+func TestListWatchedRepositoriesHandler(t *testing.T) {
+	taskQueue = NewTaskQueue()
+	nats = nil
+	defer func() { watcher = nil }()
+
+	watcher = nil
+	rr := httptest.NewRecorder()
+	ListWatchedRepositoriesHandler(rr, httptest.NewRequest("GET", "/api/watcher", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "[]\n" {
+		t.Errorf("Expected an empty list, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	repository := newTestRepository(t)
+	watcher = NewWatcher(time.Hour, true)
+	if err := watcher.Add(repository); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	ListWatchedRepositoriesHandler(rr, httptest.NewRequest("GET", "/api/watcher", nil))
+
+	var repos []WatchedRepository
+	if err := json.NewDecoder(rr.Body).Decode(&repos); err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Path != repository {
+		t.Errorf("Unexpected repositories: %+v", repos)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"contracts-go/fleet"
+)
+
+// WorkerStatus is a worker record with its state and timings as seen now
+type WorkerStatus struct {
+	fleet.Worker
+	State           string `json:"state"` // running, draining, stopped or dead
+	UptimeSeconds   int64  `json:"uptime_seconds"`
+	LastSeenSeconds int64  `json:"last_seen_seconds_ago"`
+}
+
+// WorkersResponse represents the fleet status
+type WorkersResponse struct {
+	Workers []WorkerStatus `json:"workers"`
+	Total   int            `json:"total"`
+	Alive   int            `json:"alive"`
+	Dead    int            `json:"dead"`
+}
+
+// ListWorkersHandler returns the queue-worker-go instances registered in the
+// WORKERS bucket, optionally filtered with ?state=running|draining|stopped|dead
+func ListWorkersHandler(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", fleet.StateRunning, fleet.StateDraining, fleet.StateStopped, fleet.StateDead:
+	default:
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+
+	if !natsAvailable(w) {
+		return
+	}
+
+	workers, err := nats.ListWorkers()
+	if err != nil {
+		log.Printf("Failed to list workers: %v", err)
+		http.Error(w, "Failed to list workers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(buildWorkersResponse(workers, state, time.Now()))
+}
+
+// buildWorkersResponse derives each worker's state at now and keeps the ones in
+// the requested state (all when state is empty), sorted by ID
+func buildWorkersResponse(workers []fleet.Worker, state string, now time.Time) WorkersResponse {
+	response := WorkersResponse{Workers: []WorkerStatus{}}
+
+	for _, worker := range workers {
+		status := WorkerStatus{
+			Worker:          worker,
+			State:           worker.CurrentState(now),
+			UptimeSeconds:   int64(worker.LastSeen.Sub(worker.StartedAt).Seconds()),
+			LastSeenSeconds: int64(now.Sub(worker.LastSeen).Seconds()),
+		}
+
+		switch status.State {
+		case fleet.StateRunning, fleet.StateDraining:
+			response.Alive++
+		case fleet.StateDead:
+			response.Dead++
+		}
+		response.Total++
+
+		if state == "" || status.State == state {
+			response.Workers = append(response.Workers, status)
+		}
+	}
+
+	sort.Slice(response.Workers, func(i, j int) bool {
+		return response.Workers[i].ID < response.Workers[j].ID
+	})
+
+	return response
+}
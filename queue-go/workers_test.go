@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"contracts-go/fleet"
+)
+
+// TestBuildWorkersResponse tests deriving worker states and fleet counts
+func TestBuildWorkersResponse(t *testing.T) {
+	now := time.Now()
+	workers := []fleet.Worker{
+		{ID: "worker-b", State: fleet.StateRunning, CurrentTasks: []string{"task-1"}, StartedAt: now.Add(-time.Hour), LastSeen: now.Add(-2 * time.Second)},
+		{ID: "worker-a", State: fleet.StateRunning, StartedAt: now.Add(-2 * time.Hour), LastSeen: now.Add(-5 * time.Minute)},
+		{ID: "worker-c", State: fleet.StateStopped, StartedAt: now.Add(-time.Hour), LastSeen: now.Add(-10 * time.Minute)},
+	}
+
+	response := buildWorkersResponse(workers, "", now)
+	if response.Total != 3 || response.Alive != 1 || response.Dead != 1 {
+		t.Errorf("Expected 3 total, 1 alive and 1 dead, got %d, %d and %d", response.Total, response.Alive, response.Dead)
+	}
+
+	if len(response.Workers) != 3 || response.Workers[0].ID != "worker-a" {
+		t.Fatalf("Expected 3 workers sorted by ID, got %+v", response.Workers)
+	}
+	if response.Workers[0].State != fleet.StateDead {
+		t.Errorf("Expected worker-a to be dead, got %s", response.Workers[0].State)
+	}
+	if response.Workers[1].UptimeSeconds < 3500 || response.Workers[1].LastSeenSeconds != 2 {
+		t.Errorf("Expected uptime of about an hour and last seen 2s ago, got %d and %d",
+			response.Workers[1].UptimeSeconds, response.Workers[1].LastSeenSeconds)
+	}
+
+	dead := buildWorkersResponse(workers, fleet.StateDead, now)
+	if len(dead.Workers) != 1 || dead.Workers[0].ID != "worker-a" {
+		t.Errorf("Expected only worker-a when filtering dead workers, got %+v", dead.Workers)
+	}
+	if dead.Total != 3 {
+		t.Errorf("Expected counts to cover the whole fleet, got total %d", dead.Total)
+	}
+}
+
+// TestListWorkersHandler tests request validation and an unavailable queue
+func TestListWorkersHandler(t *testing.T) {
+	nats = nil
+
+	rr := httptest.NewRecorder()
+	ListWorkersHandler(rr, httptest.NewRequest("GET", "/api/workers?state=sleeping", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid state, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	ListWorkersHandler(rr, httptest.NewRequest("GET", "/api/workers", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without NATS, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
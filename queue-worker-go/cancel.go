@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// cancelledRetention is how long cancellations of tasks the worker isn't
+	// running are remembered, in case the task is delivered afterwards
+	cancelledRetention = 24 * time.Hour
+
+	// cancelConsumerTTL is how long the worker's cancellation consumer survives without a subscriber
+	cancelConsumerTTL = time.Hour
+)
+
+// ErrTaskCancelled is the cause of a pipeline stopped because its task was cancelled
+var ErrTaskCancelled = errors.New("task cancelled")
+
+// CancelMessage is defined in contracts-go/events
+type CancelMessage = events.CancelMessage
+
+// cancelCause is the context cause of a task stopped by a cancellation
+type cancelCause struct {
+	reason string
+}
+
+func (c *cancelCause) Error() string {
+	if c.reason == "" {
+		return ErrTaskCancelled.Error()
+	}
+	return ErrTaskCancelled.Error() + ": " + c.reason
+}
+
+func (c *cancelCause) Unwrap() error {
+	return ErrTaskCancelled
+}
+
+// cancelledReason reports whether ctx was cancelled because its task was, and why
+func cancelledReason(ctx context.Context) (string, bool) {
+	var cause *cancelCause
+	if errors.As(context.Cause(ctx), &cause) {
+		return cause.reason, true
+	}
+	return "", false
+}
+
+// cancellations remembers recently cancelled tasks
+type cancellations struct {
+	mu    sync.Mutex
+	tasks map[string]cancellation
+}
+
+// cancellation is a remembered task cancellation
+type cancellation struct {
+	reason string
+	at     time.Time
+}
+
+// newCancellations creates an empty cancellation memory
+func newCancellations() *cancellations {
+	return &cancellations{tasks: make(map[string]cancellation)}
+}
+
+// add remembers a cancelled task and forgets cancellations older than cancelledRetention
+func (c *cancellations) add(taskID, reason string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, cancelled := range c.tasks {
+		if now.Sub(cancelled.at) > cancelledRetention {
+			delete(c.tasks, id)
+		}
+	}
+	c.tasks[taskID] = cancellation{reason: reason, at: now}
+}
+
+// lookup returns the reason a task was cancelled, if it was
+func (c *cancellations) lookup(taskID string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancelled, ok := c.tasks[taskID]
+	return cancelled.reason, ok
+}
+
+// subscribeCancels subscribes the worker to tasks.cancel. Every worker has its
+// own consumer, so the cancellation reaches whichever worker runs the task.
+func (w *Worker) subscribeCancels() (*nats.Subscription, error) {
+	return w.js.Subscribe(subjects.TaskCancel, w.handleCancel,
+		nats.Durable(subjects.InstanceConsumer(subjects.ConsumerWorkerCancels, w.id)),
+		nats.DeliverNew(),
+		nats.InactiveThreshold(cancelConsumerTTL),
+		nats.ManualAck(),
+		nats.BindStream(subjects.StreamTaskEvents),
+	)
+}
+
+// handleCancel stops the pipeline of a cancelled task
+func (w *Worker) handleCancel(msg *nats.Msg) {
+	var cancelMsg CancelMessage
+	if err := json.Unmarshal(msg.Data, &cancelMsg); err != nil {
+		log.Printf("Failed to unmarshal cancel message: %v", err)
+		msg.Term()
+		return
+	}
+
+	if w.cancelTask(cancelMsg.TaskID, cancelMsg.Reason) {
+		log.Printf("Task %s cancelled, stopping pipeline", cancelMsg.TaskID)
+	}
+	msg.Ack()
+}
+
+// cancelTask stops a task if it is running and remembers the cancellation in
+// case the task is delivered later. It returns whether the task was running.
+func (w *Worker) cancelTask(taskID, reason string) bool {
+	w.cancelled.add(taskID, reason, time.Now())
+	return w.tasks.cancel(taskID, &cancelCause{reason: reason})
+}
+
+// checkCancelled stops a task that was cancelled before it started
+func (w *Worker) checkCancelled(taskID string, cancel context.CancelCauseFunc) {
+	if reason, ok := w.cancelled.lookup(taskID); ok {
+		cancel(&cancelCause{reason: reason})
+	}
+}
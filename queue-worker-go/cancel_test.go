@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCancellations tests remembering cancelled tasks until they expire
+func TestCancellations(t *testing.T) {
+	cancelled := newCancellations()
+	now := time.Now()
+
+	cancelled.add("task-1", "duplicate", now.Add(-2*cancelledRetention))
+	cancelled.add("task-2", "", now)
+
+	if _, ok := cancelled.lookup("task-1"); ok {
+		t.Error("Expected expired cancellation to be forgotten")
+	}
+	if reason, ok := cancelled.lookup("task-2"); !ok || reason != "" {
+		t.Errorf("Expected task-2 to be cancelled, got %q (%v)", reason, ok)
+	}
+	if _, ok := cancelled.lookup("task-3"); ok {
+		t.Error("Expected task-3 not to be cancelled")
+	}
+}
+
+// TestWorkerCancelTask tests that cancelling stops a running pipeline and tasks delivered afterwards
+func TestWorkerCancelTask(t *testing.T) {
+	script := writeScript(t, `exec sleep 5`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := newWorker("worker-1", nil, runner, 1)
+	task := &TaskMessage{ID: "task-1", IssueID: "1", Repository: t.TempDir(), TaskFilePath: "docs/task/1-test.md"}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	if err := worker.tasks.start(task.ID, cancel); err != nil {
+		t.Fatalf("Expected task to start: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if !worker.cancelTask(task.ID, "duplicate") {
+			t.Error("Expected running task to be cancelled")
+		}
+	}()
+
+	result := worker.runTask(ctx, task)
+	if result.Succeeded() || result.Runtime > 2*time.Second {
+		t.Errorf("Expected pipeline to be stopped promptly, got %+v", result)
+	}
+	if reason, ok := cancelledReason(ctx); !ok || reason != "duplicate" {
+		t.Errorf("Expected cancellation reason duplicate, got %q (%v)", reason, ok)
+	}
+	worker.tasks.finish(task.ID, false)
+
+	// Delivered again after the cancellation, stopped before it runs
+	ctx, cancel = context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	worker.tasks.start(task.ID, cancel)
+	worker.checkCancelled(task.ID, cancel)
+	if _, ok := cancelledReason(ctx); !ok {
+		t.Error("Expected task cancelled before delivery to be stopped")
+	}
+	if _, err := worker.pool.lockRepo(ctx, task.Repository); err == nil {
+		t.Error("Expected a cancelled task not to take the repository lock")
+	}
+
+	if worker.cancelTask("task-2", "") {
+		t.Error("Expected cancelling a task that isn't running to report false")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/model"
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Agent Intel Service subjects
+	SubjectPipelineCompleted = subjects.AgentPipelineCompleted
+
+	// Pipeline completion statuses understood by agent-intel-go
+	PipelineStatusSuccess = events.PipelineStatusSuccess
+	PipelineStatusFailure = events.PipelineStatusFailure
+
+	// Output streams of a log chunk
+	LogStdout = events.LogStdout
+	LogStderr = events.LogStderr
+)
+
+// TaskMessage is the canonical task published on tasks.new
+type TaskMessage = model.Task
+
+// PipelineCompletedEvent is defined in contracts-go/events
+type PipelineCompletedEvent = events.PipelineCompletedEvent
+
+// StatusUpdateMessage is defined in contracts-go/events
+type StatusUpdateMessage = events.StatusUpdateMessage
+
+// newPipelineCompletedEvent builds the completion event for a pipeline result
+func newPipelineCompletedEvent(task *TaskMessage, result *PipelineResult) *PipelineCompletedEvent {
+	event := &PipelineCompletedEvent{
+		TaskID:            task.ID,
+		Repository:        task.Repository,
+		PipelineRuntimeMs: result.Runtime.Milliseconds(),
+		Status:            PipelineStatusSuccess,
+		ExitCode:          result.ExitCode,
+		CompletedAt:       time.Now(),
+	}
+
+	if !result.Succeeded() {
+		event.Status = PipelineStatusFailure
+		event.ErrorMessage = result.ErrorMessage()
+	}
+
+	return event
+}
+
+// publishStatusUpdate publishes a task status change on tasks.status.<status> for queue-go
+func publishStatusUpdate(js nats.JetStreamContext, update *StatusUpdateMessage) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status update: %w", err)
+	}
+
+	if _, err := js.Publish(subjects.TaskStatusSubject(update.Status), data); err != nil {
+		return fmt.Errorf("failed to publish status update: %w", err)
+	}
+
+	return nil
+}
+
+// publishPipelineCompleted publishes a pipeline completion event to JetStream
+func publishPipelineCompleted(js nats.JetStreamContext, event *PipelineCompletedEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pipeline.completed event: %w", err)
+	}
+
+	if _, err := js.Publish(SubjectPipelineCompleted, data); err != nil {
+		return fmt.Errorf("failed to publish pipeline.completed event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// AgentBranchPrefix is the namespace of every branch the agent works on
+	AgentBranchPrefix = "agent666/"
+
+	// DefaultProtectedBranches lists the human branches of the project convention
+	// (docs/context-agent666.md), which the agent never works on
+	DefaultProtectedBranches = "main,master,dev,develop,qa,feature/*,fix/*,hotfix/*,release/*"
+
+	// maxBranchDescription limits the description part of agent branch names
+	maxBranchDescription = 40
+)
+
+// ErrProtectedBranch is reported when a task would run or commit on a protected branch
+var ErrProtectedBranch = errors.New("refusing to work on a protected branch")
+
+// ErrDirtyCheckout is reported when a pipeline would run in a repository with
+// uncommitted changes, which would be carried to the agent branch
+var ErrDirtyCheckout = errors.New("refusing to work on a checkout with uncommitted changes")
+
+// nonSlug matches the runs of characters replaced by dashes in branch names
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// GitFlow puts the work of each task on its agent666/issue-<id>-<desc> branch
+// and commits the result of successful pipeline runs
+type GitFlow struct {
+	protected   []string // Branch names, or prefixes ending in *
+	authorName  string
+	authorEmail string
+}
+
+// NewGitFlow creates the git stage with the protected branch patterns and the commit author
+func NewGitFlow(protected []string, authorName, authorEmail string) *GitFlow {
+	return &GitFlow{
+		protected:   protected,
+		authorName:  authorName,
+		authorEmail: authorEmail,
+	}
+}
+
+// AgentBranch returns the branch a task's work goes on, named after its issue
+// and the task file, e.g. agent666/issue-16-agent-intel for docs/task/16-agent-intel.md
+func AgentBranch(task *TaskMessage) string {
+	return AgentBranchPrefix + "issue-" + issueSlug(task) + "-" + taskDescription(task)
+}
+
+// issueSlug returns the issue ID of a task as it appears in branch names
+func issueSlug(task *TaskMessage) string {
+	if issue := slug(task.IssueID); issue != "" {
+		return issue
+	}
+	return slug(task.ID)
+}
+
+// taskDescription derives a short description from the task file name,
+// dropping the issue ID it usually starts with
+func taskDescription(task *TaskMessage) string {
+	name := strings.TrimSuffix(filepath.Base(task.TaskFilePath), filepath.Ext(task.TaskFilePath))
+	desc := strings.TrimPrefix(slug(name), issueSlug(task)+"-")
+	if desc == "" || desc == issueSlug(task) {
+		return "task"
+	}
+	if len(desc) > maxBranchDescription {
+		desc = strings.TrimRight(desc[:maxBranchDescription], "-")
+	}
+	return desc
+}
+
+// slug lowercases value and replaces everything but letters and digits with single dashes
+func slug(value string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+// isProtected reports whether the agent must not work on branch
+func (g *GitFlow) isProtected(branch string) bool {
+	return matchesAny(branch, g.protected)
+}
+
+// checkout creates the agent branch of a task at the current commit of the
+// checkout in dir, resetting it when it already exists, and switches to it.
+// The task's repository must not be on a protected branch, also when dir is a
+// sandbox worktree of it. When the pipeline runs in the repository itself it
+// must be clean, see restore. It returns an empty branch when dir is not a git checkout.
+func (g *GitFlow) checkout(dir string, task *TaskMessage) (string, error) {
+	if !isGitRepository(dir) {
+		return "", nil
+	}
+
+	if isGitRepository(task.Repository) {
+		current, err := currentBranch(task.Repository)
+		if err != nil {
+			return "", err
+		}
+		if current != "" && g.isProtected(current) {
+			return "", fmt.Errorf("%w: %s is on %s", ErrProtectedBranch, task.Repository, current)
+		}
+	}
+
+	if dir == task.Repository {
+		status, err := gitOutput(dir, "status", "--porcelain")
+		if err != nil {
+			return "", err
+		}
+		if status != "" {
+			return "", fmt.Errorf("%w: %s", ErrDirtyCheckout, dir)
+		}
+	}
+
+	branch := AgentBranch(task)
+	if g.isProtected(branch) {
+		return "", fmt.Errorf("%w: %s", ErrProtectedBranch, branch)
+	}
+	if err := git(dir, "checkout", "-q", "-B", branch); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", branch, err)
+	}
+	return branch, nil
+}
+
+// origin returns what restore switches dir back to: its branch, or its
+// commit when HEAD is detached
+func origin(dir string) (string, error) {
+	branch, err := currentBranch(dir)
+	if err != nil || branch != "" {
+		return branch, err
+	}
+	return gitOutput(dir, "rev-parse", "HEAD")
+}
+
+// restore switches a repository the pipeline ran in directly back to origin
+// once the run is over, so the user's checkout doesn't stay on the agent
+// branch. Changes an interrupted run left behind are committed on the agent
+// branch first; a checkout the pipeline moved elsewhere is left as it is.
+func (g *GitFlow) restore(dir, branch, origin string, task *TaskMessage) error {
+	if err := g.verify(dir, branch); err != nil {
+		return err
+	}
+	if _, err := g.commit(dir, branch, interruptedMessage(task)); err != nil {
+		return err
+	}
+	return git(dir, "checkout", "-q", origin)
+}
+
+// verify checks that the pipeline left the checkout on the agent branch
+func (g *GitFlow) verify(dir, branch string) error {
+	current, err := currentBranch(dir)
+	if err != nil {
+		return err
+	}
+	if current != branch {
+		return fmt.Errorf("%w: pipeline left the checkout on %q instead of %s", ErrProtectedBranch, current, branch)
+	}
+	return nil
+}
+
+// discard drops every change the pipeline made to the checkout since the
+// agent branch was checked out
+func (g *GitFlow) discard(dir string) error {
+	if err := git(dir, "reset", "-q", "--hard"); err != nil {
+		return err
+	}
+	return git(dir, "clean", "-q", "-f", "-d")
+}
+
+// commit commits every change in dir on the agent branch with message and
+// returns the new commit, or an empty string when nothing changed. It refuses
+// to commit when the pipeline switched to another branch.
+func (g *GitFlow) commit(dir, branch, message string) (string, error) {
+	if err := g.verify(dir, branch); err != nil {
+		return "", err
+	}
+
+	if err := git(dir, "add", "-A"); err != nil {
+		return "", err
+	}
+	if err := git(dir, "diff", "--cached", "--quiet"); err == nil {
+		return "", nil
+	}
+
+	err := git(dir, "-c", "user.name="+g.authorName, "-c", "user.email="+g.authorEmail,
+		"commit", "-q", "--no-verify", "-m", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit on %s: %w", branch, err)
+	}
+	return gitOutput(dir, "rev-parse", "HEAD")
+}
+
+// currentBranch returns the branch checked out in dir, or an empty string when HEAD is detached
+func currentBranch(dir string) (string, error) {
+	return gitOutput(dir, "branch", "--show-current")
+}
+
+// commitMessage generates the message of the commit holding a task's result,
+// or only its error report when the pipeline failed
+func commitMessage(task *TaskMessage, succeeded bool) string {
+	subject := fmt.Sprintf("agent666: %s (issue #%s)", strings.ReplaceAll(taskDescription(task), "-", " "), task.IssueID)
+	if !succeeded {
+		subject = fmt.Sprintf("agent666: report failure of issue #%s", task.IssueID)
+	}
+	return fmt.Sprintf("%s\n\nTask: %s\nTask file: %s\n", subject, task.ID, task.TaskFilePath)
+}
+
+// interruptedMessage generates the message of the commit saving the changes of
+// a run that was interrupted before it finished
+func interruptedMessage(task *TaskMessage) string {
+	return fmt.Sprintf("agent666: interrupted run of issue #%s\n\nTask: %s\nTask file: %s\n", task.IssueID, task.ID, task.TaskFilePath)
+}
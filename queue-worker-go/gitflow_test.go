@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAgentBranch tests agent branch naming
+func TestAgentBranch(t *testing.T) {
+	tests := []struct {
+		name string
+		task TaskMessage
+		want string
+	}{
+		{"task file", TaskMessage{IssueID: "16", TaskFilePath: "docs/task/16-agent-intel.md"}, "agent666/issue-16-agent-intel"},
+		{"mixed case", TaskMessage{IssueID: "7", TaskFilePath: "/repo/docs/task/7 Fix_Login Page.md"}, "agent666/issue-7-fix-login-page"},
+		{"only issue", TaskMessage{IssueID: "3", TaskFilePath: "docs/task/3.md"}, "agent666/issue-3-task"},
+		{"no issue", TaskMessage{ID: "abc-123", TaskFilePath: "notes.md"}, "agent666/issue-abc-123-notes"},
+		{"long", TaskMessage{IssueID: "9", TaskFilePath: "9-" + strings.Repeat("word-", 20) + ".md"}, "agent666/issue-9-word-word-word-word-word-word-word-word"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AgentBranch(&tt.task); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestGitFlowIsProtected tests protected branch patterns
+func TestGitFlowIsProtected(t *testing.T) {
+	flow := NewGitFlow(parseList(DefaultProtectedBranches), "agent666", "agent666@localhost")
+
+	for branch, want := range map[string]bool{
+		"main":                          true,
+		"release/1.2":                   true,
+		"feature/login":                 true,
+		"experiment":                    false,
+		"agent666/issue-16-agent-intel": false,
+	} {
+		if got := flow.isProtected(branch); got != want {
+			t.Errorf("isProtected(%s): expected %v, got %v", branch, want, got)
+		}
+	}
+}
+
+// TestPipelineRunnerGitFlow tests that results are committed on the agent branch only
+func TestPipelineRunnerGitFlow(t *testing.T) {
+	repo := initRepository(t)
+	if err := git(repo, "checkout", "-q", "-b", "work"); err != nil {
+		t.Fatal(err)
+	}
+	script := writeScript(t, `echo "fixed" > fix.txt; echo "$AGENT_BRANCH"`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.sandbox = newTestSandbox(t, []string{"PATH"}, 0)
+	runner.git = NewGitFlow(parseList(DefaultProtectedBranches), "agent666", "agent666@localhost")
+
+	task := &TaskMessage{ID: "task-1", IssueID: "7", Repository: repo, TaskFilePath: filepath.Join(repo, "docs/task/7-fix-login.md")}
+	result := runner.Run(context.Background(), task, nil)
+	if !result.Succeeded() {
+		t.Fatalf("Expected success, got %v: %s", result.Err, result.Stderr)
+	}
+
+	branch := "agent666/issue-7-fix-login"
+	if result.Branch != branch || result.Commit == "" || strings.TrimSpace(result.Stdout) != branch {
+		t.Fatalf("Expected a commit on %s, got %+v", branch, result)
+	}
+
+	// The commit outlives the workspace, main is untouched
+	files, err := gitOutput(repo, "show", "--name-only", "--format=%s", branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != "agent666: fix login (issue #7)\n\nfix.txt" {
+		t.Errorf("Unexpected commit on %s: %q", branch, files)
+	}
+	if count, _ := gitOutput(repo, "rev-list", "--count", "main"); count != "1" {
+		t.Errorf("Expected main to keep 1 commit, got %s", count)
+	}
+
+	// A retry resets the branch instead of stacking commits
+	result = runner.Run(context.Background(), task, nil)
+	if count, _ := gitOutput(repo, "rev-list", "--count", branch); !result.Succeeded() || count != "2" {
+		t.Errorf("Expected the branch to be reset to main plus one commit, got %s commits: %v", count, result.Err)
+	}
+}
+
+// TestPipelineRunnerGitFlowProtected tests that protected branches are refused
+func TestPipelineRunnerGitFlowProtected(t *testing.T) {
+	repo := initRepository(t)
+	marker := filepath.Join(t.TempDir(), "ran")
+
+	// Without a sandbox the pipeline would run in a checkout of main
+	runner, err := NewPipelineRunner(writeScript(t, `touch `+marker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.git = NewGitFlow([]string{"main"}, "agent666", "agent666@localhost")
+
+	task := &TaskMessage{ID: "task-1", IssueID: "7", Repository: repo, TaskFilePath: "docs/task/7-fix.md"}
+	result := runner.Run(context.Background(), task, nil)
+	if !errors.Is(result.Err, ErrProtectedBranch) {
+		t.Errorf("Expected ErrProtectedBranch, got %v", result.Err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected the pipeline not to run")
+	}
+
+	// The sandbox worktree starts detached, the repository's branch is checked
+	runner.sandbox = newTestSandbox(t, []string{"PATH"}, 0)
+	result = runner.Run(context.Background(), task, nil)
+	if !errors.Is(result.Err, ErrProtectedBranch) {
+		t.Errorf("Expected ErrProtectedBranch in the sandbox, got %v", result.Err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected the pipeline not to run in the sandbox")
+	}
+
+	// A pipeline switching to a protected branch is not committed
+	runner, err = NewPipelineRunner(writeScript(t, `git checkout -q main && echo change > change.txt`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.sandbox = newTestSandbox(t, []string{"PATH"}, 0)
+	runner.git = NewGitFlow([]string{"main"}, "agent666", "agent666@localhost")
+
+	if err := git(repo, "checkout", "-q", "--detach"); err != nil {
+		t.Fatal(err)
+	}
+	result = runner.Run(context.Background(), task, nil)
+	if !errors.Is(result.Err, ErrProtectedBranch) || result.Succeeded() {
+		t.Errorf("Expected ErrProtectedBranch, got %v", result.Err)
+	}
+	if count, _ := gitOutput(repo, "rev-list", "--count", "main"); count != "1" {
+		t.Errorf("Expected main to keep 1 commit, got %s", count)
+	}
+}
+
+// TestPipelineRunnerGitFlowCheckout tests that unsandboxed runs refuse dirty
+// checkouts and switch the repository back to its branch
+func TestPipelineRunnerGitFlowCheckout(t *testing.T) {
+	repo := initRepository(t)
+	if err := git(repo, "checkout", "-q", "-b", "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewPipelineRunner(writeScript(t, `echo partial > fix.txt; exit 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.git = NewGitFlow([]string{"main"}, "agent666", "agent666@localhost")
+
+	task := &TaskMessage{ID: "task-1", IssueID: "7", Repository: repo, TaskFilePath: "docs/task/7-fix.md"}
+	result := runner.Run(context.Background(), task, nil)
+	if result.Succeeded() || result.Commit == "" {
+		t.Fatalf("Expected the failed run to be committed, got %+v", result)
+	}
+
+	// The changes stay on the agent branch, the checkout is back on work
+	if current, _ := currentBranch(repo); current != "work" {
+		t.Errorf("Expected the checkout back on work, got %q", current)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "fix.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the changes to stay on the agent branch")
+	}
+	if files, _ := gitOutput(repo, "show", "--name-only", "--format=", "agent666/issue-7-fix"); files != "fix.txt" {
+		t.Errorf("Expected fix.txt on the agent branch, got %q", files)
+	}
+
+	// Uncommitted changes would be carried to the agent branch
+	os.WriteFile(filepath.Join(repo, "wip.txt"), []byte("wip"), 0644)
+	result = runner.Run(context.Background(), task, nil)
+	if !errors.Is(result.Err, ErrDirtyCheckout) {
+		t.Errorf("Expected ErrDirtyCheckout, got %v", result.Err)
+	}
+	if current, _ := currentBranch(repo); current != "work" {
+		t.Errorf("Expected the checkout to stay on work, got %q", current)
+	}
+}
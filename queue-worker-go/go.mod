@@ -2,7 +2,10 @@ module queue-worker-go
 
 go 1.21
 
-require github.com/nats-io/nats.go v1.31.0
+require (
+	contracts-go v0.0.0
+	github.com/nats-io/nats.go v1.31.0
+)
 
 require (
 	github.com/klauspost/compress v1.17.0 // indirect
@@ -11,3 +14,5 @@ require (
 	golang.org/x/crypto v0.6.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
 )
+
+replace contracts-go => ../contracts-go
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inFlight tracks the tasks a worker is executing so shutdown can drain them
+type inFlight struct {
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	tasks      map[string]*runningTask
+	processed  int      // Tasks finished since the worker started
+	draining   bool     // Set once shutdown started
+	completed  []string // Tasks finished while draining
+	handedBack []string // Tasks returned to the queue while draining
+}
+
+// runningTask is a task being executed
+type runningTask struct {
+	cancel context.CancelCauseFunc
+}
+
+// newInFlight creates an empty in-flight tracker
+func newInFlight() *inFlight {
+	return &inFlight{tasks: make(map[string]*runningTask)}
+}
+
+// ErrDraining is returned when a task is started after shutdown began
+var ErrDraining = errors.New("worker is draining")
+
+// ErrTaskRunning is returned when a task is started while the worker already
+// executes it, e.g. when its message was redelivered
+var ErrTaskRunning = errors.New("task is already running")
+
+// start registers a task that is about to execute. It returns ErrDraining once
+// the worker is draining, in which case the task must be handed back, and
+// ErrTaskRunning for a task that is already executing, which the running copy
+// finishes.
+func (f *inFlight) start(taskID string, cancel context.CancelCauseFunc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.draining {
+		return ErrDraining
+	}
+	if _, ok := f.tasks[taskID]; ok {
+		return ErrTaskRunning
+	}
+
+	f.wg.Add(1)
+	f.tasks[taskID] = &runningTask{cancel: cancel}
+	return nil
+}
+
+// finish unregisters a task, recording whether it completed or was handed back
+func (f *inFlight) finish(taskID string, handedBack bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.tasks[taskID]; !ok {
+		return
+	}
+	delete(f.tasks, taskID)
+
+	switch {
+	case handedBack:
+		f.handedBack = append(f.handedBack, taskID)
+	case f.draining:
+		f.completed = append(f.completed, taskID)
+		f.processed++
+	default:
+		f.processed++
+	}
+	f.wg.Done()
+}
+
+// handBack records a task that was returned to the queue without being started
+func (f *inFlight) handBack(taskID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handedBack = append(f.handedBack, taskID)
+}
+
+// drain marks the start of shutdown and returns the tasks still executing
+func (f *inFlight) drain() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.draining = true
+	return f.runningLocked()
+}
+
+// snapshot returns the tasks executing and whether the worker is draining
+func (f *inFlight) snapshot() (running []string, draining bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.runningLocked(), f.draining
+}
+
+// runningLocked returns the IDs of the executing tasks in a stable order, f.mu must be held
+func (f *inFlight) runningLocked() []string {
+	running := make([]string, 0, len(f.tasks))
+	for taskID := range f.tasks {
+		running = append(running, taskID)
+	}
+	sort.Strings(running)
+	return running
+}
+
+// count returns the number of tasks executing
+func (f *inFlight) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.tasks)
+}
+
+// cancelAll stops every executing task
+func (f *inFlight) cancelAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, task := range f.tasks {
+		task.cancel(nil)
+	}
+}
+
+// cancel stops an executing task with the given cause. It returns false if the task isn't executing.
+func (f *inFlight) cancel(taskID string, cause error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	task, ok := f.tasks[taskID]
+	if !ok {
+		return false
+	}
+	task.cancel(cause)
+	return true
+}
+
+// wait blocks until all tasks finished or the timeout elapsed. It returns false on timeout.
+func (f *inFlight) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-deadline.C:
+		return false
+	}
+}
+
+// summary returns the number of tasks processed since start and the tasks
+// completed and handed back while draining
+func (f *inFlight) summary() (processed int, completed, handedBack []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	completed = append([]string(nil), f.completed...)
+	handedBack = append([]string(nil), f.handedBack...)
+	return f.processed, completed, handedBack
+}
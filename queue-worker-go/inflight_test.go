@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestInFlightDrain tests that draining refuses new tasks and records how running tasks ended
+func TestInFlightDrain(t *testing.T) {
+	tasks := newInFlight()
+
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	if err := tasks.start("task-1", cancel); err != nil {
+		t.Fatalf("Expected task-1 to start: %v", err)
+	}
+	if err := tasks.start("task-2", cancel); err != nil {
+		t.Fatalf("Expected task-2 to start: %v", err)
+	}
+	if err := tasks.start("task-3", cancel); err != nil {
+		t.Fatalf("Expected task-3 to start: %v", err)
+	}
+	tasks.finish("task-1", false)
+
+	if running, draining := tasks.snapshot(); len(running) != 2 || running[0] != "task-2" || draining {
+		t.Errorf("Expected task-2 and task-3 running before draining, got %v (draining %v)", running, draining)
+	}
+
+	running := tasks.drain()
+	if len(running) != 2 {
+		t.Fatalf("Expected 2 running tasks, got %v", running)
+	}
+	if _, draining := tasks.snapshot(); !draining {
+		t.Error("Expected snapshot to report draining")
+	}
+
+	if err := tasks.start("task-4", cancel); !errors.Is(err, ErrDraining) {
+		t.Errorf("Expected task-4 to be refused while draining, got %v", err)
+	}
+	tasks.handBack("task-4")
+
+	tasks.finish("task-2", false)
+	tasks.finish("task-3", true)
+
+	if !tasks.wait(time.Second) {
+		t.Fatal("Expected wait to return once all tasks finished")
+	}
+
+	processed, completed, handedBack := tasks.summary()
+	if processed != 2 {
+		t.Errorf("Expected 2 processed tasks, got %d", processed)
+	}
+	if len(completed) != 1 || completed[0] != "task-2" {
+		t.Errorf("Expected task-2 completed while draining, got %v", completed)
+	}
+	if len(handedBack) != 2 || handedBack[0] != "task-4" || handedBack[1] != "task-3" {
+		t.Errorf("Expected task-4 and task-3 handed back, got %v", handedBack)
+	}
+}
+
+// TestInFlightWaitTimeout tests that wait gives up and cancelAll stops running tasks
+func TestInFlightWaitTimeout(t *testing.T) {
+	tasks := newInFlight()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	tasks.start("task-1", cancel)
+	tasks.drain()
+
+	if tasks.wait(20 * time.Millisecond) {
+		t.Fatal("Expected wait to time out with a running task")
+	}
+
+	go func() {
+		<-ctx.Done()
+		tasks.finish("task-1", true)
+	}()
+	tasks.cancelAll()
+
+	if !tasks.wait(time.Second) {
+		t.Fatal("Expected cancelled task to finish")
+	}
+	if tasks.count() != 0 {
+		t.Errorf("Expected no running tasks, got %d", tasks.count())
+	}
+}
+
+// TestInFlightDuplicate tests that a task started twice is refused without keeping shutdown waiting
+func TestInFlightDuplicate(t *testing.T) {
+	tasks := newInFlight()
+
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	if err := tasks.start("task-1", cancel); err != nil {
+		t.Fatalf("Expected task-1 to start: %v", err)
+	}
+	if err := tasks.start("task-1", cancel); !errors.Is(err, ErrTaskRunning) {
+		t.Fatalf("Expected redelivered task-1 to be refused, got %v", err)
+	}
+	if count := tasks.count(); count != 1 {
+		t.Errorf("Expected 1 running task, got %d", count)
+	}
+
+	tasks.drain()
+	tasks.finish("task-1", false)
+
+	if !tasks.wait(time.Second) {
+		t.Fatal("Expected wait to return once the task finished")
+	}
+	if processed, _, _ := tasks.summary(); processed != 1 {
+		t.Errorf("Expected 1 processed task, got %d", processed)
+	}
+}
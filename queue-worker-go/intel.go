@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IntelTask represents a prioritized task returned by agent-intel-go
+type IntelTask struct {
+	TaskID       string    `json:"task_id"`
+	IssueID      string    `json:"issue_id"`
+	Repository   string    `json:"repository"`
+	TaskFilePath string    `json:"task_file_path"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	AssignedAt   time.Time `json:"assigned_at,omitempty"`
+	WorkerID     string    `json:"worker_id,omitempty"`
+	Capabilities []string  `json:"capabilities,omitempty"`
+}
+
+// NextTaskResponse represents the response of GET /api/v1/queue/next
+type NextTaskResponse struct {
+	Task  *IntelTask `json:"task,omitempty"`
+	Score float64    `json:"score,omitempty"`
+}
+
+// ErrLeaseLost is returned when agent-intel-go no longer considers the task assigned to this worker
+var ErrLeaseLost = errors.New("task lease lost")
+
+// AgentIntelClient talks to the agent-intel-go REST API
+type AgentIntelClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewAgentIntelClient creates a new agent-intel-go client
+func NewAgentIntelClient(baseURL string) *AgentIntelClient {
+	return &AgentIntelClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// NextTask claims the highest scored pending task for a worker, optionally
+// restricted to a repository. Only tasks whose required capabilities the worker
+// declares are claimed. It returns nil when no task is available.
+func (c *AgentIntelClient) NextTask(repoID, workerID string, capabilities []string) (*NextTaskResponse, error) {
+	query := url.Values{}
+	// Always sent, an empty list only matches tasks without requirements
+	query.Set("capabilities", strings.Join(capabilities, ","))
+	if repoID != "" {
+		query.Set("repo_id", repoID)
+	}
+	if workerID != "" {
+		query.Set("worker_id", workerID)
+	}
+
+	endpoint := c.baseURL + "/api/v1/queue/next?" + query.Encode()
+
+	resp, err := c.httpClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request next task: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request next task: status %d", resp.StatusCode)
+	}
+
+	var next NextTaskResponse
+	if err := json.NewDecoder(resp.Body).Decode(&next); err != nil {
+		return nil, fmt.Errorf("failed to decode next task: %w", err)
+	}
+
+	if next.Task == nil {
+		return nil, nil
+	}
+
+	return &next, nil
+}
+
+// Heartbeat extends the assignment lease of a task held by the worker
+func (c *AgentIntelClient) Heartbeat(taskID, workerID string) error {
+	return c.postJSON("/api/v1/tasks/heartbeat", map[string]string{
+		"task_id":   taskID,
+		"worker_id": workerID,
+	})
+}
+
+// StartTask marks a claimed task as processing
+func (c *AgentIntelClient) StartTask(taskID, workerID string) error {
+	return c.postJSON("/api/v1/tasks/start", map[string]string{
+		"task_id":   taskID,
+		"worker_id": workerID,
+	})
+}
+
+// postJSON sends a JSON request to agent-intel-go, mapping 404 and 409 to ErrLeaseLost
+func (c *AgentIntelClient) postJSON(path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.httpClient.Post(c.baseURL+path, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusConflict:
+		return ErrLeaseLost
+	default:
+		return fmt.Errorf("failed to call %s: status %d", path, resp.StatusCode)
+	}
+}
+
+// toTaskMessage converts an agent-intel task to the worker's task representation
+func (t *IntelTask) toTaskMessage() *TaskMessage {
+	return &TaskMessage{
+		ID:           t.TaskID,
+		IssueID:      t.IssueID,
+		Repository:   t.Repository,
+		TaskFilePath: t.TaskFilePath,
+		Status:       t.Status,
+		CreatedAt:    t.CreatedAt,
+		UpdatedAt:    t.AssignedAt,
+		Capabilities: t.Capabilities,
+	}
+}
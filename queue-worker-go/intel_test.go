@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAgentIntelClientNextTask tests fetching the next prioritized task
+func TestAgentIntelClientNextTask(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/queue/next" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		if r.URL.Query().Get("repo_id") != "/test/repo" {
+			t.Errorf("Expected repo_id /test/repo, got %q", r.URL.Query().Get("repo_id"))
+		}
+
+		if r.URL.Query().Get("worker_id") != "worker-1" {
+			t.Errorf("Expected worker_id worker-1, got %q", r.URL.Query().Get("worker_id"))
+		}
+
+		if r.URL.Query().Get("capabilities") != "docker,go" {
+			t.Errorf("Expected capabilities docker,go, got %q", r.URL.Query().Get("capabilities"))
+		}
+
+		json.NewEncoder(w).Encode(NextTaskResponse{
+			Task: &IntelTask{
+				TaskID:       "task-1",
+				IssueID:      "1",
+				Repository:   "/test/repo",
+				TaskFilePath: "/test/repo/docs/task/1-test.md",
+				Status:       "assigned",
+			},
+			Score: 0.8,
+		})
+	}))
+	defer server.Close()
+
+	client := NewAgentIntelClient(server.URL + "/")
+	next, err := client.NextTask("/test/repo", "worker-1", []string{"docker", "go"})
+	if err != nil {
+		t.Fatalf("NextTask failed: %v", err)
+	}
+
+	if next == nil || next.Task == nil {
+		t.Fatal("Expected task, got nil")
+	}
+
+	task := next.Task.toTaskMessage()
+	if task.ID != "task-1" {
+		t.Errorf("Expected task ID task-1, got %s", task.ID)
+	}
+
+	if task.TaskFilePath != "/test/repo/docs/task/1-test.md" {
+		t.Errorf("Unexpected task file path %s", task.TaskFilePath)
+	}
+
+	if next.Score != 0.8 {
+		t.Errorf("Expected score 0.8, got %v", next.Score)
+	}
+}
+
+// TestAgentIntelClientNoTasks tests that 404 means no task is available
+func TestAgentIntelClientNoTasks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "no tasks available"})
+	}))
+	defer server.Close()
+
+	next, err := NewAgentIntelClient(server.URL).NextTask("", "", nil)
+	if err != nil {
+		t.Fatalf("NextTask failed: %v", err)
+	}
+
+	if next != nil {
+		t.Errorf("Expected nil when no tasks are available, got %+v", next)
+	}
+}
+
+// TestAgentIntelClientServerError tests error propagation
+func TestAgentIntelClientServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if _, err := NewAgentIntelClient(server.URL).NextTask("", "", nil); err == nil {
+		t.Error("Expected error for server failure")
+	}
+}
+
+// TestAgentIntelClientHeartbeat tests lease heartbeat responses
+func TestAgentIntelClientHeartbeat(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tasks/heartbeat" || r.Method != http.MethodPost {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["task_id"] != "task-1" || body["worker_id"] != "worker-1" {
+			t.Errorf("Unexpected heartbeat body %v", body)
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := NewAgentIntelClient(server.URL)
+
+	if err := client.Heartbeat("task-1", "worker-1"); err != nil {
+		t.Errorf("Expected heartbeat to succeed, got %v", err)
+	}
+
+	status = http.StatusConflict
+	if err := client.Heartbeat("task-1", "worker-1"); err != ErrLeaseLost {
+		t.Errorf("Expected ErrLeaseLost, got %v", err)
+	}
+
+	status = http.StatusInternalServerError
+	if err := client.Heartbeat("task-1", "worker-1"); err == nil || err == ErrLeaseLost {
+		t.Errorf("Expected transient error, got %v", err)
+	}
+}
+
+// TestAgentIntelClientStartTask tests marking a task as processing
+func TestAgentIntelClientStartTask(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tasks/start" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	if err := NewAgentIntelClient(server.URL).StartTask("task-1", "worker-1"); err != ErrLeaseLost {
+		t.Errorf("Expected ErrLeaseLost for 409, got %v", err)
+	}
+}
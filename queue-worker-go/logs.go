@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"contracts-go/events"
+	"contracts-go/subjects"
+	"contracts-go/tasklogs"
+
+	"github.com/nats-io/nats.go"
+)
+
+// maxLogChunkBytes limits the output carried by one log chunk, well below the
+// server's maximum payload
+const maxLogChunkBytes = 32 * 1024
+
+// LogChunk is defined in contracts-go/events
+type LogChunk = events.LogChunk
+
+// taskLog captures the output of a pipeline run. Output is published on
+// logs.<task id> as it is written so queue-go can tail it, and the complete log
+// is saved in the TASK_LOGS object store once the run finished.
+type taskLog struct {
+	js      nats.JetStreamContext // Nil when output is not published
+	store   nats.ObjectStore      // Nil when the complete log is not saved
+	taskID  string
+	subject string
+
+	mu            sync.Mutex
+	output        bytes.Buffer
+	publishFailed bool // Only the first failed publish is logged
+}
+
+// newTaskLog starts the log of a task run, dropping the chunks of earlier runs
+// so a retried task's log only holds its last run
+func (w *Worker) newTaskLog(taskID string) *taskLog {
+	l := &taskLog{
+		js:      w.js,
+		store:   w.logStore,
+		taskID:  taskID,
+		subject: subjects.TaskLogSubject(taskID),
+	}
+
+	if l.js != nil {
+		err := l.js.PurgeStream(subjects.StreamLogs, &nats.StreamPurgeRequest{Subject: l.subject})
+		if err != nil {
+			log.Printf("Warning: failed to purge earlier logs of task %s: %v", taskID, err)
+		}
+	}
+	return l
+}
+
+// writer returns a writer appending the output of one stream (stdout or stderr) to the log
+func (l *taskLog) writer(stream string) io.Writer {
+	return &taskLogWriter{log: l, stream: stream}
+}
+
+// taskLogWriter is the writer of one output stream
+type taskLogWriter struct {
+	log    *taskLog
+	stream string
+}
+
+// Write appends p to the log and publishes it
+func (lw *taskLogWriter) Write(p []byte) (int, error) {
+	lw.log.write(lw.stream, p)
+	return len(p), nil
+}
+
+// write appends output to the log and publishes it in chunks. Publish failures
+// never fail the pipeline, the complete log is still saved at the end.
+func (l *taskLog) write(stream string, p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.output.Write(p)
+	if l.js == nil {
+		return
+	}
+
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxLogChunkBytes {
+			n = maxLogChunkBytes
+		}
+		l.publish(&LogChunk{TaskID: l.taskID, Stream: stream, Data: string(p[:n]), Time: time.Now()}, false)
+		p = p[n:]
+	}
+}
+
+// publish sends a chunk, asynchronously unless it is the final one. Callers hold mu.
+func (l *taskLog) publish(chunk *LogChunk, wait bool) {
+	data, err := json.Marshal(chunk)
+	if err == nil {
+		if wait {
+			_, err = l.js.Publish(l.subject, data)
+		} else {
+			_, err = l.js.PublishAsync(l.subject, data)
+		}
+	}
+
+	if err != nil && !l.publishFailed {
+		l.publishFailed = true
+		log.Printf("Warning: failed to publish log of task %s: %v", l.taskID, err)
+	}
+}
+
+// close saves the complete log and publishes the final chunk, which tells
+// tailing clients the run finished
+func (l *taskLog) close(result *PipelineResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.store != nil {
+		if err := tasklogs.Put(l.store, l.taskID, l.output.Bytes()); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	if l.js == nil {
+		return
+	}
+	final := &LogChunk{TaskID: l.taskID, Final: true, ExitCode: result.ExitCode, Time: time.Now()}
+	if result.Err != nil {
+		final.Error = result.Err.Error()
+	}
+	l.publish(final, true)
+}
+
+// String returns the output captured so far
+func (l *taskLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.output.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestPipelineRunnerTaskLog tests that stdout and stderr are both captured in the task log
+func TestPipelineRunnerTaskLog(t *testing.T) {
+	script := writeScript(t, `echo "building"; echo "warning: deprecated" >&2; exit 1`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := newWorker("worker-1", nil, runner, 1)
+	output := worker.newTaskLog("task-1")
+	result := runner.Run(context.Background(), &TaskMessage{ID: "task-1"}, output)
+	output.close(result)
+
+	if result.Stdout != "building\n" || result.Stderr != "warning: deprecated\n" {
+		t.Errorf("Expected output to still be captured in the result, got %+v", result)
+	}
+
+	// Both streams are captured, their interleaving depends on scheduling
+	got := output.String()
+	if len(got) != len("building\nwarning: deprecated\n") || !containsAll(got, "building\n", "warning: deprecated\n") {
+		t.Errorf("Expected log to contain stdout and stderr, got %q", got)
+	}
+}
+
+// TestTaskLogChunks tests that large writes are captured whole
+func TestTaskLogChunks(t *testing.T) {
+	output := &taskLog{taskID: "task-1"}
+	data := make([]byte, 3*maxLogChunkBytes+10)
+	for i := range data {
+		data[i] = 'a'
+	}
+
+	if n, err := output.writer(LogStdout).Write(data); err != nil || n != len(data) {
+		t.Fatalf("Expected %d bytes written, got %d: %v", len(data), n, err)
+	}
+	if got := output.String(); got != string(data) {
+		t.Errorf("Expected %d bytes in the log, got %d", len(data), len(got))
+	}
+}
+
+// containsAll reports whether s contains every substring
+func containsAll(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,31 +1,96 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"contracts-go/backoff"
+	"contracts-go/deadletter"
+	"contracts-go/fleet"
+	"contracts-go/model"
+	"contracts-go/subjects"
+	"contracts-go/tasklogs"
+
 	"github.com/nats-io/nats.go"
 )
 
 const (
-	// Stream and subject names
-	StreamName     = "TASKS"
-	SubjectTaskNew = "tasks.new"
-	ConsumerName   = "task-workers"
+	// StreamName is the stream tasks are consumed from
+	StreamName = subjects.StreamTasks
+
+	// MaxDeliver is the number of delivery attempts before a task is dead-lettered
+	MaxDeliver = 3
+
+	// AckWait is how long JetStream waits for an acknowledgment before redelivering
+	AckWait = 30 * time.Second
+
+	// DefaultHeartbeatInterval is how often running task messages are marked in
+	// progress, well within AckWait
+	DefaultHeartbeatInterval = 10 * time.Second
+
+	// DefaultTaskTimeout matches the longest runtime agent-intel-go expects from a pipeline
+	DefaultTaskTimeout = 40 * time.Minute
+
+	// MaxAckPending is the default limit of unacknowledged task messages across all workers
+	MaxAckPending = 100
+
+	// maxFetchBatch is the most messages fetched at once
+	maxFetchBatch = 10
+
+	// Worker modes
+	ModeStream = "stream" // Consume tasks.new in FIFO order
+	ModePull   = "pull"   // Ask agent-intel-go for the highest scored task
 )
 
+// ErrTaskTimeout is reported when a pipeline is killed for exceeding the task timeout
+var ErrTaskTimeout = errors.New("pipeline timed out")
+
 func main() {
+	// Started by the sandbox to run a pipeline under resource limits
+	if len(os.Args) > 1 && os.Args[1] == limitsHelper {
+		runLimitsHelper(os.Args[2:])
+	}
+
 	// Get NATS URL from environment
 	natsURL := os.Getenv("NATS_URL")
 	if natsURL == "" {
 		natsURL = "nats://localhost:4222"
 	}
 
+	// Get pipeline command (executable plus optional arguments)
+	pipelineCommand := os.Getenv("PIPELINE_COMMAND")
+	runner, err := NewPipelineRunner(pipelineCommand)
+	if err != nil {
+		log.Fatalf("Invalid PIPELINE_COMMAND: %v", err)
+	}
+
+	mode := getEnv("WORKER_MODE", ModeStream)
+	if mode != ModeStream && mode != ModePull {
+		log.Fatalf("Invalid WORKER_MODE %q (expected %s or %s)", mode, ModeStream, ModePull)
+	}
+
+	workerID := os.Getenv("WORKER_ID")
+	if workerID == "" {
+		workerID, _ = os.Hostname()
+	}
+
 	log.Printf("Queue Worker starting...")
+	log.Printf("Worker ID: %s", workerID)
 	log.Printf("NATS URL: %s", natsURL)
+	log.Printf("Pipeline command: %s", pipelineCommand)
+	log.Printf("Worker mode: %s", mode)
 
 	// Connect to NATS with retry logic
 	nc, err := connectWithRetry(natsURL, 10, 5*time.Second)
@@ -42,33 +107,208 @@ func main() {
 		log.Fatalf("Failed to get JetStream context: %v", err)
 	}
 
-	// Ensure stream exists (should be created by queue-go, but double check)
-	ensureStream(js)
+	// Ensure streams exist (should be created by queue-go, but double check)
+	ensureStreams(js)
+
+	// Fail fast if completion events or dead letters would not be captured by their streams
+	if err := subjects.VerifyPublished(js, subjects.ServiceWorker); err != nil {
+		log.Fatalf("Subject contract violated: %v", err)
+	}
+
+	// Same BACKOFF_* configuration as queue-go
+	retryPolicy, err := backoff.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid backoff configuration: %v", err)
+	}
+
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil || shutdownTimeout <= 0 {
+		log.Fatalf("Invalid SHUTDOWN_TIMEOUT: %v", err)
+	}
+
+	concurrency, err := strconv.Atoi(getEnv("WORKER_CONCURRENCY", "1"))
+	if err != nil || concurrency < 1 {
+		log.Fatalf("Invalid WORKER_CONCURRENCY %q (expected a positive number)", os.Getenv("WORKER_CONCURRENCY"))
+	}
+
+	taskTimeout, err := time.ParseDuration(getEnv("TASK_TIMEOUT", DefaultTaskTimeout.String()))
+	if err != nil || taskTimeout <= 0 {
+		log.Fatalf("Invalid TASK_TIMEOUT: %v", err)
+	}
+
+	ackHeartbeat, err := time.ParseDuration(getEnv("ACK_HEARTBEAT_INTERVAL", DefaultHeartbeatInterval.String()))
+	if err != nil || ackHeartbeat <= 0 || ackHeartbeat >= AckWait {
+		log.Fatalf("Invalid ACK_HEARTBEAT_INTERVAL %q (expected a duration below %v)", os.Getenv("ACK_HEARTBEAT_INTERVAL"), AckWait)
+	}
+
+	registryInterval, err := time.ParseDuration(getEnv("REGISTRY_HEARTBEAT_INTERVAL", fleet.DefaultHeartbeatInterval.String()))
+	if err != nil || registryInterval <= 0 {
+		log.Fatalf("Invalid REGISTRY_HEARTBEAT_INTERVAL: %v", err)
+	}
+
+	capabilities, err := model.NormalizeCapabilities(parseList(os.Getenv("WORKER_CAPABILITIES")))
+	if err != nil {
+		log.Fatalf("Invalid WORKER_CAPABILITIES: %v", err)
+	}
 
-	// Create or get consumer
-	ensureConsumer(js)
+	sandboxEnabled, err := strconv.ParseBool(getEnv("SANDBOX_ENABLED", "false"))
+	if err != nil {
+		log.Fatalf("Invalid SANDBOX_ENABLED: %v", err)
+	}
+	if sandboxEnabled {
+		cpuSeconds, err := strconv.Atoi(getEnv("SANDBOX_CPU_SECONDS", "0"))
+		if err != nil {
+			log.Fatalf("Invalid SANDBOX_CPU_SECONDS: %v", err)
+		}
+		memoryMB, err := strconv.Atoi(getEnv("SANDBOX_MEMORY_MB", "0"))
+		if err != nil {
+			log.Fatalf("Invalid SANDBOX_MEMORY_MB: %v", err)
+		}
+
+		// Owned by this worker only, so leftovers of a crashed run can be removed on startup
+		workspaceDir := filepath.Join(getEnv("SANDBOX_WORKSPACE_DIR", os.TempDir()), "queue-worker-"+sanitizeName(workerID))
+		runner.sandbox, err = NewSandbox(workspaceDir, parseList(getEnv("SANDBOX_ENV_ALLOWLIST", DefaultEnvAllowlist)), cpuSeconds, memoryMB)
+		if err != nil {
+			log.Fatalf("Failed to set up sandbox: %v", err)
+		}
+		log.Printf("Sandbox: workspaces in %s, CPU limit %ds, memory limit %dMB (0 = unlimited)", workspaceDir, cpuSeconds, memoryMB)
+	} else {
+		log.Printf("Sandbox disabled, pipelines run in the repository with the worker's environment")
+	}
+
+	gitFlowEnabled, err := strconv.ParseBool(getEnv("GIT_FLOW_ENABLED", "true"))
+	if err != nil {
+		log.Fatalf("Invalid GIT_FLOW_ENABLED: %v", err)
+	}
+	if gitFlowEnabled {
+		protected := parseList(getEnv("GIT_PROTECTED_BRANCHES", DefaultProtectedBranches))
+		runner.git = NewGitFlow(protected, getEnv("GIT_AUTHOR_NAME", "agent666"), getEnv("GIT_AUTHOR_EMAIL", "agent666@localhost"))
+		log.Printf("Git flow: work goes on %sissue-<id>-<desc> branches, protected branches %v", AgentBranchPrefix, protected)
+	}
+
+	reportsEnabled, err := strconv.ParseBool(getEnv("REPORTS_ENABLED", "true"))
+	if err != nil {
+		log.Fatalf("Invalid REPORTS_ENABLED: %v", err)
+	}
+	if reportsEnabled {
+		runner.reporter = NewReporter(workerID)
+	}
+
+	worker := newWorker(workerID, js, runner, concurrency)
+	worker.backoff = retryPolicy
+	worker.taskTimeout = taskTimeout
+	worker.heartbeatInterval = ackHeartbeat
+	log.Printf("Worker concurrency: %d", concurrency)
+	log.Printf("Task timeout: %v", taskTimeout)
+	log.Printf("Capabilities: %v", capabilities)
+
+	// Announce the worker in the WORKERS registry; the worker still runs without it
+	worker.registration, err = register(js, fleet.Worker{
+		ID:           workerID,
+		Mode:         mode,
+		Capabilities: capabilities,
+		Concurrency:  concurrency,
+	}, worker.tasks, registryInterval)
+	if err != nil {
+		log.Printf("Warning: failed to register worker, retrying every %v: %v", registryInterval, err)
+	}
 
-	// Subscribe to tasks
-	sub, err := js.PullSubscribe(SubjectTaskNew, ConsumerName)
+	// Save the complete output of every run; output is still streamed without the store
+	worker.logStore, err = tasklogs.EnsureStore(js)
 	if err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
+		log.Printf("Warning: task logs won't be saved: %v", err)
 	}
 
-	log.Println("Successfully subscribed to task queue")
-	log.Println("Waiting for tasks...")
+	// Stop running tasks as soon as they are cancelled
+	if _, err := worker.subscribeCancels(); err != nil {
+		log.Printf("Warning: failed to subscribe to task cancellations: %v", err)
+	}
+
+	// Cancelled on shutdown to stop fetching or polling for new tasks
+	ctx, stopFetching := context.WithCancel(context.Background())
+	loopDone := make(chan struct{})
 
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Start processing messages
-	go processMessages(sub)
+	if mode == ModePull {
+		agentIntelURL := getEnv("AGENT_INTEL_URL", "http://localhost:8082")
+		repoID := os.Getenv("REPO_ID")
+		pollInterval, err := time.ParseDuration(getEnv("POLL_INTERVAL", "5s"))
+		if err != nil {
+			log.Fatalf("Invalid POLL_INTERVAL: %v", err)
+		}
+		heartbeatInterval, err := time.ParseDuration(getEnv("LEASE_HEARTBEAT_INTERVAL", "1m"))
+		if err != nil || heartbeatInterval <= 0 {
+			log.Fatalf("Invalid LEASE_HEARTBEAT_INTERVAL: %v", err)
+		}
+
+		log.Printf("Agent Intel URL: %s", agentIntelURL)
+		if repoID != "" {
+			log.Printf("Repository filter: %s", repoID)
+		}
+
+		worker.intel = NewAgentIntelClient(agentIntelURL)
+		worker.capabilities = capabilities
+
+		log.Println("Waiting for prioritized tasks...")
+
+		// Start one poller per slot, each running one task at a time
+		var pollers sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			pollers.Add(1)
+			go func() {
+				defer pollers.Done()
+				worker.pollAgentIntel(ctx, repoID, pollInterval, heartbeatInterval)
+			}()
+		}
+		go func() {
+			pollers.Wait()
+			close(loopDone)
+		}()
+	} else {
+		// Tasks without requirements are always fetched, routed tasks once the
+		// stream holds tasks on a route this worker can serve
+		router := newRouter(js, worker, capabilities, retryPolicy, concurrency)
+		if err := router.bind(ctx, nil); err != nil {
+			log.Fatalf("Failed to subscribe to task queue: %v", err)
+		}
+
+		log.Println("Successfully subscribed to task queue")
+		log.Println("Waiting for tasks...")
+
+		go func() {
+			router.run(ctx, RouteScanInterval)
+			close(loopDone)
+		}()
+	}
 
 	// Wait for shutdown signal
 	<-sigChan
-	log.Println("Shutting down gracefully...")
-	sub.Unsubscribe()
-	nc.Close()
+	log.Printf("Shutting down gracefully (timeout %v)...", shutdownTimeout)
+	stopFetching()
+	worker.shutdown(nc, loopDone, shutdownTimeout)
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// parseList splits a comma separated list, dropping empty entries
+func parseList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // connectWithRetry attempts to connect to NATS with retries
@@ -102,94 +342,518 @@ func connectWithRetry(url string, maxRetries int, delay time.Duration) (*nats.Co
 	return nil, err
 }
 
-// ensureStream ensures the TASKS stream exists
-func ensureStream(js nats.JetStreamContext) {
-	streamConfig := &nats.StreamConfig{
-		Name:        StreamName,
-		Description: "Task queue for Agent666",
-		Subjects:    []string{"tasks.*"},
-		Retention:   nats.WorkQueuePolicy,
-		MaxAge:      7 * 24 * time.Hour,
-		Storage:     nats.FileStorage,
-		Replicas:    1,
-		Discard:     nats.DiscardOld,
-	}
-
-	_, err := js.StreamInfo(StreamName)
-	if err == nats.ErrStreamNotFound {
-		log.Printf("Stream %s not found, creating...", StreamName)
-		_, err = js.AddStream(streamConfig)
-		if err != nil {
-			log.Printf("Warning: failed to create stream: %v", err)
-		} else {
-			log.Printf("Stream %s created successfully", StreamName)
+// ensureStreams ensures the TASKS stream, the TASK_EVENTS stream used for status
+// updates, the dead letter stream, the AGENT stream used for completion events
+// and the LOGS stream used for pipeline output exist
+func ensureStreams(js nats.JetStreamContext) {
+	for _, name := range []string{StreamName, subjects.StreamTaskEvents, subjects.StreamTasksDLQ, subjects.StreamAgent, subjects.StreamLogs} {
+		if err := subjects.EnsureStream(js, name); err != nil {
+			log.Printf("Warning: %v", err)
 		}
 	}
 }
 
-// ensureConsumer ensures the consumer exists
-func ensureConsumer(js nats.JetStreamContext) {
+// ensureConsumer ensures the consumer of the tasks requiring the given
+// capabilities exists with the redelivery schedule of policy and returns its
+// MaxAckPending. Every worker able to run those tasks shares the consumer.
+func ensureConsumer(js nats.JetStreamContext, capabilities []string, policy backoff.Policy) int {
+	name := subjects.TaskWorkersConsumer(capabilities)
 	consumerConfig := &nats.ConsumerConfig{
-		Durable:       ConsumerName,
+		Durable:       name,
 		Description:   "Durable consumer for processing tasks",
 		AckPolicy:     nats.AckExplicitPolicy,
-		MaxDeliver:    3,
-		AckWait:       30 * time.Second,
+		MaxDeliver:    MaxDeliver,
+		AckWait:       AckWait,
+		BackOff:       backoff.Schedule(policy, AckWait, MaxDeliver),
 		DeliverPolicy: nats.DeliverNewPolicy,
-		FilterSubject: SubjectTaskNew,
-		MaxAckPending: 100,
+		FilterSubject: subjects.TaskNewSubject(capabilities),
+		MaxAckPending: MaxAckPending,
 		ReplayPolicy:  nats.ReplayInstantPolicy,
 	}
+	if len(capabilities) > 0 {
+		// Routed tasks may be published before the first capable worker starts
+		consumerConfig.Description = fmt.Sprintf("Durable consumer for tasks requiring %s", strings.Join(capabilities, ", "))
+		consumerConfig.DeliverPolicy = nats.DeliverAllPolicy
+	}
 
-	_, err := js.ConsumerInfo(StreamName, ConsumerName)
+	info, err := js.ConsumerInfo(StreamName, name)
 	if err == nats.ErrConsumerNotFound {
-		log.Printf("Consumer %s not found, creating...", ConsumerName)
-		_, err = js.AddConsumer(StreamName, consumerConfig)
+		log.Printf("Consumer %s not found, creating...", name)
+		info, err = js.AddConsumer(StreamName, consumerConfig)
 		if err != nil {
 			log.Printf("Warning: failed to create consumer: %v", err)
 		} else {
-			log.Printf("Consumer %s created successfully", ConsumerName)
+			log.Printf("Consumer %s created successfully", name)
+		}
+	} else if err == nil {
+		// Apply backoff changes to the existing consumer, keeping its tuned limits
+		updated := info.Config
+		updated.MaxDeliver = consumerConfig.MaxDeliver
+		updated.BackOff = consumerConfig.BackOff
+		if updateInfo, updateErr := js.UpdateConsumer(StreamName, &updated); updateErr != nil {
+			log.Printf("Warning: failed to update consumer %s: %v", name, updateErr)
+		} else {
+			info = updateInfo
 		}
 	}
+
+	if err != nil || info.Config.MaxAckPending <= 0 {
+		return MaxAckPending
+	}
+	return info.Config.MaxAckPending
 }
 
-// processMessages continuously processes messages from the queue
-func processMessages(sub *nats.Subscription) {
-	for {
-		// Fetch a batch of messages (max 10 at a time)
-		msgs, err := sub.Fetch(10, nats.MaxWait(5*time.Second))
+// fetchLimit returns how many messages a single fetch may request: never more
+// than the worker can run at once nor than the consumer lets be unacknowledged
+func fetchLimit(concurrency, maxAckPending int) int {
+	limit := maxFetchBatch
+	if concurrency < limit {
+		limit = concurrency
+	}
+	if maxAckPending < limit {
+		limit = maxAckPending
+	}
+	return limit
+}
+
+// Worker executes tasks and reports their results
+type Worker struct {
+	id     string
+	js     nats.JetStreamContext
+	runner *PipelineRunner
+	intel  *AgentIntelClient // Only set in pull mode
+
+	capabilities []string // Sent when claiming tasks (pull mode)
+
+	pool    *pool
+	backoff backoff.Policy // Delays redelivery of tasks whose result couldn't be reported
+
+	taskTimeout       time.Duration // Pipeline runs are killed after this long
+	heartbeatInterval time.Duration // How often running messages are marked in progress (stream mode)
+
+	registration *registration    // Record in the WORKERS registry, nil when not announced
+	logStore     nats.ObjectStore // Nil when task logs can't be saved
+
+	tasks     *inFlight
+	cancelled *cancellations  // Tasks cancelled through tasks.cancel
+	runCtx    context.Context // Cancelled when in-flight tasks must be interrupted
+	stopRun   context.CancelFunc
+}
+
+// newWorker creates a worker running up to concurrency tasks at once
+func newWorker(id string, js nats.JetStreamContext, runner *PipelineRunner, concurrency int) *Worker {
+	runCtx, stopRun := context.WithCancel(context.Background())
+	return &Worker{
+		id:      id,
+		js:      js,
+		runner:  runner,
+		pool:    newPool(concurrency),
+		backoff: backoff.Default(),
+
+		taskTimeout:       DefaultTaskTimeout,
+		heartbeatInterval: DefaultHeartbeatInterval,
+
+		tasks:     newInFlight(),
+		cancelled: newCancellations(),
+		runCtx:    runCtx,
+		stopRun:   stopRun,
+	}
+}
+
+// processMessages continuously processes messages from the queue until ctx is
+// cancelled, requesting at most limit messages per fetch
+func (w *Worker) processMessages(ctx context.Context, sub *nats.Subscription, limit int) {
+	defer w.pool.wait()
+
+	for ctx.Err() == nil {
+		// Only fetch as many messages as there are free slots, so fetched
+		// messages don't sit unacknowledged while other tasks run. The slots
+		// aren't held during the fetch: the idle fetches of the other routes
+		// would keep them from a route with tasks.
+		free := w.pool.waitFree(ctx)
+		if free == 0 {
+			return
+		}
+		batch := limit
+		if free < batch {
+			batch = free
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		msgs, err := sub.Fetch(batch, nats.Context(fetchCtx))
+		cancel()
 		if err != nil {
 			// Timeout is expected when no messages available
-			if err != nats.ErrTimeout {
+			if !isFetchTimeout(err) {
 				log.Printf("Error fetching messages: %v", err)
 			}
 			continue
 		}
 
 		for _, msg := range msgs {
-			processTask(msg)
+			// Another route may have taken the slot since the fetch started,
+			// the message is marked in progress until a task finishes
+			msg := msg
+			if !w.pool.acquire(ctx, w.heartbeatInterval, func() { msg.InProgress() }) {
+				// Shutting down, let another worker take the rest of the batch
+				w.handBack(msg)
+				continue
+			}
+
+			w.pool.run(func() { w.processTask(msg) })
 		}
 	}
 }
 
-// processTask processes a single task message
-func processTask(msg *nats.Msg) {
-	log.Printf("Received task: %s", string(msg.Data))
+// isFetchTimeout reports whether a fetch ended because no messages arrived in time or shutdown started
+func isFetchTimeout(err error) bool {
+	return errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
 
-	// Simulate task processing
-	// In a real implementation, this would:
-	// 1. Parse the task message
-	// 2. Execute the task (e.g., run Agent666 on the issue)
-	// 3. Update task status via API or NATS
-	// 4. Handle errors and retries
+// processTask runs the pipeline for a single task message and publishes the result
+func (w *Worker) processTask(msg *nats.Msg) {
+	var task TaskMessage
+	if err := json.Unmarshal(msg.Data, &task); err != nil {
+		log.Printf("Failed to unmarshal task message: %v", err)
+		// Malformed messages will never succeed, move them to the dead letter stream
+		w.deadLetter(msg, deadletter.ReasonPoison, err)
+		return
+	}
 
-	// For now, just acknowledge the message
-	time.Sleep(1 * time.Second) // Simulate work
+	log.Printf("Received task: ID=%s, IssueID=%s, Repository=%s", task.ID, task.IssueID, task.Repository)
 
+	if model.IsTerminal(task.Status) {
+		// Finished tasks must not run again, stop redelivery
+		log.Printf("Task %s is already %s, skipping", task.ID, task.Status)
+		msg.Term()
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(w.runCtx)
+	defer cancel(nil)
+	if err := w.tasks.start(task.ID, cancel); err != nil {
+		if errors.Is(err, ErrTaskRunning) {
+			// Redelivered while it runs, the running copy acknowledges the message
+			log.Printf("Task %s is already running, ignoring redelivery", task.ID)
+			return
+		}
+		w.handBack(msg)
+		return
+	}
+	w.checkCancelled(task.ID, cancel)
+
+	// A pipeline runs far longer than the consumer's AckWait, keep the message
+	// from being redelivered until it is acknowledged
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	defer stopHeartbeat()
+	go w.keepInProgress(heartbeatCtx, task.ID, msg)
+
+	// Tasks of the same repository wait for each other
+	var result *PipelineResult
+	unlock, err := w.pool.lockRepo(ctx, task.Repository)
+	if err == nil {
+		w.reportStatus(&task, model.StatusProcessing, "")
+		result = w.runTask(ctx, &task)
+		unlock()
+	}
+
+	if reason, ok := cancelledReason(ctx); ok {
+		// Cancelled tasks must not run again, stop redelivery
+		stopHeartbeat()
+		w.reportCancelled(&task, reason)
+		if err := msg.Term(); err != nil {
+			log.Printf("Failed to terminate message of cancelled task %s: %v", task.ID, err)
+		}
+		w.tasks.finish(task.ID, false)
+		return
+	}
+
+	if w.runCtx.Err() != nil {
+		// Interrupted by shutdown, the task runs again on another worker
+		log.Printf("Task %s interrupted by shutdown, handing it back", task.ID)
+		stopHeartbeat()
+		if result != nil {
+			w.reportStatus(&task, model.StatusPending, "")
+		}
+		msg.Nak()
+		w.tasks.finish(task.ID, true)
+		return
+	}
+
+	event, err := w.reportResult(&task, result)
+	stopHeartbeat()
+	if err != nil {
+		log.Printf("Failed to report completion for task %s: %v", task.ID, err)
+		w.tasks.finish(task.ID, true)
+		if deadletter.Exhausted(msg, MaxDeliver) {
+			w.deadLetter(msg, deadletter.ReasonMaxDeliver, err)
+			return
+		}
+		w.retry(msg, err)
+		return
+	}
+
+	w.reportStatus(&task, event.TaskStatus(), event.ErrorMessage)
+	w.tasks.finish(task.ID, false)
 	if err := msg.Ack(); err != nil {
 		log.Printf("Failed to acknowledge message: %v", err)
 		return
 	}
 
-	log.Printf("Task processed successfully")
+	log.Printf("Task %s processed with status %s", task.ID, event.Status)
+}
+
+// retry Naks a task message for redelivery after the backoff delay of its attempt
+func (w *Worker) retry(msg *nats.Msg, cause error) {
+	attempt := 1
+	if meta, err := msg.Metadata(); err == nil {
+		attempt = int(meta.NumDelivered)
+	}
+
+	delay := w.backoff.Delay(attempt, cause)
+	if err := msg.NakWithDelay(delay); err != nil {
+		log.Printf("Failed to nak message: %v", err)
+		return
+	}
+	log.Printf("Task will be redelivered in %v (attempt %d/%d)", delay, attempt, MaxDeliver)
+}
+
+// handBack returns a fetched task to the queue without running it
+func (w *Worker) handBack(msg *nats.Msg) {
+	var task TaskMessage
+	json.Unmarshal(msg.Data, &task)
+
+	if err := msg.Nak(); err != nil {
+		log.Printf("Failed to hand back task %s: %v", task.ID, err)
+		return
+	}
+
+	w.tasks.handBack(task.ID)
+	log.Printf("Task %s handed back", task.ID)
+}
+
+// deadLetter moves a task message to the dead letter stream
+func (w *Worker) deadLetter(msg *nats.Msg, reason string, cause error) {
+	if err := deadletter.Move(w.js, msg, reason, cause); err != nil {
+		log.Printf("Failed to dead-letter message: %v", err)
+		return
+	}
+
+	log.Printf("Message moved to %s (reason: %s)", subjects.StreamTasksDLQ, reason)
+}
+
+// pollAgentIntel repeatedly asks agent-intel-go for the next highest scored task
+// and executes it until ctx is cancelled
+func (w *Worker) pollAgentIntel(ctx context.Context, repoID string, interval, heartbeatInterval time.Duration) {
+	for ctx.Err() == nil {
+		next, err := w.intel.NextTask(repoID, w.id, w.capabilities)
+		if err != nil {
+			log.Printf("Error fetching next task: %v", err)
+			sleepContext(ctx, interval)
+			continue
+		}
+
+		if next == nil {
+			// No pending tasks
+			sleepContext(ctx, interval)
+			continue
+		}
+
+		task := next.Task.toTaskMessage()
+		log.Printf("Assigned task: ID=%s, IssueID=%s, Repository=%s, Score=%.3f", task.ID, task.IssueID, task.Repository, next.Score)
+
+		taskCtx, cancel := context.WithCancelCause(w.runCtx)
+		if err := w.tasks.start(task.ID, cancel); err != nil {
+			cancel(nil)
+			if errors.Is(err, ErrTaskRunning) {
+				// Claimed again by another poller while it runs here
+				log.Printf("Task %s is already running, skipping", task.ID)
+				continue
+			}
+			// Shutdown started after the claim, the lease expires and the task is requeued
+			w.tasks.handBack(task.ID)
+			return
+		}
+		w.checkCancelled(task.ID, cancel)
+
+		w.runClaimedTask(taskCtx, cancel, task, heartbeatInterval)
+	}
+}
+
+// runClaimedTask starts, executes and reports a task claimed from agent-intel-go
+func (w *Worker) runClaimedTask(ctx context.Context, cancel context.CancelCauseFunc, task *TaskMessage, heartbeatInterval time.Duration) {
+	defer cancel(nil)
+
+	if err := w.intel.StartTask(task.ID, w.id); err != nil {
+		// Lease lost between claim and start, or agent-intel-go unreachable;
+		// an unstarted claim is reclaimed once its lease expires
+		log.Printf("Failed to start task %s: %v", task.ID, err)
+		w.tasks.finish(task.ID, true)
+		return
+	}
+
+	// Keep the assignment lease alive while the pipeline runs
+	var leaseLost atomic.Bool
+	go w.keepLease(ctx, task.ID, heartbeatInterval, func() {
+		leaseLost.Store(true)
+		cancel(nil)
+	})
+
+	// Tasks of the same repository wait for each other, the lease is kept alive meanwhile
+	var result *PipelineResult
+	unlock, err := w.pool.lockRepo(ctx, task.Repository)
+	if err == nil {
+		w.reportStatus(task, model.StatusProcessing, "")
+		result = w.runTask(ctx, task)
+		unlock()
+	}
+	cancel(nil)
+
+	if reason, ok := cancelledReason(ctx); ok {
+		// agent-intel-go already marked the task cancelled
+		w.reportCancelled(task, reason)
+		w.tasks.finish(task.ID, false)
+		return
+	}
+
+	if w.runCtx.Err() != nil {
+		// Interrupted by shutdown, the lease expires and agent-intel-go requeues the task
+		log.Printf("Task %s interrupted by shutdown, handing it back", task.ID)
+		if result != nil {
+			w.reportStatus(task, model.StatusPending, "")
+		}
+		w.tasks.finish(task.ID, true)
+		return
+	}
+
+	if leaseLost.Load() {
+		// The task was reclaimed and may already run elsewhere, don't report it
+		log.Printf("Lease for task %s was lost, discarding result", task.ID)
+		w.tasks.finish(task.ID, true)
+		return
+	}
+
+	event, err := w.reportResult(task, result)
+	if err != nil {
+		log.Printf("Failed to report completion for task %s: %v", task.ID, err)
+		w.tasks.finish(task.ID, true)
+		return
+	}
+
+	w.reportStatus(task, event.TaskStatus(), event.ErrorMessage)
+	w.tasks.finish(task.ID, false)
+	log.Printf("Task %s processed with status %s", task.ID, event.Status)
+}
+
+// sleepContext sleeps for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// keepLease sends lease heartbeats to agent-intel-go until the context is done
+func (w *Worker) keepLease(ctx context.Context, taskID string, interval time.Duration, onLost func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.intel.Heartbeat(taskID, w.id)
+			if err == ErrLeaseLost {
+				log.Printf("Lease for task %s lost, stopping pipeline", taskID)
+				onLost()
+				return
+			}
+			if err != nil {
+				// Transient failure, the lease may still be renewed on the next tick
+				log.Printf("Heartbeat for task %s failed: %v", taskID, err)
+			}
+		}
+	}
+}
+
+// keepInProgress marks a task message as in progress every heartbeat interval
+// until ctx is cancelled, resetting the consumer's AckWait
+func (w *Worker) keepInProgress(ctx context.Context, taskID string, msg *nats.Msg) {
+	ticker := time.NewTicker(w.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := msg.InProgress(); err != nil {
+				// Transient failure, the next tick may still reach the server before AckWait
+				log.Printf("Failed to mark task %s in progress: %v", taskID, err)
+			}
+		}
+	}
+}
+
+// runTask runs the pipeline for a task, killing it after the task timeout, and
+// logs its output. The output is also streamed to queue-go and saved as the task's log.
+func (w *Worker) runTask(ctx context.Context, task *TaskMessage) *PipelineResult {
+	ctx, cancel := context.WithTimeoutCause(ctx, w.taskTimeout, fmt.Errorf("%w after %v", ErrTaskTimeout, w.taskTimeout))
+	defer cancel()
+
+	output := w.newTaskLog(task.ID)
+	result := w.runner.Run(ctx, task, output)
+	if errors.Is(result.Err, ErrTaskTimeout) {
+		log.Printf("Task %s exceeded the task timeout of %v, pipeline killed", task.ID, w.taskTimeout)
+	}
+	output.close(result)
+
+	if result.Stdout != "" {
+		log.Printf("Task %s stdout:\n%s", task.ID, result.Stdout)
+	}
+	if result.Stderr != "" {
+		log.Printf("Task %s stderr:\n%s", task.ID, result.Stderr)
+	}
+	log.Printf("Task %s pipeline finished: exit code %d in %v", task.ID, result.ExitCode, result.Runtime)
+	if result.Commit != "" {
+		log.Printf("Task %s committed %s on branch %s", task.ID, result.Commit, result.Branch)
+	}
+
+	return result
+}
+
+// reportStatus tells queue-go about a task status change. Failures are only
+// logged, the pipeline completion event remains the source of truth.
+func (w *Worker) reportStatus(task *TaskMessage, status, errorMessage string) {
+	update := &StatusUpdateMessage{
+		TaskID:       task.ID,
+		Status:       status,
+		ErrorMessage: errorMessage,
+		UpdatedAt:    time.Now(),
+	}
+
+	if err := publishStatusUpdate(w.js, update); err != nil {
+		log.Printf("Warning: failed to report status %s for task %s: %v", status, task.ID, err)
+	}
+}
+
+// reportCancelled logs a task stopped by a cancellation and reports it cancelled to queue-go
+func (w *Worker) reportCancelled(task *TaskMessage, reason string) {
+	log.Printf("Task %s cancelled, pipeline stopped", task.ID)
+	w.reportStatus(task, model.StatusCancelled, reason)
+}
+
+// reportResult publishes the pipeline result to agent-intel-go
+func (w *Worker) reportResult(task *TaskMessage, result *PipelineResult) (*PipelineCompletedEvent, error) {
+	event := newPipelineCompletedEvent(task, result)
+	event.WorkerID = w.id
+	if err := publishPipelineCompleted(w.js, event); err != nil {
+		return nil, err
+	}
+
+	return event, nil
 }
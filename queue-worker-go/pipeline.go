@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxErrorMessageBytes limits how much pipeline output is copied into error messages
+	maxErrorMessageBytes = 2048
+
+	// killWaitDelay bounds how long a killed pipeline's children may keep its output open
+	killWaitDelay = 5 * time.Second
+)
+
+// PipelineRunner executes the configured pipeline command for a task
+type PipelineRunner struct {
+	command  []string
+	sandbox  *Sandbox  // Nil runs pipelines in the repository itself with the worker's environment
+	git      *GitFlow  // Nil leaves branches and commits to the pipeline
+	reporter *Reporter // Nil writes no reports
+}
+
+// PipelineResult holds the outcome of a pipeline run
+type PipelineResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Runtime  time.Duration
+	Err      error  // Set when the command could not be started or did not exit cleanly
+	Branch   string // Agent branch the pipeline ran on, empty outside git checkouts
+	Commit   string // Commit holding the result, empty when nothing was committed
+}
+
+// NewPipelineRunner creates a runner for a command line such as "droid exec".
+// The task file path and repository are appended as the last two arguments.
+func NewPipelineRunner(command string) (*PipelineRunner, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("pipeline command is empty")
+	}
+
+	return &PipelineRunner{command: fields}, nil
+}
+
+// Run executes the pipeline for a task and captures its exit code, output and
+// runtime. Output is also written to the task log when one is given. In a
+// sandbox the pipeline runs in a workspace that is removed once it exits. With
+// the git stage the pipeline runs on the task's agent branch, and finished runs
+// are reported and committed (see conclude).
+func (r *PipelineRunner) Run(ctx context.Context, task *TaskMessage, output *taskLog) *PipelineResult {
+	taskFilePath, repository := task.TaskFilePath, task.Repository
+	name, args := r.command[0], r.command[1:]
+	env := os.Environ()
+	dir := ""
+
+	// Run inside the repository when it exists locally
+	if info, err := os.Stat(task.Repository); err == nil && info.IsDir() {
+		dir = task.Repository
+	}
+
+	if r.sandbox != nil {
+		ws, err := r.sandbox.prepare(task)
+		if err != nil {
+			return &PipelineResult{ExitCode: -1, Err: err}
+		}
+		defer ws.cleanup()
+
+		taskFilePath, repository, dir = ws.path(task.Repository, task.TaskFilePath), ws.dir, ws.dir
+		name, args = r.sandbox.command(name, args)
+		env = append(r.sandbox.environ(), "WORKSPACE="+ws.dir, "TMPDIR="+ws.tmp)
+	}
+
+	// Work only happens on the task's agent branch
+	var branch string
+	if r.git != nil && dir != "" {
+		// Without a sandbox the pipeline runs in the user's checkout, which goes
+		// back to its branch once the run is over
+		var from string
+		if dir == task.Repository && isGitRepository(dir) {
+			var err error
+			if from, err = origin(dir); err != nil {
+				return &PipelineResult{ExitCode: -1, Err: err}
+			}
+		}
+
+		var err error
+		if branch, err = r.git.checkout(dir, task); err != nil {
+			return &PipelineResult{ExitCode: -1, Err: err}
+		}
+		if from != "" {
+			defer func() {
+				if err := r.git.restore(dir, branch, from, task); err != nil {
+					log.Printf("Warning: task %s: failed to switch %s back to %s: %v", task.ID, dir, from, err)
+				}
+			}()
+		}
+	}
+
+	args = append(append([]string{}, args...), taskFilePath, repository)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = killWaitDelay
+	cmd.Dir = dir
+	// Timeouts, cancellations and shutdown kill every process the pipeline started
+	isolateProcess(cmd)
+
+	cmd.Env = append(env,
+		"TASK_ID="+task.ID,
+		"ISSUE_ID="+task.IssueID,
+		"TASK_FILE_PATH="+taskFilePath,
+		"REPOSITORY="+task.Repository,
+	)
+	if branch != "" {
+		cmd.Env = append(cmd.Env, "AGENT_BRANCH="+branch)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if output != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, output.writer(LogStdout))
+		cmd.Stderr = io.MultiWriter(&stderr, output.writer(LogStderr))
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &PipelineResult{
+		ExitCode: 0,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Runtime:  time.Since(start),
+	}
+
+	if err != nil {
+		result.Err = err
+		result.ExitCode = -1
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+	}
+
+	// Timeouts are failures; any other cancellation (shutdown, task cancelled,
+	// lease lost) means the task isn't finished, so nothing is reported
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTaskTimeout) {
+		result.ExitCode = -1
+		result.Err = cause
+	} else if ctx.Err() != nil {
+		return result
+	}
+
+	r.conclude(dir, taskFilePath, branch, task, result)
+	return result
+}
+
+// conclude writes the report of a finished run and commits it on the agent
+// branch, along with the pipeline's changes when it succeeded. In a sandbox the
+// changes of a failed run are discarded and only its report is committed;
+// outside the sandbox they are committed with the report for inspection.
+func (r *PipelineRunner) conclude(dir, taskFilePath, branch string, task *TaskMessage, result *PipelineResult) {
+	succeeded := result.Succeeded()
+	fail := func(err error) {
+		if succeeded {
+			result.Err = err
+		} else {
+			log.Printf("Warning: task %s: %v", task.ID, err)
+		}
+	}
+
+	if branch != "" {
+		result.Branch = branch
+		if err := r.git.verify(dir, branch); err != nil {
+			fail(err)
+			return
+		}
+		if !succeeded && r.sandbox != nil {
+			if err := r.git.discard(dir); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+
+	if r.reporter != nil {
+		// Sandbox copies of plain directories are discarded, their reports go to the repository itself
+		reportDir, reportTaskFile := dir, taskFilePath
+		if branch == "" && r.sandbox != nil {
+			reportDir, reportTaskFile = task.Repository, task.TaskFilePath
+		}
+		if info, err := os.Stat(reportDir); reportDir != "" && err == nil && info.IsDir() {
+			path, err := r.reporter.write(reportDir, reportTaskFile, task, result)
+			if err != nil {
+				log.Printf("Warning: failed to write report of task %s: %v", task.ID, err)
+			} else {
+				rel, _ := filepath.Rel(reportDir, path)
+				log.Printf("Task %s report written to %s", task.ID, rel)
+			}
+		}
+	}
+
+	if branch != "" {
+		commit, err := r.git.commit(dir, branch, commitMessage(task, succeeded))
+		if err != nil {
+			fail(err)
+			return
+		}
+		result.Commit = commit
+	}
+}
+
+// Succeeded reports whether the pipeline exited with status 0
+func (r *PipelineResult) Succeeded() bool {
+	return r.Err == nil && r.ExitCode == 0
+}
+
+// ErrorMessage summarizes a failed run using the tail of stderr
+func (r *PipelineResult) ErrorMessage() string {
+	if r.Succeeded() {
+		return ""
+	}
+
+	msg := fmt.Sprintf("pipeline exited with code %d", r.ExitCode)
+	if r.Err != nil {
+		msg = fmt.Sprintf("pipeline failed: %v", r.Err)
+	}
+
+	output := strings.TrimSpace(r.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(r.Stdout)
+	}
+	if len(output) > maxErrorMessageBytes {
+		output = "..." + output[len(output)-maxErrorMessageBytes:]
+	}
+	if output != "" {
+		msg += ": " + output
+	}
+
+	return msg
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript creates an executable shell script for pipeline tests
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pipeline.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestNewPipelineRunnerEmptyCommand tests that an empty command is rejected
+func TestNewPipelineRunnerEmptyCommand(t *testing.T) {
+	if _, err := NewPipelineRunner("   "); err == nil {
+		t.Error("Expected error for empty pipeline command")
+	}
+}
+
+// TestPipelineRunnerSuccess tests a successful pipeline run
+func TestPipelineRunnerSuccess(t *testing.T) {
+	script := writeScript(t, `echo "file=$1 repo=$2 id=$TASK_ID"`)
+	repo := t.TempDir()
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := &TaskMessage{ID: "task-1", IssueID: "1", Repository: repo, TaskFilePath: "docs/task/1-test.md"}
+	result := runner.Run(context.Background(), task, nil)
+
+	if !result.Succeeded() {
+		t.Fatalf("Expected success, got exit code %d: %v", result.ExitCode, result.Err)
+	}
+
+	expected := "file=docs/task/1-test.md repo=" + repo + " id=task-1"
+	if strings.TrimSpace(result.Stdout) != expected {
+		t.Errorf("Expected stdout %q, got %q", expected, result.Stdout)
+	}
+
+	if result.ErrorMessage() != "" {
+		t.Errorf("Expected empty error message, got %q", result.ErrorMessage())
+	}
+}
+
+// TestPipelineRunnerFailure tests exit code and stderr capture on failure
+func TestPipelineRunnerFailure(t *testing.T) {
+	script := writeScript(t, `echo "tests failed" >&2; exit 3`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := runner.Run(context.Background(), &TaskMessage{ID: "task-2"}, nil)
+
+	if result.Succeeded() {
+		t.Fatal("Expected failure")
+	}
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+
+	if !strings.Contains(result.ErrorMessage(), "tests failed") {
+		t.Errorf("Expected error message to contain stderr, got %q", result.ErrorMessage())
+	}
+}
+
+// TestPipelineRunnerMissingExecutable tests that start failures are reported
+func TestPipelineRunnerMissingExecutable(t *testing.T) {
+	runner, err := NewPipelineRunner("/nonexistent/pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := runner.Run(context.Background(), &TaskMessage{ID: "task-3"}, nil)
+
+	if result.Succeeded() {
+		t.Fatal("Expected failure for missing executable")
+	}
+
+	if result.ExitCode != -1 {
+		t.Errorf("Expected exit code -1, got %d", result.ExitCode)
+	}
+}
+
+// TestNewPipelineCompletedEvent tests the completion event built from results
+func TestNewPipelineCompletedEvent(t *testing.T) {
+	task := &TaskMessage{ID: "task-4", Repository: "/test/repo"}
+
+	success := newPipelineCompletedEvent(task, &PipelineResult{ExitCode: 0})
+	if success.Status != PipelineStatusSuccess {
+		t.Errorf("Expected status %s, got %s", PipelineStatusSuccess, success.Status)
+	}
+
+	failure := newPipelineCompletedEvent(task, &PipelineResult{ExitCode: 1, Stderr: "boom"})
+	if failure.Status != PipelineStatusFailure {
+		t.Errorf("Expected status %s, got %s", PipelineStatusFailure, failure.Status)
+	}
+
+	if failure.ExitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", failure.ExitCode)
+	}
+
+	if !strings.Contains(failure.ErrorMessage, "boom") {
+		t.Errorf("Expected error message to contain stderr, got %q", failure.ErrorMessage)
+	}
+}
+
+// TestWorkerRunTaskTimeout tests that a pipeline exceeding the task timeout is killed and reported failed
+func TestWorkerRunTaskTimeout(t *testing.T) {
+	// Without a sandbox the background sleep still keeps stdout open unless
+	// the whole process group is killed
+	script := writeScript(t, `sleep 5 & exec sleep 5`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := newWorker("worker-1", nil, runner, 1)
+	worker.taskTimeout = 50 * time.Millisecond
+
+	task := &TaskMessage{ID: "task-1", IssueID: "1", Repository: t.TempDir(), TaskFilePath: "docs/task/1-test.md"}
+	result := worker.runTask(context.Background(), task)
+
+	if result.Succeeded() {
+		t.Fatal("Expected timed out pipeline to fail")
+	}
+	if !errors.Is(result.Err, ErrTaskTimeout) {
+		t.Errorf("Expected ErrTaskTimeout, got %v", result.Err)
+	}
+	if result.Runtime > 2*time.Second {
+		t.Errorf("Expected pipeline to be killed promptly, ran for %v", result.Runtime)
+	}
+	if !strings.Contains(result.ErrorMessage(), "timed out") {
+		t.Errorf("Expected error message to mention the timeout, got %q", result.ErrorMessage())
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pool bounds how many tasks a worker executes at once and serializes tasks
+// for the same repository, since they share one git checkout
+type pool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu    sync.Mutex
+	repos map[string]*repoLock
+}
+
+// repoLock serializes the tasks of one repository
+type repoLock struct {
+	ch   chan struct{}
+	refs int // Tasks holding or waiting for the lock
+}
+
+// newPool creates a pool running up to size tasks at once
+func newPool(size int) *pool {
+	if size < 1 {
+		size = 1
+	}
+	return &pool{
+		slots: make(chan struct{}, size),
+		repos: make(map[string]*repoLock),
+	}
+}
+
+// size returns the maximum number of concurrent tasks
+func (p *pool) size() int {
+	return cap(p.slots)
+}
+
+// waitFree blocks until at least one slot is free, without reserving it, and
+// returns how many slots are free. It returns 0 if ctx is cancelled first.
+func (p *pool) waitFree(ctx context.Context) int {
+	select {
+	case p.slots <- struct{}{}:
+		<-p.slots
+	case <-ctx.Done():
+		return 0
+	}
+
+	// Slots taken since are only found out by acquire
+	if free := p.size() - len(p.slots); free > 1 {
+		return free
+	}
+	return 1
+}
+
+// acquire blocks until it reserved a slot, calling waiting every interval
+// while all slots are busy. It returns false if ctx is cancelled first.
+func (p *pool) acquire(ctx context.Context, interval time.Duration, waiting func()) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case p.slots <- struct{}{}:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			waiting()
+		}
+	}
+}
+
+// release frees n reserved slots
+func (p *pool) release(n int) {
+	for i := 0; i < n; i++ {
+		<-p.slots
+	}
+}
+
+// run executes fn on its own goroutine using a slot acquired beforehand
+func (p *pool) run(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.release(1)
+		fn()
+	}()
+}
+
+// wait blocks until every task started with run returned
+func (p *pool) wait() {
+	p.wg.Wait()
+}
+
+// lockRepo blocks until no other task of the repository runs. It returns an
+// unlock function, or ctx's error if ctx is cancelled first.
+func (p *pool) lockRepo(ctx context.Context, repository string) (func(), error) {
+	// A stopped task never takes the lock, even when it is free
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	lock, ok := p.repos[repository]
+	if !ok {
+		lock = &repoLock{ch: make(chan struct{}, 1)}
+		p.repos[repository] = lock
+	}
+	lock.refs++
+	p.mu.Unlock()
+
+	select {
+	case lock.ch <- struct{}{}:
+		return func() {
+			<-lock.ch
+			p.unref(repository, lock)
+		}, nil
+	case <-ctx.Done():
+		p.unref(repository, lock)
+		return nil, ctx.Err()
+	}
+}
+
+// unref drops a reference to a repository lock, forgetting it once unused
+func (p *pool) unref(repository string, lock *repoLock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(p.repos, repository)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestPoolWaitFree tests waiting for free slots without reserving them
+func TestPoolWaitFree(t *testing.T) {
+	p := newPool(3)
+
+	if got := p.waitFree(context.Background()); got != 3 {
+		t.Fatalf("Expected 3 free slots, got %d", got)
+	}
+	if got := p.waitFree(context.Background()); got != 3 {
+		t.Fatalf("Expected waiting not to reserve slots, got %d free", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		p.acquire(context.Background(), time.Hour, nil)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if got := p.waitFree(ctx); got != 0 {
+		t.Errorf("Expected no slot while the pool is full, got %d", got)
+	}
+
+	p.release(2)
+	if got := p.waitFree(context.Background()); got != 2 {
+		t.Errorf("Expected 2 free slots, got %d", got)
+	}
+}
+
+// TestPoolAcquire tests that acquiring a slot reports waiting while the pool is full
+func TestPoolAcquire(t *testing.T) {
+	p := newPool(1)
+
+	if !p.acquire(context.Background(), time.Hour, nil) {
+		t.Fatal("Expected a free slot to be acquired")
+	}
+
+	var waited atomic.Int32
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p.release(1)
+	}()
+	if !p.acquire(context.Background(), 5*time.Millisecond, func() { waited.Add(1) }) {
+		t.Fatal("Expected the released slot to be acquired")
+	}
+	if waited.Load() == 0 {
+		t.Error("Expected waiting to be reported while the pool was full")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if p.acquire(ctx, time.Hour, nil) {
+		t.Error("Expected no slot while the pool is full")
+	}
+}
+
+// TestPoolRun tests that tasks run concurrently up to the pool size
+func TestPoolRun(t *testing.T) {
+	p := newPool(2)
+
+	var running, peak atomic.Int32
+	for i := 0; i < 6; i++ {
+		p.acquire(context.Background(), time.Hour, nil)
+		p.run(func() {
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	p.wait()
+
+	if peak.Load() != 2 {
+		t.Errorf("Expected 2 tasks running at once, got %d", peak.Load())
+	}
+}
+
+// TestPoolLockRepo tests that tasks of the same repository never overlap
+func TestPoolLockRepo(t *testing.T) {
+	p := newPool(4)
+
+	var wg sync.WaitGroup
+	var running atomic.Int32
+	var overlapped atomic.Bool
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := p.lockRepo(context.Background(), "/test/repo")
+			if err != nil {
+				t.Errorf("Failed to lock repository: %v", err)
+				return
+			}
+			if running.Add(1) > 1 {
+				overlapped.Store(true)
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if overlapped.Load() {
+		t.Error("Expected tasks of the same repository to run one at a time")
+	}
+	if len(p.repos) != 0 {
+		t.Errorf("Expected repository locks to be released, got %d", len(p.repos))
+	}
+
+	// Other repositories are not blocked
+	unlock, _ := p.lockRepo(context.Background(), "/test/repo")
+	defer unlock()
+	other, err := p.lockRepo(context.Background(), "/other/repo")
+	if err != nil {
+		t.Fatalf("Expected other repository to lock, got %v", err)
+	}
+	other()
+}
+
+// TestPoolLockRepoCancel tests that a task blocked on a busy repository gives up on cancel
+func TestPoolLockRepoCancel(t *testing.T) {
+	p := newPool(2)
+
+	unlock, _ := p.lockRepo(context.Background(), "/test/repo")
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.lockRepo(ctx, "/test/repo"); err == nil {
+		t.Fatal("Expected lock to fail once the context expired")
+	}
+}
+
+// TestFetchLimit tests fetch sizing against concurrency and MaxAckPending
+func TestFetchLimit(t *testing.T) {
+	tests := []struct {
+		concurrency   int
+		maxAckPending int
+		want          int
+	}{
+		{1, 100, 1},
+		{4, 100, 4},
+		{50, 100, maxFetchBatch},
+		{8, 3, 3},
+	}
+
+	for _, tt := range tests {
+		if got := fetchLimit(tt.concurrency, tt.maxAckPending); got != tt.want {
+			t.Errorf("fetchLimit(%d, %d) = %d, want %d", tt.concurrency, tt.maxAckPending, got, tt.want)
+		}
+	}
+}
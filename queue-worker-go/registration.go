@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"contracts-go/fleet"
+
+	"github.com/nats-io/nats.go"
+)
+
+// registration keeps the worker's record in the WORKERS bucket up to date so
+// queue-go can list the fleet
+type registration struct {
+	js       nats.JetStreamContext
+	kv       nats.KeyValue // Nil until the bucket could be opened
+	mu       sync.Mutex    // Guards kv and record
+	record   fleet.Worker
+	tasks    *inFlight
+	interval time.Duration
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// register writes the worker's record and refreshes it every interval until
+// deregister is called. When the first write fails the error is returned along
+// with the registration, which keeps retrying on every heartbeat.
+func register(js nats.JetStreamContext, record fleet.Worker, tasks *inFlight, interval time.Duration) (*registration, error) {
+	record.Hostname, _ = os.Hostname()
+	record.State = fleet.StateRunning
+	record.StartedAt = time.Now()
+	record.HeartbeatIntervalMs = interval.Milliseconds()
+
+	r := &registration{
+		js:       js,
+		record:   record,
+		tasks:    tasks,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	err := r.refresh()
+
+	ctx, stop := context.WithCancel(context.Background())
+	r.stop = stop
+	go r.heartbeat(ctx)
+
+	return r, err
+}
+
+// heartbeat refreshes the record every interval until ctx is cancelled
+func (r *registration) heartbeat(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(); err != nil {
+				// Transient failure, the worker is only reported dead after several missed heartbeats
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+}
+
+// refresh writes the record with the tasks currently executing
+func (r *registration) refresh() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	running, draining := r.tasks.snapshot()
+	r.record.CurrentTasks = running
+	if draining {
+		r.record.State = fleet.StateDraining
+	}
+
+	return r.put()
+}
+
+// put writes the record, opening the bucket first if an earlier attempt failed
+func (r *registration) put() error {
+	if r.kv == nil {
+		kv, err := fleet.EnsureBucket(r.js)
+		if err != nil {
+			return err
+		}
+		r.kv = kv
+	}
+	return fleet.Put(r.kv, &r.record)
+}
+
+// deregister stops the heartbeat and marks the worker as stopped
+func (r *registration) deregister() {
+	r.stop()
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.record.State = fleet.StateStopped
+	r.record.CurrentTasks = nil
+	if err := r.put(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Report directories, relative to the repository
+	ReportDirEnd   = "docs/task/end"
+	ReportDirError = "docs/task/error"
+
+	// maxExcerptLines limits how many trailing output lines a report quotes per stream
+	maxExcerptLines = 40
+)
+
+// Reporter writes the report of each pipeline run into the task's repository:
+// docs/task/end/<task file> when it succeeded, docs/task/error/<task file>
+// otherwise. The original task file is moved into the report.
+type Reporter struct {
+	workerID string
+	now      func() time.Time
+}
+
+// NewReporter creates a reporter signing reports with the worker ID
+func NewReporter(workerID string) *Reporter {
+	return &Reporter{workerID: workerID, now: time.Now}
+}
+
+// write writes the report of a run into the repository checked out in dir.
+// taskFilePath is the task file as seen from dir; relative paths are resolved
+// against dir. It returns the path of the report.
+func (r *Reporter) write(dir, taskFilePath string, task *TaskMessage, result *PipelineResult) (string, error) {
+	if taskFilePath != "" && !filepath.IsAbs(taskFilePath) {
+		taskFilePath = filepath.Join(dir, taskFilePath)
+	}
+
+	// Only task files inside the repository are moved
+	var taskContent []byte
+	if within(dir, taskFilePath) {
+		taskContent, _ = os.ReadFile(taskFilePath)
+	}
+	if taskContent == nil {
+		taskFilePath = ""
+	}
+
+	reportDir := ReportDirEnd
+	if !result.Succeeded() {
+		reportDir = ReportDirError
+	}
+	path := filepath.Join(dir, reportDir, reportName(task))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", reportDir, err)
+	}
+
+	if err := os.WriteFile(path, []byte(r.render(task, result, taskContent)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if taskFilePath != "" && taskFilePath != path {
+		if err := os.Remove(taskFilePath); err != nil {
+			return path, fmt.Errorf("failed to move task file: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// render builds the markdown report of a run
+func (r *Reporter) render(task *TaskMessage, result *PipelineResult, taskContent []byte) string {
+	status := "completed"
+	summary := fmt.Sprintf("The pipeline succeeded in %v.", result.Runtime.Round(time.Millisecond))
+	if !result.Succeeded() {
+		status = "failed"
+		summary = fmt.Sprintf("The pipeline failed with exit code %d after %v.", result.ExitCode, result.Runtime.Round(time.Millisecond))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", reportTitle(task, taskContent))
+
+	fmt.Fprintf(&b, "## Summary\n\n%s\n\n", summary)
+	fmt.Fprintf(&b, "- **Status:** %s\n", status)
+	fmt.Fprintf(&b, "- **Task:** `%s`\n", task.ID)
+	fmt.Fprintf(&b, "- **Issue:** #%s\n", task.IssueID)
+	fmt.Fprintf(&b, "- **Repository:** `%s`\n", task.Repository)
+	if result.Branch != "" {
+		fmt.Fprintf(&b, "- **Branch:** `%s`\n", result.Branch)
+	}
+	fmt.Fprintf(&b, "- **Exit code:** %d\n", result.ExitCode)
+	fmt.Fprintf(&b, "- **Runtime:** %v\n", result.Runtime.Round(time.Millisecond))
+	fmt.Fprintf(&b, "- **Finished:** %s\n", r.now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- **Worker:** %s\n", r.workerID)
+
+	if !result.Succeeded() {
+		b.WriteString("\n## Error\n\n")
+		writeFenced(&b, result.ErrorMessage())
+	}
+
+	if result.Stdout != "" || result.Stderr != "" {
+		b.WriteString("\n## Log excerpt\n")
+		for _, stream := range []struct{ name, output string }{{LogStdout, result.Stdout}, {LogStderr, result.Stderr}} {
+			if stream.output == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "\n%s:\n\n", stream.name)
+			writeFenced(&b, tailLines(stream.output, maxExcerptLines))
+		}
+	}
+
+	if len(taskContent) > 0 {
+		b.WriteString("\n## Original task\n\n")
+		b.WriteString(strings.TrimRight(string(taskContent), "\n"))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// reportName returns the file name of a task's report: the task file name, or
+// <issue>-<desc>.md when the task has no markdown task file
+func reportName(task *TaskMessage) string {
+	if name := filepath.Base(task.TaskFilePath); strings.HasSuffix(name, ".md") {
+		return name
+	}
+	return issueSlug(task) + "-" + taskDescription(task) + ".md"
+}
+
+// reportTitle returns the first heading of the task file, or the issue when it has none
+func reportTitle(task *TaskMessage, taskContent []byte) string {
+	scanner := bufio.NewScanner(strings.NewReader(string(taskContent)))
+	for scanner.Scan() {
+		if title, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "# "); ok {
+			return strings.TrimSpace(title)
+		}
+	}
+	return fmt.Sprintf("Issue #%s", task.IssueID)
+}
+
+// tailLines returns the last n lines of output
+func tailLines(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return "...\n" + strings.Join(lines[len(lines)-n:], "\n")
+}
+
+// writeFenced writes text as a fenced code block, using a fence longer than
+// any backtick run inside it
+func writeFenced(b *strings.Builder, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%stext\n%s\n%s\n", fence, strings.TrimRight(text, "\n"), fence)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReporterRender tests the sections of a failure report
+func TestReporterRender(t *testing.T) {
+	reporter := NewReporter("worker-1")
+	reporter.now = func() time.Time { return time.Date(2025, 10, 19, 15, 0, 0, 0, time.UTC) }
+
+	task := &TaskMessage{ID: "task-1", IssueID: "16", Repository: "/repo", TaskFilePath: "docs/task/16-agent-intel.md"}
+	result := &PipelineResult{ExitCode: 2, Stdout: "building\n", Stderr: "```panic```\n", Runtime: 1500 * time.Millisecond, Branch: "agent666/issue-16-agent-intel"}
+
+	report := reporter.render(task, result, []byte("# feat: Agent Intel Service\n\nDetails\n"))
+
+	for _, expected := range []string{
+		"# feat: Agent Intel Service\n",
+		"The pipeline failed with exit code 2 after 1.5s.",
+		"- **Status:** failed\n",
+		"- **Branch:** `agent666/issue-16-agent-intel`\n",
+		"- **Finished:** 2025-10-19T15:00:00Z\n",
+		"- **Worker:** worker-1\n",
+		"## Error\n\n````text\npipeline exited with code 2: ```panic```\n````\n",
+		"stdout:\n\n```text\nbuilding\n```\n",
+		"## Original task\n\n# feat: Agent Intel Service\n\nDetails\n",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected report to contain %q, got:\n%s", expected, report)
+		}
+	}
+}
+
+// TestTailLines tests log excerpt truncation
+func TestTailLines(t *testing.T) {
+	if got := tailLines("a\nb\nc\n", 5); got != "a\nb\nc" {
+		t.Errorf("Expected all lines, got %q", got)
+	}
+	if got := tailLines("a\nb\nc\n", 2); got != "...\nb\nc" {
+		t.Errorf("Expected last 2 lines, got %q", got)
+	}
+}
+
+// TestPipelineRunnerReports tests that reports are committed with the result and the task file moved
+func TestPipelineRunnerReports(t *testing.T) {
+	repo := initRepository(t)
+	if err := git(repo, "checkout", "-q", "-b", "work"); err != nil {
+		t.Fatal(err)
+	}
+	taskFile := filepath.Join(repo, "docs", "task", "7-fix-login.md")
+	os.MkdirAll(filepath.Dir(taskFile), 0755)
+	os.WriteFile(taskFile, []byte("# Fix login\n"), 0644)
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "task"}} {
+		if err := git(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		report string
+		files  []string
+	}{
+		{"success", `echo fixed > fix.txt`, ReportDirEnd, []string{"docs/task/7-fix-login.md", "docs/task/end/7-fix-login.md", "fix.txt"}},
+		{"failure", `echo partial > fix.txt; exit 1`, ReportDirError, []string{"docs/task/7-fix-login.md", "docs/task/error/7-fix-login.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewPipelineRunner(writeScript(t, tt.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.sandbox = newTestSandbox(t, []string{"PATH"}, 0)
+			runner.git = NewGitFlow([]string{"main"}, "agent666", "agent666@localhost")
+			runner.reporter = NewReporter("worker-1")
+
+			task := &TaskMessage{ID: "task-1", IssueID: "7", Repository: repo, TaskFilePath: taskFile}
+			result := runner.Run(context.Background(), task, nil)
+			if result.Commit == "" {
+				t.Fatalf("Expected a commit, got %+v", result)
+			}
+
+			// Moved task file, report and the pipeline's changes when it succeeded
+			files, err := gitOutput(repo, "show", "--name-only", "--format=", result.Commit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files != strings.Join(tt.files, "\n") {
+				t.Errorf("Expected commit to change %v, got %q", tt.files, files)
+			}
+
+			report, err := gitOutput(repo, "show", result.Commit+":"+tt.report+"/7-fix-login.md")
+			if err != nil || !strings.HasPrefix(report, "# Fix login\n") {
+				t.Errorf("Expected report titled after the task, got %q: %v", report, err)
+			}
+		})
+	}
+}
+
+// TestPipelineRunnerReportsWithoutGit tests that reports of plain directories go to the repository itself
+func TestPipelineRunnerReportsWithoutGit(t *testing.T) {
+	repo := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "docs", "task"), 0755)
+	os.WriteFile(filepath.Join(repo, "docs", "task", "3-docs.md"), []byte("# Docs\n"), 0644)
+
+	runner, err := NewPipelineRunner(writeScript(t, `exit 4`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.sandbox = newTestSandbox(t, []string{"PATH"}, 0)
+	runner.reporter = NewReporter("worker-1")
+
+	runner.Run(context.Background(), &TaskMessage{ID: "task-3", IssueID: "3", Repository: repo, TaskFilePath: "docs/task/3-docs.md"}, nil)
+
+	if _, err := os.Stat(filepath.Join(repo, "docs", "task", "3-docs.md")); !os.IsNotExist(err) {
+		t.Error("Expected the task file to be moved")
+	}
+	report, err := os.ReadFile(filepath.Join(repo, ReportDirError, "3-docs.md"))
+	if err != nil || !strings.Contains(string(report), "exit code 4") {
+		t.Errorf("Expected error report, got %q: %v", report, err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"contracts-go/backoff"
+	"contracts-go/model"
+	"contracts-go/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// RouteScanInterval is how often a stream mode worker looks for routed tasks it can run
+const RouteScanInterval = 10 * time.Second
+
+// router subscribes a stream mode worker to the task routes it can serve.
+// Listening on every combination of the worker's capabilities would take a
+// consumer and a fetch loop per combination, so the worker consumes tasks.new
+// and only binds the consumer of a route once the TASKS stream holds tasks
+// published on it.
+type router struct {
+	js           nats.JetStreamContext
+	worker       *Worker
+	capabilities []string
+	policy       backoff.Policy
+	concurrency  int
+
+	bound    map[string]bool // Subjects of the routes being fetched from
+	fetchers sync.WaitGroup
+}
+
+// newRouter creates a router for a worker running up to concurrency tasks at once
+func newRouter(js nats.JetStreamContext, worker *Worker, capabilities []string, policy backoff.Policy, concurrency int) *router {
+	return &router{
+		js:           js,
+		worker:       worker,
+		capabilities: capabilities,
+		policy:       policy,
+		concurrency:  concurrency,
+		bound:        make(map[string]bool),
+	}
+}
+
+// bind ensures the consumer of the tasks requiring the given capabilities
+// exists and starts fetching from it until ctx is cancelled
+func (r *router) bind(ctx context.Context, route []string) error {
+	subject := subjects.TaskNewSubject(route)
+	maxAckPending := ensureConsumer(r.js, route, r.policy)
+
+	sub, err := r.js.PullSubscribe(subject, subjects.TaskWorkersConsumer(route))
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+	r.bound[subject] = true
+
+	if r.concurrency > maxAckPending {
+		log.Printf("Warning: WORKER_CONCURRENCY %d exceeds the MaxAckPending %d of %s, at most %d of its tasks run at once",
+			r.concurrency, maxAckPending, subject, maxAckPending)
+	}
+	limit := fetchLimit(r.concurrency, maxAckPending)
+
+	r.fetchers.Add(1)
+	go func() {
+		defer r.fetchers.Done()
+		r.worker.processMessages(ctx, sub, limit)
+	}()
+
+	log.Printf("Subscribed to %s", subject)
+	return nil
+}
+
+// scan binds the routes holding tasks this worker can run that aren't bound yet
+func (r *router) scan(ctx context.Context) {
+	info, err := r.js.StreamInfo(StreamName, &nats.StreamInfoRequest{SubjectsFilter: subjects.TaskNewRouted})
+	if err != nil {
+		log.Printf("Warning: failed to list task routes: %v", err)
+		return
+	}
+
+	for _, route := range servableRoutes(r.capabilities, info.State.Subjects) {
+		if r.bound[subjects.TaskNewSubject(route)] {
+			continue
+		}
+		if err := r.bind(ctx, route); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// run scans for new routes every interval until ctx is cancelled, then waits
+// for the fetch loops to stop. Workers without capabilities only serve tasks.new.
+func (r *router) run(ctx context.Context, interval time.Duration) {
+	defer r.fetchers.Wait()
+
+	if len(r.capabilities) == 0 {
+		<-ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// servableRoutes returns the capabilities of the routes holding messages, given
+// the message count of each TASKS subject, that a worker with the given
+// capabilities can run, sorted by subject
+func servableRoutes(capabilities []string, subjectCounts map[string]uint64) [][]string {
+	routed := make([]string, 0, len(subjectCounts))
+	for subject, count := range subjectCounts {
+		if count > 0 {
+			routed = append(routed, subject)
+		}
+	}
+	sort.Strings(routed)
+
+	routes := [][]string{}
+	for _, subject := range routed {
+		route, ok := subjects.TaskNewCapabilities(subject)
+		if !ok || len(route) == 0 || !model.CanRun(capabilities, route) {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
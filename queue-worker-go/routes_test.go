@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestServableRoutes tests that a worker only consumes the routes holding tasks it can run
+func TestServableRoutes(t *testing.T) {
+	capabilities := []string{"docker", "git", "go", "java", "make", "node", "python", "repo-agent666", "rust", "terraform"}
+
+	tests := []struct {
+		name          string
+		subjectCounts map[string]uint64
+		want          [][]string
+	}{
+		{
+			name: "no routed tasks",
+			want: [][]string{},
+		},
+		{
+			name: "only routes the worker can serve",
+			subjectCounts: map[string]uint64{
+				"tasks.new.docker.go":    2,
+				"tasks.new.go":           1,
+				"tasks.new.go.kotlin":    3,
+				"tasks.new.rust":         0,
+				"tasks.new.go.make.node": 1,
+			},
+			want: [][]string{{"docker", "go"}, {"go"}, {"go", "make", "node"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := servableRoutes(capabilities, tt.subjectCounts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("servableRoutes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServableRoutesConsumerCount tests that the consumers of a worker grow with
+// the routes holding tasks, not with the combinations of its capabilities
+func TestServableRoutesConsumerCount(t *testing.T) {
+	capabilities := []string{"c0", "c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9"}
+	subjectCounts := map[string]uint64{
+		"tasks.new.c0":       5,
+		"tasks.new.c1.c2":    1,
+		"tasks.new.c3.c4.c5": 2,
+	}
+
+	// tasks.new plus one consumer per route holding tasks
+	if got, want := 1+len(servableRoutes(capabilities, subjectCounts)), 4; got != want {
+		t.Errorf("worker with %d capabilities binds %d consumers, want %d", len(capabilities), got, want)
+	}
+	if got := 1 + len(servableRoutes(capabilities, nil)); got != 1 {
+		t.Errorf("worker without routed tasks binds %d consumers, want 1", got)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEnvAllowlist lists the worker environment variables pipelines inherit by default
+const DefaultEnvAllowlist = "PATH,HOME,USER,LANG,LC_*,TERM,TZ"
+
+// gitTimeout bounds every git command run by the worker
+const gitTimeout = 2 * time.Minute
+
+// sandboxMarker marks a directory created by NewSandbox, the only kind it removes
+const sandboxMarker = ".queue-worker-sandbox"
+
+// limitsHelper is the first argument of a worker process started by
+// Sandbox.command to apply the resource limits of a pipeline run
+const limitsHelper = "__sandbox-exec"
+
+// Sandbox isolates pipeline runs: every run gets its own working copy of the
+// repository, only allowlisted environment variables and optional resource limits
+type Sandbox struct {
+	root         string   // Parent directory of task workspaces, owned by this worker
+	envAllowlist []string // Variable names, or prefixes ending in *
+	cpuSeconds   int      // CPU time limit per process of a run, 0 for none
+	memoryMB     int      // Data segment limit per process of a run, 0 for none
+	executable   string   // Worker binary applying the limits, empty without limits
+}
+
+// workspace is the directory a single pipeline run works in
+type workspace struct {
+	root string // Removed on cleanup
+	dir  string // Working copy of the repository
+	tmp  string // TMPDIR of the pipeline, kept out of the working copy
+	repo string // Repository the working copy is a git worktree of, empty otherwise
+}
+
+// NewSandbox creates a sandbox keeping workspaces in root. Workspaces left
+// behind by an earlier process of the worker are removed. An existing root is
+// only reused when it is empty or was created by NewSandbox.
+func NewSandbox(root string, envAllowlist []string, cpuSeconds, memoryMB int) (*Sandbox, error) {
+	if cpuSeconds < 0 || memoryMB < 0 {
+		return nil, fmt.Errorf("resource limits must not be negative")
+	}
+
+	var executable string
+	if cpuSeconds > 0 || memoryMB > 0 {
+		if !resourceLimitsSupported {
+			return nil, fmt.Errorf("resource limits are not supported on %s", runtime.GOOS)
+		}
+
+		var err error
+		if executable, err = os.Executable(); err != nil {
+			return nil, fmt.Errorf("failed to locate the worker binary applying resource limits: %w", err)
+		}
+	}
+
+	if err := removeStaleWorkspaces(root); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, sandboxMarker), nil, 0600); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+
+	return &Sandbox{
+		root:         root,
+		envAllowlist: envAllowlist,
+		cpuSeconds:   cpuSeconds,
+		memoryMB:     memoryMB,
+		executable:   executable,
+	}, nil
+}
+
+// removeStaleWorkspaces removes root if it is a workspace directory of an
+// earlier process, refusing any other non-empty directory
+func removeStaleWorkspaces(root string) error {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read workspace directory: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, sandboxMarker)); err != nil {
+		return fmt.Errorf("refusing to remove %s: not a workspace directory created by the worker", root)
+	}
+
+	if err := os.RemoveAll(root); err != nil {
+		return fmt.Errorf("failed to remove stale workspaces: %w", err)
+	}
+	return nil
+}
+
+// prepare creates the workspace of a task. Local git repositories are checked
+// out as a detached worktree of their HEAD, other local directories are copied
+// and repositories that don't exist locally get an empty directory.
+func (s *Sandbox) prepare(task *TaskMessage) (*workspace, error) {
+	root, err := os.MkdirTemp(s.root, "task-"+sanitizeName(task.ID)+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	ws := &workspace{
+		root: root,
+		dir:  filepath.Join(root, "repo"),
+		tmp:  filepath.Join(root, "tmp"),
+	}
+
+	if err := os.Mkdir(ws.tmp, 0700); err != nil {
+		ws.cleanup()
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	info, err := os.Stat(task.Repository)
+	switch {
+	case err != nil || !info.IsDir():
+		err = os.Mkdir(ws.dir, 0700)
+	case isGitRepository(task.Repository):
+		ws.repo = task.Repository
+		err = git(task.Repository, "worktree", "add", "--detach", ws.dir, "HEAD")
+	default:
+		err = copyDir(task.Repository, ws.dir)
+	}
+	if err != nil {
+		ws.cleanup()
+		return nil, fmt.Errorf("failed to prepare workspace of task %s: %w", task.ID, err)
+	}
+
+	return ws, nil
+}
+
+// cleanup removes the workspace, including its git worktree registration.
+// Failures are only logged.
+func (ws *workspace) cleanup() {
+	if ws.repo != "" {
+		if err := git(ws.repo, "worktree", "remove", "--force", ws.dir); err != nil {
+			log.Printf("Warning: failed to remove worktree %s: %v", ws.dir, err)
+		}
+	}
+
+	if err := os.RemoveAll(ws.root); err != nil {
+		log.Printf("Warning: failed to remove workspace %s: %v", ws.root, err)
+	}
+
+	if ws.repo != "" {
+		// Drops the registration when the worktree was only removed from disk
+		if err := git(ws.repo, "worktree", "prune"); err != nil {
+			log.Printf("Warning: failed to prune worktrees of %s: %v", ws.repo, err)
+		}
+	}
+}
+
+// path maps a path inside the repository to the same path in the workspace.
+// Paths outside the repository are returned unchanged.
+func (ws *workspace) path(repository, path string) string {
+	if !within(repository, path) {
+		return path
+	}
+	rel, _ := filepath.Rel(repository, path)
+	return filepath.Join(ws.dir, rel)
+}
+
+// within reports whether path is inside dir
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// environ returns the worker's allowlisted environment variables
+func (s *Sandbox) environ() []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if s.allowed(name) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// allowed reports whether a variable may be passed to pipelines
+func (s *Sandbox) allowed(name string) bool {
+	return matchesAny(name, s.envAllowlist)
+}
+
+// matchesAny reports whether name equals one of the patterns, or starts with
+// the prefix of a pattern ending in *
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// command returns the command line running a pipeline under the resource
+// limits: the worker binary applies them to itself with setrlimit and then
+// executes the pipeline in its place (see runLimitsHelper). Without limits the
+// command is returned unchanged.
+func (s *Sandbox) command(name string, args []string) (string, []string) {
+	if s.cpuSeconds == 0 && s.memoryMB == 0 {
+		return name, args
+	}
+
+	limits := []string{limitsHelper, strconv.Itoa(s.cpuSeconds), strconv.Itoa(s.memoryMB), name}
+	return s.executable, append(limits, args...)
+}
+
+// runLimitsHelper runs in a worker process started by Sandbox.command with
+// the arguments following limitsHelper. It applies the limits and executes
+// the pipeline, only returning to exit when that failed.
+func runLimitsHelper(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintf(os.Stderr, "usage: %s <cpu seconds> <memory MB> <command> [args...]\n", limitsHelper)
+		os.Exit(2)
+	}
+
+	cpuSeconds, cpuErr := strconv.Atoi(args[0])
+	memoryMB, memoryErr := strconv.Atoi(args[1])
+	if cpuErr != nil || memoryErr != nil {
+		fmt.Fprintf(os.Stderr, "invalid resource limits %q %q\n", args[0], args[1])
+		os.Exit(2)
+	}
+
+	err := execWithLimits(cpuSeconds, memoryMB, args[2], args[3:])
+	fmt.Fprintf(os.Stderr, "failed to run %s: %v\n", args[2], err)
+	os.Exit(127)
+}
+
+// isGitRepository reports whether dir is the top level of a git working tree
+func isGitRepository(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// git runs a git command in dir
+func git(dir string, args ...string) error {
+	_, err := gitOutput(dir, args...)
+	return err
+}
+
+// gitOutput runs a git command in dir and returns its trimmed output
+func gitOutput(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// copyDir copies a directory tree, keeping file modes and symlinks
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			// Sockets, devices and pipes are not part of a working copy
+			return nil
+		}
+	})
+}
+
+// copyFile copies a regular file
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// sanitizeName replaces the characters that can't appear in a file name
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ' ', '\t', ':':
+			return '-'
+		}
+		return r
+	}, name)
+}
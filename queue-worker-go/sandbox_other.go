@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// isolateProcess is a no-op where process groups are not available; only the
+// pipeline process itself is killed
+func isolateProcess(cmd *exec.Cmd) {}
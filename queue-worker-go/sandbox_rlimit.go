@@ -0,0 +1,42 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// resourceLimitsSupported reports whether the sandbox can apply resource limits
+const resourceLimitsSupported = true
+
+// execWithLimits limits the CPU time and data segment of the current process,
+// then replaces it with the command, which inherits the limits along with
+// every process it starts. It only returns on failure.
+func execWithLimits(cpuSeconds, memoryMB int, name string, args []string) error {
+	if cpuSeconds > 0 {
+		if err := setrlimit(syscall.RLIMIT_CPU, uint64(cpuSeconds)); err != nil {
+			return fmt.Errorf("failed to limit CPU time: %w", err)
+		}
+	}
+	if memoryMB > 0 {
+		// RLIMIT_DATA rather than RLIMIT_AS: Go and JVM toolchains reserve far
+		// more address space than they ever use
+		if err := setrlimit(syscall.RLIMIT_DATA, uint64(memoryMB)*1024*1024); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{name}, args...), os.Environ())
+}
+
+// setrlimit sets both the soft and the hard limit of a resource
+func setrlimit(resource int, value uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin)
+
+package main
+
+import "errors"
+
+// resourceLimitsSupported reports whether the sandbox can apply resource limits
+const resourceLimitsSupported = false
+
+// execWithLimits is never called where resource limits aren't supported
+func execWithLimits(cpuSeconds, memoryMB int, name string, args []string) error {
+	return errors.New("resource limits are not supported on this platform")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary apply resource limits like the worker binary
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == limitsHelper {
+		runLimitsHelper(os.Args[2:])
+	}
+	os.Exit(m.Run())
+}
+
+// newTestSandbox creates a sandbox keeping workspaces in a temporary directory
+func newTestSandbox(t *testing.T, allowlist []string, cpuSeconds int) *Sandbox {
+	t.Helper()
+
+	sandbox, err := NewSandbox(filepath.Join(t.TempDir(), "workspaces"), allowlist, cpuSeconds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sandbox
+}
+
+// assertNoWorkspaces fails when a workspace was left behind
+func assertNoWorkspaces(t *testing.T, sandbox *Sandbox) {
+	t.Helper()
+
+	entries, err := os.ReadDir(sandbox.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != sandboxMarker {
+		t.Errorf("Expected workspaces to be removed, found %d entries", len(entries))
+	}
+}
+
+// TestNewSandboxRoot tests that only workspace directories of the worker are removed
+func TestNewSandboxRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "workspaces")
+	sandbox, err := NewSandbox(root, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leftovers of a crashed run are removed on restart
+	os.Mkdir(filepath.Join(sandbox.root, "task-1"), 0700)
+	if _, err := NewSandbox(root, nil, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "task-1")); !os.IsNotExist(err) {
+		t.Error("Expected the stale workspace to be removed")
+	}
+
+	// Other directories are kept
+	other := t.TempDir()
+	os.WriteFile(filepath.Join(other, "data.txt"), []byte("keep"), 0644)
+	if _, err := NewSandbox(other, nil, 0, 0); err == nil {
+		t.Error("Expected a directory not created by the worker to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(other, "data.txt")); err != nil {
+		t.Errorf("Expected the directory to be kept: %v", err)
+	}
+}
+
+// initRepository creates a git repository with one commit on main
+func initRepository(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if err := git(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+// TestSandboxAllowed tests environment allowlist matching
+func TestSandboxAllowed(t *testing.T) {
+	sandbox := &Sandbox{envAllowlist: []string{"PATH", "LC_*"}}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"PATH", true},
+		{"PATHEXT", false},
+		{"LC_ALL", true},
+		{"LC_", true},
+		{"AWS_SECRET_ACCESS_KEY", false},
+	}
+
+	for _, tt := range tests {
+		if got := sandbox.allowed(tt.name); got != tt.want {
+			t.Errorf("allowed(%s): expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestSandboxCommand tests that resource limits run the command through the worker binary
+func TestSandboxCommand(t *testing.T) {
+	name, args := (&Sandbox{}).command("droid", []string{"exec"})
+	if name != "droid" || len(args) != 1 {
+		t.Errorf("Expected command unchanged without limits, got %s %v", name, args)
+	}
+
+	name, args = (&Sandbox{cpuSeconds: 60, memoryMB: 512, executable: "/usr/bin/queue-worker-go"}).command("droid", []string{"exec"})
+	expected := []string{limitsHelper, "60", "512", "droid", "exec"}
+	if name != "/usr/bin/queue-worker-go" || strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected /usr/bin/queue-worker-go %v, got %s %v", expected, name, args)
+	}
+}
+
+// TestWorkspacePath tests mapping repository paths into the workspace
+func TestWorkspacePath(t *testing.T) {
+	ws := &workspace{dir: "/tmp/ws/repo"}
+
+	if got := ws.path("/src/repo", "/src/repo/docs/task/1.md"); got != "/tmp/ws/repo/docs/task/1.md" {
+		t.Errorf("Expected path inside the workspace, got %s", got)
+	}
+	if got := ws.path("/src/repo", "/src/other/1.md"); got != "/src/other/1.md" {
+		t.Errorf("Expected path outside the repository unchanged, got %s", got)
+	}
+}
+
+// TestPipelineRunnerSandboxGit tests that pipelines run in a worktree that is removed afterwards
+func TestPipelineRunnerSandboxGit(t *testing.T) {
+	repo := initRepository(t)
+	os.MkdirAll(filepath.Join(repo, "docs", "task"), 0755)
+	os.WriteFile(filepath.Join(repo, "docs", "task", "1-test.md"), []byte("task"), 0644)
+
+	t.Setenv("PIPELINE_SECRET", "hidden")
+	script := writeScript(t, `echo "repo=$2 file=$1 secret=$PIPELINE_SECRET"; test "$PWD" = "$2" && touch created.txt && ulimit -t`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.sandbox = newTestSandbox(t, []string{"PATH"}, 60)
+
+	task := &TaskMessage{ID: "task-1", Repository: repo, TaskFilePath: filepath.Join(repo, "docs", "task", "1-test.md")}
+	result := runner.Run(context.Background(), task, nil)
+	if !result.Succeeded() {
+		t.Fatalf("Expected success, got %v: %s", result.Err, result.Stderr)
+	}
+
+	if strings.Contains(result.Stdout, "repo="+repo+" ") || !strings.Contains(result.Stdout, "/docs/task/1-test.md") {
+		t.Errorf("Expected pipeline to receive workspace paths, got %q", result.Stdout)
+	}
+	if strings.Contains(result.Stdout, "hidden") {
+		t.Errorf("Expected variables outside the allowlist to be dropped, got %q", result.Stdout)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(result.Stdout), "60") {
+		t.Errorf("Expected CPU limit of 60s, got %q", result.Stdout)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "created.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the repository to be left untouched")
+	}
+	assertNoWorkspaces(t, runner.sandbox)
+
+	output, err := exec.Command("git", "-C", repo, "worktree", "list").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(strings.TrimSpace(string(output)), "\n"); lines != 0 {
+		t.Errorf("Expected the worktree to be unregistered, got %s", output)
+	}
+}
+
+// TestPipelineRunnerSandboxMemoryLimit tests that the memory limit bounds the data segment, not the address space
+func TestPipelineRunnerSandboxMemoryLimit(t *testing.T) {
+	script := writeScript(t, `ulimit -d; ulimit -v`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.sandbox, err = NewSandbox(filepath.Join(t.TempDir(), "workspaces"), []string{"PATH"}, 0, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := runner.Run(context.Background(), &TaskMessage{ID: "task-3", Repository: t.TempDir()}, nil)
+	if !result.Succeeded() {
+		t.Fatalf("Expected success, got %v: %s", result.Err, result.Stderr)
+	}
+	if got := strings.Fields(result.Stdout); len(got) != 2 || got[0] != "262144" || got[1] != "unlimited" {
+		t.Errorf("Expected a data limit of 262144KB and no address space limit, got %q", result.Stdout)
+	}
+}
+
+// TestPipelineRunnerSandboxCopy tests that plain directories are copied and removed after a cancelled run
+func TestPipelineRunnerSandboxCopy(t *testing.T) {
+	repo := t.TempDir()
+	os.WriteFile(filepath.Join(repo, "input.txt"), []byte("data"), 0644)
+
+	// The background sleep keeps stdout open unless the whole process group is killed
+	script := writeScript(t, `echo changed > input.txt; sleep 5 & exec sleep 5`)
+
+	runner, err := NewPipelineRunner(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.sandbox = newTestSandbox(t, []string{"PATH"}, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	result := runner.Run(ctx, &TaskMessage{ID: "task-2", Repository: repo}, nil)
+	if result.Succeeded() || result.Runtime > 2*time.Second {
+		t.Errorf("Expected cancelled pipeline to be stopped, got %+v", result)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(repo, "input.txt"))
+	if string(data) != "data" {
+		t.Errorf("Expected the repository to be left untouched, got %q", data)
+	}
+	assertNoWorkspaces(t, runner.sandbox)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// handBackTimeout bounds how long interrupted tasks take to stop and be handed back
+	handBackTimeout = 10 * time.Second
+
+	// drainTimeout bounds how long the NATS connection takes to drain
+	drainTimeout = 10 * time.Second
+)
+
+// shutdown waits up to timeout for in-flight tasks to finish, interrupts and
+// hands back the ones still running, drains the NATS connection and logs a summary
+func (w *Worker) shutdown(nc *nats.Conn, loopDone <-chan struct{}, timeout time.Duration) {
+	running := w.tasks.drain()
+	if len(running) > 0 {
+		log.Printf("Waiting for %d in-flight task(s) to finish: %s", len(running), strings.Join(running, ", "))
+	}
+
+	if w.registration != nil {
+		// Show the worker as draining right away rather than on the next heartbeat
+		if err := w.registration.refresh(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	if !w.tasks.wait(timeout) {
+		log.Printf("Shutdown timeout reached, interrupting %d task(s)", w.tasks.count())
+		w.stopRun()
+		w.tasks.cancelAll()
+
+		if !w.tasks.wait(handBackTimeout) {
+			log.Printf("Warning: %d task(s) did not stop in time", w.tasks.count())
+		}
+	}
+
+	select {
+	case <-loopDone:
+	case <-time.After(handBackTimeout):
+		log.Println("Warning: task loop did not stop in time")
+	}
+
+	if w.registration != nil {
+		w.registration.deregister()
+	}
+
+	// Drain flushes pending acks and naks before the connection closes
+	closed := make(chan struct{})
+	nc.SetClosedHandler(func(*nats.Conn) { close(closed) })
+	if err := nc.Drain(); err != nil {
+		log.Printf("Warning: failed to drain NATS connection: %v", err)
+		nc.Close()
+	} else {
+		select {
+		case <-closed:
+		case <-time.After(drainTimeout):
+			log.Println("Warning: NATS connection did not drain in time")
+			nc.Close()
+		}
+	}
+
+	processed, completed, handedBack := w.tasks.summary()
+	log.Printf("Shutdown complete: %d task(s) processed since start, %d completed while draining, %d handed back",
+		processed, len(completed), len(handedBack))
+	if len(completed) > 0 {
+		log.Printf("  Completed: %s", strings.Join(completed, ", "))
+	}
+	if len(handedBack) > 0 {
+		log.Printf("  Handed back: %s", strings.Join(handedBack, ", "))
+	}
+}